@@ -4,8 +4,14 @@ import (
 	"context"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
 )
 
 // Estruturas do input/output
@@ -44,18 +50,26 @@ func main() {
 	}
 	log.Println("Servidor MCP TCP a correr em :9000")
 
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			log.Printf("Erro ao aceitar conexão: %v", err)
-			continue
+	srv := tcp.NewServer(server)
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			log.Fatalf("Erro MCP TCP: %v", err)
 		}
-		go func(c net.Conn) {
-			defer c.Close()
-			// Usa o conn como transporte direto para Run()
-			if err := server.Run(context.Background(), c); err != nil {
-				log.Printf("Erro MCP TCP: %v", err)
-			}
-		}(conn)
+	}()
+
+	// Espera por Ctrl+C / SIGTERM e encerra de forma graciosa: deixa de aceitar
+	// ligações, espera pelas tool calls em curso e só depois fecha as sessões
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	log.Println("A encerrar: a aguardar pelas tool calls em curso...")
+	drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	closed, err := srv.Shutdown(drainCtx)
+	if err != nil {
+		log.Printf("Tempo de drenagem esgotado: %v", err)
 	}
+	log.Printf("Servidor encerrado, %d sessões fechadas", closed)
 }
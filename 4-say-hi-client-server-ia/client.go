@@ -3,184 +3,96 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net"
-	"net/http"
 	"os"
 	"strings"
 
-	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
-)
-
-// --- LLaMA request/response types (ajusta se o teu backend usar outro formato) ---
-type LLMRequest struct {
-	Model        string  `json:"model"`
-	Prompt       string  `json:"prompt"`
-	MaxNewTokens int     `json:"max_new_tokens"`
-	Temperature  float64 `json:"temperature"`
-}
 
-type LLMResponse struct {
-	Choices []struct {
-		Text string `json:"text"`
-	} `json:"choices"`
-}
+	"mcp/llm"
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
+)
 
-// getNameFromLLM chama o client e devolve o texto (podes melhorar extração)
-func getNameFromLLM(prompt string) string {
-	reqBody := LLMRequest{
-		Model:        "qwen/qwen3-vl-4b",
-		Prompt:       "Extract the name of the person from this prompt and return only the name without any response: " + prompt,
-		MaxNewTokens: 20,
-		Temperature:  0.0,
+// errNoName é devolvido quando o LLM responde sem nenhum nome
+var errNoName = errors.New("o LLM não devolveu nenhum nome")
+
+// getNameFromLLM pede ao LLM o nome da pessoa (podes melhorar extração). Com
+// stream, a resposta vai sendo escrita à medida que o LLM a gera. Os erros
+// são devolvidos em vez de inventar um nome, que seria enviado à tool.
+func getNameFromLLM(ctx context.Context, provider llm.Provider, prompt string, stream bool) (string, error) {
+	messages := []llm.Message{{
+		Role:    llm.RoleUser,
+		Content: "Extract the name of the person from this prompt and return only the name without any response: " + prompt,
+	}}
+
+	var reply *llm.Message
+	var err error
+	if stream {
+		fmt.Print("LLM: ")
+		reply, err = llm.Stream(ctx, provider, messages, nil, func(d llm.Delta) { fmt.Print(d.Content) })
+		fmt.Println()
+	} else {
+		reply, err = provider.Chat(ctx, messages, nil)
 	}
-	data, _ := json.Marshal(reqBody)
-
-	resp, err := http.Post("http://127.0.0.1:1234/v1/completions", "application/json", bytes.NewReader(data))
 	if err != nil {
-		fmt.Println("Erro ao chamar LLM local: %v", err)
-		return "User"
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Erro a ler resposta LLM: %v", err)
-		return "User"
+	txt := strings.TrimSpace(reply.Content)
+	if txt == "" {
+		return "", errNoName
 	}
-
-	var llmResp LLMResponse
-	if err := json.Unmarshal(body, &llmResp); err != nil {
-		// tenta fallback para texto cru
-		txt := strings.TrimSpace(string(body))
-		if txt == "" {
-			return "User"
-		}
-		return txt
-	}
-
-	if len(llmResp.Choices) == 0 {
-		return "User"
-	}
-	// retorna o texto inteiro da escolha 0 - podes refinar com regex se quiseres só o nome
-	return strings.TrimSpace(llmResp.Choices[0].Text)
-}
-
-// --- Estruturas ChatGPT-5 ---
-type ChatGPTRequest struct {
-	Model     string              `json:"model"`
-	Messages  []map[string]string `json:"messages"`
-	MaxTokens int                 `json:"max_tokens,omitempty"`
-}
-
-type ChatGPTResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
-// ----------------- Transport TCP minimal compatível com mcp.Client.Connect -----------------
-// Este transport implementa mcp.Transport:
-//
-//	Connect(ctx) (mcp.Connection, error)
-//
-// A mcp.Connection deve implementar:
-//
-//	Read(ctx) (jsonrpc.Message, error)
-//	Write(ctx, jsonrpc.Message) error
-//	Close() error
-//	SessionID() string
-//
-// Vamos usar as funções auxiliares do pacote jsonrpc para (de)codificar mensagens.
-type tcpConnection struct {
-	conn      net.Conn
-	sessionID string
-	r         *bufio.Reader
-}
-
-func newTCPConnection(c net.Conn) *tcpConnection {
-	return &tcpConnection{
-		conn:      c,
-		sessionID: "session-" + c.RemoteAddr().String(),
-		r:         bufio.NewReader(c),
+	// retorna o texto inteiro da resposta - podes refinar com regex se quiseres só o nome
+	return txt, nil
+}
+
+// describeLLMError explica ao utilizador porque é que o LLM falhou
+func describeLLMError(err error) string {
+	var statusErr *llm.StatusError
+	switch {
+	case errors.Is(err, llm.ErrCircuitOpen):
+		return fmt.Sprintf("o LLM falhou várias vezes seguidas, à espera antes de tentar de novo (%v)", err)
+	case errors.Is(err, llm.ErrTimeout):
+		return fmt.Sprintf("o LLM demorou demasiado a responder (%v)", err)
+	case errors.Is(err, llm.ErrUnavailable):
+		return fmt.Sprintf("não foi possível ligar ao LLM (%v)", err)
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("o LLM respondeu com erro %d (%v)", statusErr.StatusCode, err)
+	default:
+		return err.Error()
 	}
 }
 
-// Read uma mensagem jsonrpc (linha-terminada)
-func (c *tcpConnection) Read(ctx context.Context) (jsonrpc.Message, error) {
-	line, err := c.r.ReadBytes('\n')
+// --------------------------------- main ---------------------------------
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "endereço do servidor MCP")
+	socket := flag.String("unix", "", "caminho do Unix socket do servidor, em vez de TCP")
+	// por omissão usa o endpoint de completions do LM Studio
+	stream := flag.Bool("stream", true, "mostra a resposta do LLM à medida que é gerada")
+	llmConfig := llm.Config{Provider: llm.ProviderCompletions, MaxTokens: 20}
+	llmConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	provider, err := llm.New(llmConfig)
 	if err != nil {
-		return nil, err
+		log.Fatalf("Erro LLM: %v", err)
 	}
-	return jsonrpc.DecodeMessage(line)
-}
 
-func (c *tcpConnection) Write(ctx context.Context, msg jsonrpc.Message) error {
-	b, err := jsonrpc.EncodeMessage(msg)
-	if err != nil {
-		return err
-	}
-	b = append(b, '\n')
-	_, err = c.conn.Write(b)
-	return err
-}
-
-func (c *tcpConnection) Close() error {
-	return c.conn.Close()
-}
-
-func (c *tcpConnection) SessionID() string {
-	return c.sessionID
-}
-
-// transport que o client.Connect espera
-type tcpTransport struct {
-	addr string
-	// nota: aqui mantemos apenas a conn usada para Connect; cada Connect pode criar uma nova connection
-	conn net.Conn
-}
-
-func newTCPTransport(addr string) *tcpTransport {
-	return &tcpTransport{addr: addr}
-}
-
-// Connect abre a conexão TCP e devolve um mcp.Connection (o wrapper tcpConnection)
-func (t *tcpTransport) Connect(ctx context.Context) (mcp.Connection, error) {
-	if t.conn == nil {
-		conn, err := net.Dial("tcp", t.addr)
-		if err != nil {
-			return nil, err
-		}
-		t.conn = conn
-	}
-	return newTCPConnection(t.conn), nil
-}
-
-// Close fecha (opcional para o transport em si)
-func (t *tcpTransport) Close() error {
-	if t.conn != nil {
-		return t.conn.Close()
-	}
-	return nil
-}
-
-// --------------------------------- main ---------------------------------
-func main() {
 	ctx := context.Background()
 
 	// cria o client MCP (Implementation config simples)
 	client := mcp.NewClient(&mcp.Implementation{Name: "tcp-client", Version: "v1.0.0"}, nil)
 
 	// transport para o servidor MCP (porta do servidor que tens a correr)
-	transport := newTCPTransport("127.0.0.1:9000")
+	transport := tcp.NewTransport(*addr)
+	if *socket != "" {
+		transport = unix.NewTransport(*socket)
+	}
 
 	// Connect -> devolve uma Session (e faz handshake/initialize internamente)
 	session, err := client.Connect(ctx, transport, nil)
@@ -203,11 +115,19 @@ func main() {
 		}
 
 		// chama LLM local para obter texto/nome
-		nameText := getNameFromLLM(prompt)
+		nameText, err := getNameFromLLM(ctx, provider, prompt, *stream)
+		if err != nil {
+			fmt.Println("Erro:", describeLLMError(err))
+			continue
+		}
 		// extrai nome simples (faz uma limpeza rápida)
 		name := strings.TrimSpace(strings.Split(nameText, "\n")[0])
 		name = strings.TrimPrefix(name, "Answer:")
 		name = strings.TrimSpace(name)
+		if name == "" {
+			fmt.Println("Erro:", errNoName)
+			continue
+		}
 
 		// Chama a tool 'greet' no servidor MCP via session.CallTool
 		params := &mcp.CallToolParams{
@@ -217,11 +137,11 @@ func main() {
 
 		res, err := session.CallTool(ctx, params)
 		if err != nil {
-			fmt.Println("CallTool error: %v", err)
+			fmt.Printf("CallTool error: %v\n", err)
 			continue
 		}
 		if res.IsError {
-			fmt.Println("Tool returned error: %+v", res.IsError)
+			fmt.Printf("Tool returned error: %+v\n", res.IsError)
 			continue
 		}
 
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp/llm"
+	"mcp/llm/llmtest"
+)
+
+// Os testes deste diretório correm com a lista de ficheiros, porque o server
+// também é um package main:
+//
+//	go test 4-say-hi-client-server-ia/client.go 4-say-hi-client-server-ia/client_test.go
+
+// newProvider devolve um provider de completions (o de omissão do client)
+// ligado a um LLM falso que responde com rules
+func newProvider(t *testing.T, rules ...llmtest.Rule) (llm.Provider, *llmtest.Handler) {
+	t.Helper()
+	h, err := llmtest.NewHandler(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	provider, err := llm.New(llm.Config{Provider: llm.ProviderCompletions, BaseURL: server.URL + "/v1", Model: "fake", MaxTokens: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, h
+}
+
+func TestGetNameFromLLM(t *testing.T) {
+	provider, h := newProvider(t, llmtest.Reply(`cumprimente (\pL+)`, " $1\n"))
+
+	for _, stream := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		name, err := getNameFromLLM(ctx, provider, "cumprimente João", stream)
+		cancel()
+		if err != nil || name != "João" {
+			t.Errorf("getNameFromLLM(stream=%t) = %q, %v, want João", stream, name, err)
+		}
+	}
+
+	requests := h.Requests()
+	if len(requests) != 2 || requests[0].Stream || !requests[1].Stream {
+		t.Fatalf("requests = %+v, want one plain and one streamed", requests)
+	}
+	if prompt := requests[0].Prompt; !strings.Contains(prompt, "Extract the name") || !strings.Contains(prompt, "cumprimente João") {
+		t.Errorf("prompt = %q", prompt)
+	}
+}
+
+func TestGetNameFromLLMErrors(t *testing.T) {
+	provider, _ := newProvider(t, llmtest.Reply(`ninguém`, "  "))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// uma resposta vazia não é um nome
+	if _, err := getNameFromLLM(ctx, provider, "cumprimente ninguém", false); !errors.Is(err, errNoName) {
+		t.Errorf("resposta vazia: err = %v, want %v", err, errNoName)
+	}
+
+	// o erro do LLM chega ao utilizador em vez de um nome inventado
+	_, err := getNameFromLLM(ctx, provider, "olá", false)
+	var statusErr *llm.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("sem rule: err = %v, want a 404", err)
+	}
+	if got := describeLLMError(err); !strings.Contains(got, "erro 404") {
+		t.Errorf("describeLLMError = %q", got)
+	}
+}
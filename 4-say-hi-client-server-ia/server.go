@@ -1,13 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
 )
 
 // --- Tool: SayHi ---
@@ -20,96 +26,68 @@ type Output struct {
 }
 
 func SayHi(ctx context.Context, req *mcp.CallToolRequest, input Input) (*mcp.CallToolResult, Output, error) {
-	return nil, Output{Greeting: "Hi " + input.Name}, nil
-}
-
-// --- TCPConnection wrapper ---
-func NewTCPConnection(conn net.Conn) *TCPConnection {
-	return &TCPConnection{conn: conn}
-}
-
-type TCPConnection struct {
-	conn      net.Conn
-	sessionID string
-}
-
-func (c *TCPConnection) Read(ctx context.Context) (jsonrpc.Message, error) {
-	reader := bufio.NewReader(c.conn)
-	line, err := reader.ReadBytes('\n')
-	if err != nil {
-		return nil, err
+	// Em Unix sockets sabemos que processo fez o pedido
+	if cred, err := unix.CredentialsFromSession(req.Session); err == nil {
+		log.Printf("greet pedido pelo pid %d (uid %d)", cred.PID, cred.UID)
 	}
-
-	// Decodifica diretamente a linha JSON em uma jsonrpc.Message
-	msg, err := jsonrpc.DecodeMessage(line)
-	if err != nil {
-		return nil, err
-	}
-
-	return msg, nil
-}
-
-func (c *TCPConnection) Write(ctx context.Context, msg jsonrpc.Message) error {
-	data, err := jsonrpc.EncodeMessage(msg)
-	if err != nil {
-		return err
-	}
-
-	// Adiciona o \n para garantir que a linha termine corretamente
-	data = append(data, '\n')
-
-	_, err = c.conn.Write(data)
-	return err
-}
-
-func (c *TCPConnection) Close() error {
-	return c.conn.Close()
-}
-
-func (c *TCPConnection) SessionID() string {
-	return c.sessionID
-}
-
-// --- TCPTransport wrapper ---
-type TCPTransport struct {
-	conn net.Conn
-}
-
-func NewTCPTransport(conn net.Conn) *TCPTransport {
-	return &TCPTransport{conn: conn}
-}
-
-func (t *TCPTransport) Connect(ctx context.Context) (mcp.Connection, error) {
-	return NewTCPConnection(t.conn), nil
+	return nil, Output{Greeting: "Hi " + input.Name}, nil
 }
 
 // --- Main ---
 func main() {
+	addr := flag.String("addr", ":9000", "endereço TCP do servidor")
+	socket := flag.String("unix", "", "caminho de um Unix socket a usar em vez de TCP")
+	maxConns := flag.Int("max-conns", 64, "número máximo de sessões em simultâneo (0 = sem limite)")
+	maxCalls := flag.Int("max-calls", 4, "tool calls em execução em simultâneo por sessão (0 = sem limite)")
+	queue := flag.Duration("queue", 5*time.Second, "tempo que uma ligação ou tool call espera por vaga antes de receber \"server busy\"")
+	flag.Parse()
+
 	// Cria o server MCP
 	server := mcp.NewServer(&mcp.Implementation{Name: "greeter", Version: "v1.0.0"}, nil)
 	mcp.AddTool(server, &mcp.Tool{Name: "greet", Description: "say hi"}, SayHi)
 
-	listener, err := net.Listen("tcp", ":9000")
+	var (
+		listener net.Listener
+		err      error
+	)
+	if *socket != "" {
+		listener, err = unix.Listen(*socket, 0600)
+	} else {
+		listener, err = net.Listen("tcp", *addr)
+	}
 	if err != nil {
-		log.Fatalf("Erro ao abrir TCP: %v", err)
+		log.Fatalf("Erro ao abrir listener: %v", err)
 	}
 	defer listener.Close()
 
-	log.Println("Servidor MCP TCP rodando na porta 9000...")
-
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			log.Printf("Erro ao aceitar conexão: %v", err)
-			continue
+	log.Printf("Servidor MCP rodando em %s...", listener.Addr())
+
+	// Limita ligações e tool calls para que um cliente barulhento não deixe
+	// os restantes à espera
+	srv := tcp.NewServer(server,
+		tcp.WithMaxConns(*maxConns),
+		tcp.WithMaxConcurrentCalls(*maxCalls),
+		tcp.WithQueueTimeout(*queue),
+	)
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			log.Fatalf("Erro MCP TCP: %v", err)
 		}
-
-		go func(c net.Conn) {
-			defer c.Close()
-			transport := NewTCPTransport(c)
-			if err := server.Run(context.Background(), transport); err != nil {
-				log.Printf("Erro MCP TCP: %v", err)
-			}
-		}(conn)
+	}()
+
+	// Espera por Ctrl+C / SIGTERM e encerra de forma graciosa: deixa de aceitar
+	// ligações, espera pelas tool calls em curso e só depois fecha as sessões
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	log.Println("A encerrar: a aguardar pelas tool calls em curso...")
+	drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	closed, err := srv.Shutdown(drainCtx)
+	if err != nil {
+		log.Printf("Tempo de drenagem esgotado: %v", err)
 	}
+	log.Printf("Servidor encerrado, %d sessões fechadas", closed)
 }
@@ -3,177 +3,251 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
-)
-
-type LLMRequest struct {
-	Model        string      `json:"model"`
-	Messages     MessageList `json:"messages"`
-	MaxNewTokens int         `json:"max_new_tokens"`
-	Temperature  float64     `json:"temperature"`
-}
-
-type MessageList []Message
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
 
-type LLMResponse struct {
-	Choices []struct {
-		Message struct {
-			Role      string        `json:"role"`
-			Content   string        `json:"content"`
-			ToolCalls []interface{} `json:"tool_calls"`
-		} `json:"message"`
-	} `json:"choices"`
-}
+	"mcp/cassette"
+	"mcp/llm"
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
+)
 
-// getNameFromLLM chama o client e devolve o texto (podes melhorar extração)
-func getNameFromLLM(prompt string) string {
-	reqBody := LLMRequest{
-		Model: "qwen/qwen3-vl-4b",
-		Messages: MessageList{
-			Message{
-				Role:    "system",
-				Content: "You are a strict parser. Return only the order number, nothing else!",
-			},
-			Message{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxNewTokens: 20,
-		Temperature:  0.0,
+// getLLMTools converte as tools do servidor MCP para o formato do LLM
+func getLLMTools(ctx context.Context, session *tcp.ReconnectingSession) ([]llm.Tool, error) {
+	res, err := session.ListTools(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var tools []llm.Tool
+	for _, t := range res.Tools {
+		tools = append(tools, llm.NewTool(t.Name, t.Description, t.InputSchema))
 	}
-	data, _ := json.Marshal(reqBody)
+	return tools, nil
+}
 
-	resp, err := http.Post("http://127.0.0.1:1234/v1/chat/completions", "application/json", bytes.NewReader(data))
-	if err != nil {
-		fmt.Println("Erro ao chamar LLM local: %v", err)
-		return "n/a"
+// runToolCall executa no servidor MCP uma tool pedida pelo modelo e devolve o
+// texto a enviar de volta como mensagem "tool" (os erros também voltam ao
+// modelo, para que os possa explicar ou tentar de novo)
+func runToolCall(ctx context.Context, session *tcp.ReconnectingSession, call llm.ToolCall) (string, error) {
+	var arguments map[string]any
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return "", fmt.Errorf("invalid arguments JSON: %w", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: call.Function.Name, Arguments: arguments})
 	if err != nil {
-		fmt.Println("Erro a ler resposta LLM: %v", err)
-		return "n/a"
+		return "", err
 	}
 
-	var llmResp LLMResponse
-	if err = json.Unmarshal(body, &llmResp); err != nil {
-		// tenta fallback para texto cru
-		txt := strings.TrimSpace(string(body))
-		if txt == "" {
-			return "n/a"
+	text := ""
+	for _, c := range res.Content {
+		if tc, ok := c.(*mcp.TextContent); ok {
+			text += tc.Text
 		}
-		return txt
 	}
-
-	if len(llmResp.Choices) == 0 {
-		return "n/a"
+	if res.IsError {
+		return "", errors.New(text)
 	}
-	// retorna o texto inteiro da escolha 0 - podes refinar com regex se quiseres só o nome
-	return strings.TrimSpace(llmResp.Choices[0].Message.Content)
-}
-
-type tcpConnection struct {
-	conn      net.Conn
-	sessionID string
-	r         *bufio.Reader
+	return text, nil
 }
 
-func newTCPConnection(c net.Conn) *tcpConnection {
-	return &tcpConnection{
-		conn:      c,
-		sessionID: "session-" + c.RemoteAddr().String(),
-		r:         bufio.NewReader(c),
+// printStep mostra um passo do agente à medida que acontece
+func printStep(step llm.Step) {
+	switch {
+	case step.Kind == llm.StepTool && step.Error != "":
+		fmt.Printf("  [%d] tool %s(%s) -> erro: %s\n", step.Iteration, step.ToolCall.Function.Name, step.ToolCall.Function.Arguments, step.Error)
+	case step.Kind == llm.StepTool:
+		fmt.Printf("  [%d] tool %s(%s) -> %s\n", step.Iteration, step.ToolCall.Function.Name, step.ToolCall.Function.Arguments, step.Result)
+	case step.Error != "":
+		fmt.Printf("  [%d] modelo -> erro: %s\n", step.Iteration, step.Error)
+	case step.ToolCalls > 0:
+		fmt.Printf("  [%d] modelo pediu %d tool call(s) (%d ms%s)\n", step.Iteration, step.ToolCalls, step.DurationMs, formatUsage(step.Usage))
+	default:
+		fmt.Printf("  [%d] modelo respondeu (%d ms%s)\n", step.Iteration, step.DurationMs, formatUsage(step.Usage))
 	}
 }
 
-// Read uma mensagem jsonrpc (linha-terminada)
-func (c *tcpConnection) Read(ctx context.Context) (jsonrpc.Message, error) {
-	line, err := c.r.ReadBytes('\n')
-	if err != nil {
-		return nil, err
+// formatUsage mostra os tokens de uma chamada ao LLM; "~" quando o servidor
+// não os indicou e foram estimados
+func formatUsage(u *llm.Usage) string {
+	if u == nil {
+		return ""
 	}
-	return jsonrpc.DecodeMessage(line)
-}
-
-func (c *tcpConnection) Write(ctx context.Context, msg jsonrpc.Message) error {
-	b, err := jsonrpc.EncodeMessage(msg)
-	if err != nil {
-		return err
+	approx := ""
+	if u.Estimated {
+		approx = "~"
 	}
-	b = append(b, '\n')
-	_, err = c.conn.Write(b)
-	return err
+	return fmt.Sprintf(", %s%d+%d tokens", approx, u.PromptTokens, u.CompletionTokens)
 }
 
-func (c *tcpConnection) Close() error {
-	return c.conn.Close()
+// streamPrinter escreve no terminal a resposta do LLM à medida que é gerada,
+// incluindo as tool calls que o modelo vai pedindo
+type streamPrinter struct {
+	mode string // "text", "tool" ou "" quando a linha atual está fechada
 }
 
-func (c *tcpConnection) SessionID() string {
-	return c.sessionID
+func (p *streamPrinter) delta(d llm.Delta) {
+	if tc := d.ToolCall; tc != nil {
+		if tc.Name != "" {
+			p.end()
+			fmt.Printf("  [tool call] %s ", tc.Name)
+			p.mode = "tool"
+		}
+		fmt.Print(tc.Arguments)
+		return
+	}
+	if p.mode != "text" {
+		p.end()
+		fmt.Print("LLM: ")
+		p.mode = "text"
+	}
+	fmt.Print(d.Content)
 }
 
-// transport que o client.Connect espera
-type tcpTransport struct {
-	addr string
-	// nota: aqui mantemos apenas a conn usada para Connect; cada Connect pode criar uma nova connection
-	conn net.Conn
+// end fecha a linha que estava a ser escrita
+func (p *streamPrinter) end() {
+	if p.mode != "" {
+		fmt.Println()
+		p.mode = ""
+	}
 }
 
-func newTCPTransport(addr string) *tcpTransport {
-	return &tcpTransport{addr: addr}
+// step mostra os passos do agente que o streaming não mostrou: erros do
+// modelo e resultados das tools
+func (p *streamPrinter) step(step llm.Step) {
+	p.end()
+	if step.Kind == llm.StepTool || step.Error != "" {
+		printStep(step)
+	}
 }
 
-// Connect abre a conexão TCP e devolve um mcp.Connection (o wrapper tcpConnection)
-func (t *tcpTransport) Connect(ctx context.Context) (mcp.Connection, error) {
-	if t.conn == nil {
-		conn, err := net.Dial("tcp", t.addr)
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "endereço do servidor MCP")
+	socket := flag.String("unix", "", "caminho do Unix socket do servidor, em vez de TCP")
+	httpURL := flag.String("http", "", "URL streamable HTTP do servidor (ex: http://127.0.0.1:8082/mcp), em vez de TCP")
+	caFile := flag.String("tls-ca", "", "CA do servidor (PEM); ativa TLS")
+	certFile := flag.String("tls-cert", "", "certificado de cliente para mutual TLS (PEM)")
+	keyFile := flag.String("tls-key", "", "chave privada do certificado de cliente (PEM)")
+	compress := flag.String("compress", "", "compressões aceites, separadas por vírgula, por ordem de preferência (gzip, flate)")
+	maxSteps := flag.Int("max-steps", llm.DefaultMaxIterations, "número máximo de chamadas ao LLM por pergunta")
+	stream := flag.Bool("stream", true, "mostra a resposta do LLM à medida que é gerada")
+	timeout := flag.Duration("timeout", 2*time.Minute, "tempo máximo por pergunta, incluindo as tentativas de voltar a ligar ao servidor (0 = sem limite)")
+	cassettePath := flag.String("cassette", "", "ficheiro onde gravar (ou de onde repetir) os pedidos ao LLM e ao servidor MCP")
+	cassetteMode := flag.String("cassette-mode", "replay", "record (grava), replay (repete sem LLM nem servidor) ou compare (compara o tráfego real com a gravação)")
+	llmConfig := llm.Config{Provider: llm.ProviderOpenAI}
+	llmConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Com -cassette o tráfego passa pela gravação: no fim (Ctrl+D ou Ctrl+C)
+	// o ficheiro é escrito ou são mostradas as diferenças para a gravação,
+	// por exemplo um idOrder diferente depois de mudar de modelo
+	var cas *cassette.Cassette
+	if *cassettePath != "" {
+		mode, err := cassette.ParseMode(*cassetteMode)
 		if err != nil {
-			return nil, err
+			log.Fatalf("Erro: %v", err)
 		}
-		t.conn = conn
+		cas, err = cassette.Open(*cassettePath, mode)
+		if err != nil {
+			log.Fatalf("Erro ao abrir cassette: %v", err)
+		}
+		llmConfig.HTTPClient = cas.HTTPClient(llmConfig.HTTPClient)
 	}
-	return newTCPConnection(t.conn), nil
-}
-
-// Close fecha (opcional para o transport em si)
-func (t *tcpTransport) Close() error {
-	if t.conn != nil {
-		return t.conn.Close()
+	finish := func() {
+		if cas == nil {
+			return
+		}
+		if err := cas.Close(); err != nil {
+			log.Printf("Erro ao gravar cassette: %v", err)
+		}
+		cas.Report(os.Stdout)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println()
+		finish()
+		os.Exit(1)
+	}()
+
+	// o provider do LLM (LM Studio, Ollama, ...) vem das flags -llm-*
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		log.Fatalf("Erro LLM: %v", err)
 	}
-	return nil
-}
 
-func main() {
 	ctx := context.Background()
 
+	var opts []tcp.Option
+	if *caFile != "" {
+		tlsConfig, err := tcp.ClientTLSConfig(*caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("Erro ao carregar TLS: %v", err)
+		}
+		opts = append(opts, tcp.WithTLS(tlsConfig))
+	}
+
+	// Compressão opcional, negociada ao ligar (útil para documentos grandes
+	// como os devolvidos por getOrder)
+	if *compress != "" {
+		var modes []tcp.Compression
+		for _, name := range strings.Split(*compress, ",") {
+			mode, err := tcp.ParseCompression(name)
+			if err != nil {
+				log.Fatalf("Erro: %v", err)
+			}
+			modes = append(modes, mode)
+		}
+		opts = append(opts, tcp.WithCompression(modes...))
+	}
+
 	// cria o client MCP (Implementation config simples)
 	client := mcp.NewClient(&mcp.Implementation{Name: "tcp-client", Version: "v1.0.0"}, nil)
 
 	// transport para o servidor MCP (porta do servidor que tens a correr)
-	transport := newTCPTransport("127.0.0.1:9000")
+	var transport mcp.Transport = tcp.NewTransport(*addr, opts...)
+	if *socket != "" {
+		transport = unix.NewTransport(*socket, opts...)
+	}
+	if *httpURL != "" {
+		transport = &mcp.StreamableClientTransport{Endpoint: *httpURL}
+	}
+	if cas != nil {
+		// em replay o servidor MCP não é contactado
+		transport = cas.Transport(transport)
+	}
 
-	// Connect -> devolve uma Session (e faz handshake/initialize internamente)
-	session, err := client.Connect(ctx, transport, nil)
+	// Connect -> devolve uma Session que volta a ligar (e a refazer o
+	// handshake/initialize) sempre que a ligação ao servidor cai; as novas
+	// tentativas não têm limite, quem as limita é o -timeout
+	connectCtx, cancel := withTimeout(ctx, *timeout)
+	session, err := tcp.NewReconnectingSession(connectCtx, client, transport, &tcp.ReconnectOptions{
+		// as duas tools só consultam encomendas, podem ser repetidas
+		Idempotent: func(tool string) bool { return tool == "orderStatus" || tool == "getOrder" },
+		OnStatus: func(status tcp.Status, err error) {
+			if err != nil {
+				fmt.Printf("\n[ligação MCP: %s: %v]\n", status, err)
+				return
+			}
+			fmt.Printf("\n[ligação MCP: %s]\n", status)
+		},
+	})
+	cancel()
 	if err != nil {
 		log.Fatalf("Erro client.Connect: %v", err)
 	}
@@ -186,40 +260,75 @@ func main() {
 
 	for {
 		fmt.Print("> ")
-		prompt, _ := reader.ReadString('\n')
+		prompt, err := reader.ReadString('\n')
+		if err == io.EOF && prompt == "" {
+			fmt.Println()
+			finish()
+			return
+		}
 		prompt = strings.TrimSpace(prompt)
 		if prompt == "" {
 			continue
 		}
 
-		// chama LLM local para obter texto/nome
-		nameText := getNameFromLLM(prompt)
-		// extrai nome simples (faz uma limpeza rápida)
-		name := strings.TrimSpace(strings.Split(nameText, "\n")[0])
-		name = strings.TrimPrefix(name, "Answer:")
-		name = strings.TrimSpace(name)
-
-		// Chama a tool 'orderStatus' no servidor MCP via session.CallTool
-		params := &mcp.CallToolParams{
-			Name:      "orderStatus",
-			Arguments: map[string]any{"idOrder": name},
+		// com o servidor em baixo a pergunta desiste ao fim do -timeout, em
+		// vez de deixar o REPL à espera para sempre
+		if err := ask(ctx, *timeout, func(ctx context.Context) error {
+			return answer(ctx, provider, session, prompt, *maxSteps, *stream)
+		}); err != nil {
+			fmt.Println(err)
 		}
+	}
+}
 
-		res, err := session.CallTool(ctx, params)
-		if err != nil {
-			fmt.Println("CallTool error: %v", err)
-			continue
-		}
-		if res.IsError {
-			fmt.Println("Tool returned error: %+v", res.IsError)
-			continue
-		}
+// withTimeout é context.WithTimeout, sem limite quando timeout é 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-		// imprime o conteúdo textual (se houver)
-		for _, c := range res.Content {
-			if tc, ok := c.(*mcp.TextContent); ok {
-				fmt.Println("Resposta MCP:", tc.Text)
-			}
-		}
+// ask corre uma pergunta com o tempo máximo de -timeout.
+func ask(ctx context.Context, timeout time.Duration, run func(context.Context) error) error {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	err := run(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w (pergunta sem resposta ao fim de %s)", err, timeout)
+	}
+	return err
+}
+
+// answer responde a um prompt: o agente chama o LLM, executa as tools que ele
+// pedir (orderStatus, getOrder) e devolve-lhe os resultados até ter uma
+// resposta final.
+func answer(ctx context.Context, provider llm.Provider, session *tcp.ReconnectingSession, prompt string, maxSteps int, stream bool) error {
+	tools, err := getLLMTools(ctx, session)
+	if err != nil {
+		return fmt.Errorf("Erro ao listar tools: %w", err)
+	}
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "You answer questions about orders. Use the available tools to look orders up, then answer in natural language."},
+		{Role: llm.RoleUser, Content: prompt},
+	}
+	callTool := func(ctx context.Context, call llm.ToolCall) (string, error) {
+		return runToolCall(ctx, session, call)
+	}
+	chat, agentOpts := provider.Chat, &llm.AgentOptions{MaxIterations: maxSteps, OnStep: printStep}
+	if stream {
+		printer := &streamPrinter{}
+		chat, agentOpts.OnStep = llm.StreamFunc(provider, printer.delta), printer.step
 	}
+	result, err := llm.RunAgent(ctx, chat, tools, callTool, messages, agentOpts)
+	if err != nil {
+		return fmt.Errorf("Erro LLM: %w", err)
+	}
+
+	// com streaming a resposta já foi escrita
+	if !stream {
+		fmt.Println("Resposta:", strings.TrimSpace(result.Answer))
+	}
+	return nil
 }
@@ -1,13 +1,24 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
+	"mcp/transport/websocket"
 )
 
 type CheckOrderStatusInput struct {
@@ -18,7 +29,18 @@ type CheckOrderStatusOutput struct {
 	Status string `json:"status"`
 }
 
+// allowedClients são os common names dos certificados de cliente autorizados a
+// consultar o estado das encomendas (vazio = todos)
+var allowedClients = map[string]bool{}
+
 func CheckOrderStatus(ctx context.Context, req *mcp.CallToolRequest, input CheckOrderStatusInput) (*mcp.CallToolResult, CheckOrderStatusOutput, error) {
+	if len(allowedClients) > 0 {
+		caller := tcp.PeerFromSession(req.Session).CommonName()
+		if !allowedClients[caller] {
+			return nil, CheckOrderStatusOutput{}, fmt.Errorf("client %q is not allowed to check order status", caller)
+		}
+	}
+
 	fmt.Printf("calling the method for getting the order %s status", input.IdOrder)
 	status := "new-" + input.IdOrder
 	return nil, CheckOrderStatusOutput{Status: status}, nil
@@ -37,94 +59,204 @@ func GetOrder(ctx context.Context, req *mcp.CallToolRequest, input GetOrderInput
 	return nil, GetOrderOutput{Order: fmt.Sprintf("order %s", input.IdOrder)}, nil
 }
 
-// --- TCPConnection wrapper ---
-func NewTCPConnection(conn net.Conn) *TCPConnection {
-	return &TCPConnection{conn: conn}
+// newOrderServer cria o server MCP com as tools das encomendas
+func newOrderServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "order", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "orderStatus", Description: "check the order status by id"}, CheckOrderStatus)
+	mcp.AddTool(server, &mcp.Tool{Name: "getOrder", Description: "get the order by id"}, GetOrder)
+	return server
 }
 
-type TCPConnection struct {
-	conn      net.Conn
-	sessionID string
+// newHTTPHandler serve o server em /mcp com o transporte streamable HTTP (POST
+// + stream SSE, header Mcp-Session-Id), o transporte standard que os hosts
+// MCP sabem usar
+func newHTTPHandler(server *mcp.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	return mux
 }
 
-func (c *TCPConnection) Read(ctx context.Context) (jsonrpc.Message, error) {
-	reader := bufio.NewReader(c.conn)
-	line, err := reader.ReadBytes('\n')
-	if err != nil {
-		return nil, err
-	}
+// transportNames são os valores aceites por -transport
+var transportNames = []string{"tcp", "ws", "http"}
 
-	// Decodifica diretamente a linha JSON em uma jsonrpc.Message
-	msg, err := jsonrpc.DecodeMessage(line)
-	if err != nil {
-		return nil, err
+// parseTransports lê a lista de -transport
+func parseTransports(list string) (map[string]bool, error) {
+	selected := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(transportNames, name) {
+			return nil, fmt.Errorf("transporte desconhecido %q (aceites: %s)", name, strings.Join(transportNames, ", "))
+		}
+		selected[name] = true
 	}
-
-	return msg, nil
+	if len(selected) == 0 {
+		return nil, errors.New("nenhum transporte em -transport")
+	}
+	return selected, nil
 }
 
-func (c *TCPConnection) Write(ctx context.Context, msg jsonrpc.Message) error {
-	data, err := jsonrpc.EncodeMessage(msg)
+// --- Main ---
+func main() {
+	transports := flag.String("transport", "tcp", "transportes a servir, separados por vírgula: tcp (ou Unix socket com -unix), ws (WebSocket) e http (streamable HTTP)")
+	addr := flag.String("addr", ":9000", "endereço TCP do servidor")
+	socket := flag.String("unix", "", "caminho de um Unix socket a usar em vez de TCP")
+	wsAddr := flag.String("ws", ":8081", "endereço HTTP do transporte ws, servido em /mcp")
+	wsOrigins := flag.String("ws-origin", "", "origens de outras páginas autorizadas a abrir o WebSocket, separadas por vírgula (ex: http://localhost:8080 para a UI do exemplo 6)")
+	httpAddr := flag.String("http", ":8082", "endereço HTTP do transporte http, servido em /mcp (a :8080 é a da UI do exemplo 6)")
+	certFile := flag.String("tls-cert", "", "certificado TLS do servidor (PEM)")
+	keyFile := flag.String("tls-key", "", "chave privada TLS do servidor (PEM)")
+	clientCAFile := flag.String("client-ca", "", "CA dos certificados de cliente; ativa mutual TLS")
+	allow := flag.String("allow", "", "common names autorizados a usar orderStatus, separados por vírgula")
+	maxConns := flag.Int("max-conns", 64, "número máximo de sessões em simultâneo (0 = sem limite)")
+	maxCalls := flag.Int("max-calls", 4, "tool calls em execução em simultâneo por sessão (0 = sem limite)")
+	queue := flag.Duration("queue", 5*time.Second, "tempo que uma ligação ou tool call espera por vaga antes de receber \"server busy\"")
+	compress := flag.String("compress", "", "compressões aceites, separadas por vírgula, por ordem de preferência (gzip, flate)")
+	flag.Parse()
+
+	serve, err := parseTransports(*transports)
 	if err != nil {
-		return err
+		fmt.Printf("Erro: %v\n", err)
+		return
 	}
 
-	// Adiciona o \n para garantir que a linha termine corretamente
-	data = append(data, '\n')
-
-	_, err = c.conn.Write(data)
-	return err
-}
-
-func (c *TCPConnection) Close() error {
-	return c.conn.Close()
-}
-
-func (c *TCPConnection) SessionID() string {
-	return c.sessionID
-}
+	for _, name := range strings.Split(*allow, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allowedClients[name] = true
+		}
+	}
 
-// --- TCPTransport wrapper ---
-type TCPTransport struct {
-	conn net.Conn
-}
+	// Limites por ligação: nenhum cliente pode esgotar a memória com uma linha
+	// enorme nem prender o servidor enviando (ou lendo) um byte de cada vez
+	opts := []tcp.Option{
+		tcp.WithMaxFrameSize(1 << 20),
+		tcp.WithReadTimeout(30 * time.Second),
+		tcp.WithWriteTimeout(10 * time.Second),
+		// ... e nenhum cliente barulhento pode deixar os restantes à espera
+		tcp.WithMaxConns(*maxConns),
+		tcp.WithMaxConcurrentCalls(*maxCalls),
+		tcp.WithQueueTimeout(*queue),
+	}
+	if *certFile != "" {
+		tlsConfig, err := tcp.ServerTLSConfig(*certFile, *keyFile, *clientCAFile)
+		if err != nil {
+			fmt.Printf("Erro ao carregar TLS: %v", err)
+			return
+		}
+		opts = append(opts, tcp.WithTLS(tlsConfig))
+	}
 
-func NewTCPTransport(conn net.Conn) *TCPTransport {
-	return &TCPTransport{conn: conn}
-}
+	// Compressão opcional, negociada ao ligar (útil para documentos grandes
+	// como os devolvidos por getOrder)
+	if *compress != "" {
+		var modes []tcp.Compression
+		for _, name := range strings.Split(*compress, ",") {
+			mode, err := tcp.ParseCompression(name)
+			if err != nil {
+				fmt.Printf("Erro: %v\n", err)
+				return
+			}
+			modes = append(modes, mode)
+		}
+		opts = append(opts, tcp.WithCompression(modes...))
+	}
 
-func (t *TCPTransport) Connect(ctx context.Context) (mcp.Connection, error) {
-	return NewTCPConnection(t.conn), nil
-}
+	// Cria o server MCP, o mesmo para todos os transportes
+	server := newOrderServer()
 
-// --- Main ---
-func main() {
-	// Cria o server MCP
-	server := mcp.NewServer(&mcp.Implementation{Name: "order", Version: "v1.0.0"}, nil)
-	mcp.AddTool(server, &mcp.Tool{Name: "orderStatus", Description: "check the order status by id"}, CheckOrderStatus)
-	mcp.AddTool(server, &mcp.Tool{Name: "getOrder", Description: "get the order by id"}, GetOrder)
+	// Servidores HTTP, guardados para serem também encerrados no fim
+	var httpServers []*http.Server
 
-	listener, err := net.Listen("tcp", ":9000")
-	if err != nil {
-		fmt.Printf("Erro ao abrir TCP: %v", err)
+	// WebSocket (browsers e proxies HTTP); as sessões WebSocket não são
+	// fechadas pelo http.Server, por isso o handler é guardado para ser
+	// encerrado à parte
+	var wsHandler *websocket.Handler
+	if serve["ws"] {
+		var origins []string
+		for _, origin := range strings.Split(*wsOrigins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+		wsHandler = websocket.NewHandler(func(*http.Request) *mcp.Server { return server }, &websocket.HandlerOptions{AllowedOrigins: origins})
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", wsHandler)
+		httpServer := &http.Server{Addr: *wsAddr, Handler: mux}
+		httpServers = append(httpServers, httpServer)
+		go func() {
+			fmt.Printf("Servidor MCP WebSocket rodando em ws://%s/mcp...\n", *wsAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("Erro MCP WebSocket: %v", err)
+			}
+		}()
 	}
-	defer listener.Close()
 
-	fmt.Println("Servidor MCP TCP rodando na porta 9000...")
+	// Streamable HTTP
+	if serve["http"] {
+		httpServer := &http.Server{Addr: *httpAddr, Handler: newHTTPHandler(server)}
+		httpServers = append(httpServers, httpServer)
+		go func() {
+			fmt.Printf("Servidor MCP streamable HTTP rodando em http://%s/mcp...\n", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("Erro MCP HTTP: %v", err)
+			}
+		}()
+	}
 
-	for {
-		conn, err := listener.Accept()
+	// TCP (ou Unix socket), o protocolo próprio dos clientes destes exemplos
+	var srv *tcp.Server
+	if serve["tcp"] {
+		var listener net.Listener
+		if *socket != "" {
+			listener, err = unix.Listen(*socket, 0600)
+		} else {
+			listener, err = net.Listen("tcp", *addr)
+		}
 		if err != nil {
-			fmt.Printf("Erro ao aceitar conexão: %v", err)
-			continue
+			fmt.Printf("Erro ao abrir listener: %v", err)
+			return
 		}
+		defer listener.Close()
+
+		fmt.Printf("Servidor MCP rodando em %s (tls=%t)...\n", listener.Addr(), *certFile != "")
 
-		go func(c net.Conn) {
-			defer c.Close()
-			transport := NewTCPTransport(c)
-			if err := server.Run(context.Background(), transport); err != nil {
+		srv = tcp.NewServer(server, opts...)
+		go func() {
+			if err := srv.Serve(listener); err != nil {
 				fmt.Printf("Erro MCP TCP: %v", err)
 			}
-		}(conn)
+		}()
+	}
+
+	// Espera por Ctrl+C / SIGTERM e encerra de forma graciosa: deixa de aceitar
+	// ligações, espera pelas tool calls em curso e só depois fecha as sessões
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	fmt.Println("A encerrar: a aguardar pelas tool calls em curso...")
+	drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(drainCtx); err != nil {
+			fmt.Printf("Erro ao encerrar %s: %v\n", httpServer.Addr, err)
+		}
+	}
+	if wsHandler != nil {
+		if err := wsHandler.Shutdown(drainCtx); err != nil {
+			fmt.Printf("Erro ao encerrar as sessões WebSocket: %v\n", err)
+		}
+	}
+	if srv != nil {
+		closed, err := srv.Shutdown(drainCtx)
+		if err != nil {
+			fmt.Printf("Tempo de drenagem esgotado: %v\n", err)
+		}
+		fmt.Printf("Servidor encerrado, %d sessões TCP fechadas\n", closed)
+		return
 	}
+	fmt.Println("Servidor encerrado")
 }
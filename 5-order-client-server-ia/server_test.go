@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Os testes deste diretório correm com a lista de ficheiros, porque o client
+// também é um package main:
+//
+//	go test 5-order-client-server-ia/server.go 5-order-client-server-ia/server_test.go
+
+func TestStreamableHTTP(t *testing.T) {
+	httpServer := httptest.NewServer(newHTTPHandler(newOrderServer()))
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: httpServer.URL + "/mcp"}, nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer session.Close()
+
+	if session.ID() == "" {
+		t.Error("session without the Mcp-Session-Id given by the server")
+	}
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "getOrder,orderStatus" {
+		t.Fatalf("tools = %s, want getOrder,orderStatus", got)
+	}
+
+	tests := []struct {
+		tool, want string
+	}{
+		{"orderStatus", `{"status":"new-42"}`},
+		{"getOrder", `{"order":"order 42"}`},
+	}
+	for _, tt := range tests {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tt.tool, Arguments: map[string]any{"idOrder": "42"}})
+		if err != nil {
+			t.Fatalf("CallTool(%s): %v", tt.tool, err)
+		}
+		if res.IsError || len(res.Content) == 0 {
+			t.Fatalf("CallTool(%s) = %+v", tt.tool, res)
+		}
+		if got := res.Content[0].(*mcp.TextContent).Text; got != tt.want {
+			t.Errorf("CallTool(%s) = %s, want %s", tt.tool, got, tt.want)
+		}
+	}
+}
+
+// Um host MCP que não usa o SDK: initialize por POST devolve o header
+// Mcp-Session-Id, que tem de acompanhar os pedidos seguintes.
+func TestStreamableHTTPSessionHeader(t *testing.T) {
+	httpServer := httptest.NewServer(newHTTPHandler(newOrderServer()))
+	defer httpServer.Close()
+
+	post := func(sessionID, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/mcp", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"host","version":"v1"}}}`)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("initialize: status %d, Mcp-Session-Id %q", resp.StatusCode, sessionID)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") && !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("initialize: Content-Type %q", ct)
+	}
+
+	post(sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized","params":{}}`)
+	resp = post(sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}`)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"orderStatus"`) {
+		t.Errorf("tools/list: status %d, body %s", resp.StatusCode, body)
+	}
+	if resp := post("unknown", `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("tools/list with an unknown Mcp-Session-Id: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestParseTransports(t *testing.T) {
+	got, err := parseTransports(" tcp, HTTP ,,ws")
+	if err != nil || !got["tcp"] || !got["http"] || !got["ws"] || len(got) != 3 {
+		t.Errorf("parseTransports = %v, %v", got, err)
+	}
+	for _, list := range []string{"", "udp", "tcp,grpc"} {
+		if _, err := parseTransports(list); err == nil {
+			t.Errorf("parseTransports(%q) succeeded, want an error", list)
+		}
+	}
+}
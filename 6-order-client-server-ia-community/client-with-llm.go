@@ -2,83 +2,51 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
-)
-
-type LLMRequest struct {
-	Model        string      `json:"model"`
-	Messages     MessageList `json:"messages"`
-	MaxNewTokens int         `json:"max_new_tokens"`
-	Temperature  float64     `json:"temperature"`
-	N            int         `json:"n"`
-}
-
-type MessageList []Message
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type LLMResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
+	"mcp/llm"
+)
 
-// calculateParsePromptWithLLM envia o prompt para a LLM e retorna operation, x, y
-func calculateParsePromptWithLLM(prompt string) (operation string, x, y float64, err error) {
-	reqBody := LLMRequest{
-		Model: "qwen/qwen3-vl-4b",
-		Messages: MessageList{
-			{
-				Role:    "system",
-				Content: "You are a strict parser. Return JSON filling the following with {operation, x, y} only!",
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
+// calculateParsePromptWithLLM envia o prompt para a LLM e retorna operation, x, y.
+// A resposta tem de respeitar o schema (o InputSchema da tool "calculate"):
+// se não respeitar, a LLM recebe o erro e tenta de novo. Com stream, a
+// resposta vai sendo escrita à medida que a LLM a gera.
+func calculateParsePromptWithLLM(ctx context.Context, provider llm.Provider, schema any, prompt string, stream bool) (operation string, x, y float64, err error) {
+	messages := []llm.Message{
+		{
+			Role:    llm.RoleSystem,
+			Content: "You are a strict parser. Return JSON filling the following with {operation, x, y} only!",
+		},
+		{
+			Role:    llm.RoleUser,
+			Content: prompt,
 		},
-		MaxNewTokens: 20,
-		Temperature:  0.0,
-		N:            1,
 	}
-	data, _ := json.Marshal(reqBody)
 
-	resp, err := http.Post("http://127.0.0.1:1234/v1/chat/completions", "application/json", bytes.NewReader(data))
-	if err != nil {
-		return "", 0, 0, err
-	}
-	defer resp.Body.Close()
+	fmt.Println("LLM prompt:", prompt)
 
-	body, _ := io.ReadAll(resp.Body)
-	var llmResp LLMResponse
-	if err = json.Unmarshal(body, &llmResp); err != nil {
-		return "", 0, 0, err
+	opts := &llm.ExtractOptions{
+		OnRetry: func(attempt int, err error) {
+			fmt.Printf("LLM reply %d rejected: %v\n", attempt, err)
+		},
 	}
-
-	if len(llmResp.Choices) == 0 {
-		return "", 0, 0, fmt.Errorf("no choices returned from LLM")
+	if stream {
+		fmt.Print("LLM choices: ")
+		opts.OnDelta = func(d llm.Delta) { fmt.Print(d.Content) }
+		opts.OnRetry = func(attempt int, err error) {
+			fmt.Printf("\nLLM reply %d rejected: %v\nLLM choices: ", attempt, err)
+		}
 	}
 
-	fmt.Println("LLM prompt:", prompt)
-	fmt.Println("LLM choices:", llmResp.Choices[0].Message.Content)
-
 	// Esperamos que o LLM retorne JSON: {"operation":"multiply","x":6,"y":7}
 	var params struct {
 		Operation string  `json:"operation"`
@@ -86,14 +54,28 @@ func calculateParsePromptWithLLM(prompt string) (operation string, x, y float64,
 		Y         float64 `json:"y"`
 	}
 
-	if err = json.Unmarshal([]byte(llmResp.Choices[0].Message.Content), &params); err != nil {
-		return "", 0, 0, fmt.Errorf("invalid JSON from LLM: %v", err)
+	err = llm.Extract(ctx, provider, messages, schema, &params, opts)
+	if stream {
+		fmt.Println()
+	}
+	if err != nil {
+		return "", 0, 0, err
 	}
 
 	return params.Operation, params.X, params.Y, nil
 }
 
 func main() {
+	stream := flag.Bool("stream", true, "mostra a resposta da LLM à medida que é gerada")
+	llmConfig := llm.Config{Provider: llm.ProviderOpenAI}
+	llmConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		log.Fatalf("Error creating LLM provider: %v", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -141,8 +123,18 @@ func main() {
 		log.Fatalf("Error listing tools: %v", err)
 	}
 	fmt.Println("Available tools:")
+	var calculateSchema any
 	for _, t := range toolsRes.Tools {
 		fmt.Printf("- %s: %s\n", t.Name, t.Description)
+		if t.Name == "calculate" {
+			calculateSchema = t.InputSchema
+			if len(t.RawInputSchema) > 0 {
+				calculateSchema = t.RawInputSchema
+			}
+		}
+	}
+	if calculateSchema == nil {
+		log.Fatalf("Tool calculate not found")
 	}
 
 	// Loop de prompts
@@ -156,7 +148,9 @@ func main() {
 		}
 
 		// Chama a LLM para parse do prompt
-		op, x, y, err := calculateParsePromptWithLLM(prompt)
+		llmCtx, llmCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		op, x, y, err := calculateParsePromptWithLLM(llmCtx, provider, calculateSchema, prompt, *stream)
+		llmCancel()
 		fmt.Println("LLM parsed: operation:", op, "x:", x, "y:", y)
 		if err != nil {
 			fmt.Println("LLM parse error:", err)
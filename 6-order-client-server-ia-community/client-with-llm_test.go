@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"mcp/llm"
+	"mcp/llm/llmtest"
+)
+
+// Os testes deste diretório correm com a lista de ficheiros, porque o client
+// e o server também são package main:
+//
+//	go test 6-order-client-server-ia-community/client-with-llm.go 6-order-client-server-ia-community/client-with-llm_test.go
+
+// calculateSchema é o InputSchema da tool calculate do server.go
+func calculateSchema() any {
+	return mcp.NewTool("calculate",
+		mcp.WithString("operation", mcp.Required(), mcp.Enum("add", "subtract", "multiply", "divide")),
+		mcp.WithNumber("x", mcp.Required()),
+		mcp.WithNumber("y", mcp.Required()),
+	).InputSchema
+}
+
+func newProvider(t *testing.T, rules ...llmtest.Rule) (llm.Provider, *llmtest.Handler) {
+	t.Helper()
+	h, err := llmtest.NewHandler(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	provider, err := llm.New(llm.Config{Provider: llm.ProviderOpenAI, BaseURL: server.URL + "/v1", Model: "fake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, h
+}
+
+func TestCalculateParsePromptWithLLM(t *testing.T) {
+	provider, h := newProvider(t, llmtest.Reply(`^Multiply (\d+) by (\d+)$`, `{"operation": "multiply", "x": $1, "y": $2}`))
+
+	for _, stream := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		op, x, y, err := calculateParsePromptWithLLM(ctx, provider, calculateSchema(), "Multiply 6 by 7", stream)
+		cancel()
+		if err != nil || op != "multiply" || x != 6 || y != 7 {
+			t.Errorf("calculateParsePromptWithLLM(stream=%t) = %s, %v, %v, %v, want multiply, 6, 7", stream, op, x, y, err)
+		}
+	}
+
+	// o schema da tool vai no response_format
+	for _, req := range h.Requests() {
+		if !strings.Contains(string(req.Schema), `"multiply"`) {
+			t.Errorf("request without the calculate schema: %+v", req)
+		}
+	}
+}
+
+// Uma resposta fora do schema volta ao LLM com o erro, e a seguinte serve.
+func TestCalculateParsePromptWithLLMRetries(t *testing.T) {
+	provider, h := newProvider(t,
+		llmtest.Reply(`^Raise (\d+) to (\d+)$`, `{"operation": "power", "x": $1, "y": $2}`),
+		llmtest.Reply(`^Your reply is invalid: .*operation`, `{"operation": "multiply", "x": 2, "y": 2}`),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	op, x, y, err := calculateParsePromptWithLLM(ctx, provider, calculateSchema(), "Raise 2 to 2", false)
+	if err != nil || op != "multiply" || x != 2 || y != 2 {
+		t.Fatalf("calculateParsePromptWithLLM = %s, %v, %v, %v, want multiply, 2, 2", op, x, y, err)
+	}
+	if n := len(h.Requests()); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestCalculateParsePromptWithLLMError(t *testing.T) {
+	provider, _ := newProvider(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, _, _, err := calculateParsePromptWithLLM(ctx, provider, calculateSchema(), "Multiply 6 by 7", false)
+	var statusErr *llm.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want the 404 of the LLM", err)
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -14,6 +14,9 @@ import (
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
+
+	"mcp/internal/randid"
+	"mcp/llm"
 )
 
 // ==================== Structs ====================
@@ -33,29 +36,9 @@ type ResourceSchema struct {
 
 type ChatMessage struct {
 	Message string `json:"message"`
-}
-
-type LLMResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
-type LLMRequest struct {
-	Model        string      `json:"model"`
-	Messages     MessageList `json:"messages"`
-	MaxNewTokens int         `json:"max_new_tokens"`
-	Temperature  float64     `json:"temperature"`
-	N            int         `json:"n"`
-}
-
-type MessageList []Message
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	// ConversationID continues a conversation; the one of the session
+	// cookie is used when empty
+	ConversationID string `json:"conversationId,omitempty"`
 }
 
 // ==================== UI Template ====================
@@ -78,6 +61,14 @@ section { padding: 10px; }
 .chat-message { margin: 5px 0; padding: 8px; border-radius: 5px; max-width: 80%; }
 .user { background: #4a90e2; align-self: flex-end; }
 .bot { background: #333; align-self: flex-start; }
+.trace { background: #222; color: #999; font-family: monospace; font-size: 12px; white-space: pre-wrap; align-self: flex-start; }
+.chat-toolbar { display: flex; margin-bottom: 10px; }
+.chat-toolbar select { flex: 1; padding: 8px; border-radius: 5px; border: 1px solid #555; background: #1e1e1e; color: #eee; }
+.chat-toolbar button { margin-left: 5px; padding: 8px 12px; background: #444; border: none; border-radius: 5px; color: #fff; cursor: pointer; }
+.chat-toolbar .usage { margin-left: 10px; align-self: center; color: #999; font-size: 12px; }
+.usage-table { border-collapse: collapse; margin: 10px 0 20px; }
+.usage-table th, .usage-table td { border: 1px solid #444; padding: 4px 10px; text-align: right; }
+.usage-table th:first-child, .usage-table td:first-child { text-align: left; }
 .chat-input { display: flex; }
 .chat-input input { flex: 1; padding: 10px; border-radius: 5px; border: 1px solid #555; background: #1e1e1e; color: #eee; }
 .chat-input button { margin-left: 5px; padding: 10px 15px; background: #4a90e2; border: none; border-radius: 5px; color: #fff; cursor: pointer; }
@@ -89,12 +80,20 @@ section { padding: 10px; }
 	<button class="tab-btn active" data-tab="tools">Tools</button>
 	<button class="tab-btn" data-tab="resources">Resources</button>
 	<button class="tab-btn" data-tab="chat">Chat</button>
+	<button class="tab-btn" data-tab="usage">Usage</button>
+	{{if .MCPWebSocket}}<button class="tab-btn" data-tab="mcp">MCP (WebSocket)</button>{{end}}
 </nav>
 <section id="content">
 	<div id="tools" class="tab active-tab"></div>
 	<div id="resources" class="tab" style="display:none;"></div>
 	<div id="chat" class="tab" style="display:none;">
 		<div class="chat-box">
+			<div class="chat-toolbar">
+				<select id="conversations" onchange="loadConversation(this.value)"></select>
+				<button onclick="newConversation()">New</button>
+				<button onclick="deleteConversation()">Delete</button>
+				<span id="conversationUsage" class="usage"></span>
+			</div>
 			<div id="chatMessages" class="chat-messages"></div>
 			<div class="chat-input">
 				<input type="text" id="chatInput" placeholder="Type your message..." />
@@ -102,6 +101,8 @@ section { padding: 10px; }
 			</div>
 		</div>
 	</div>
+	<div id="usage" class="tab" style="display:none;"></div>
+	<div id="mcp" class="tab" style="display:none;"><p id="mcpStatus"></p><div id="mcpTools"></div></div>
 </section>
 
 <script>
@@ -129,20 +130,209 @@ async function sendChat() {
 	addMessage('user', message);
 	input.value = '';
 
+	// The answer streams into a bot bubble per model reply, the tool calls and
+	// their results into a trace above it
+	let bot = null, trace = null, answered = false;
+	const appendTrace = text => {
+		if (!trace) trace = addMessage('trace', '');
+		trace.innerText += text;
+	};
+
 	try {
-		const res = await fetch('/chat', {
+		const res = await fetch('/chat/stream', {
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
-			body: JSON.stringify({ message })
+			body: JSON.stringify({ message, conversationId })
+		});
+		if (!res.ok) {
+			const data = await res.json();
+			addMessage('bot', '❌ ' + data.error);
+			return;
+		}
+		await readEvents(res.body, (event, data) => {
+			if (event === 'delta' && data.toolCall) {
+				if (data.toolCall.name) appendTrace((trace && trace.innerText ? '\n' : '') + '→ ' + data.toolCall.name + ' ');
+				appendTrace(data.toolCall.arguments || '');
+			} else if (event === 'delta') {
+				if (!bot) { bot = addMessage('bot', ''); trace = null; }
+				bot.innerText += data.content;
+				answered = true;
+			} else if (event === 'step' && data.kind === 'tool') {
+				appendTrace('\n' + formatSteps([data]));
+			} else if (event === 'step') {
+				bot = null;
+				if (data.toolCalls) answered = false;
+			} else if (event === 'done') {
+				if (!answered) addMessage('bot', data.response || '(no answer)');
+				addMessage('trace', formatUsage(data.usage) + ' · ' + (data.steps || []).filter(s => s.kind === 'model').reduce((ms, s) => ms + s.durationMs, 0) + ' ms');
+				conversationId = data.conversationId;
+				showConversationUsage(data.conversationUsage);
+				loadConversations();
+			} else if (event === 'error') {
+				addMessage('bot', '❌ ' + data.error);
+			}
 		});
-		const data = await res.json();
-		if (data.error) addMessage('bot', '❌ ' + data.error);
-		else addMessage('bot', data.response || '(no answer)');
 	} catch(err) {
 		addMessage('bot', '❌ Network error');
 	}
 }
 
+// ==================== Conversations ====================
+// The conversation of the session is kept in a cookie, so that a reload
+// continues it
+let conversationId = (document.cookie.match(/(?:^|; )conversation=([^;]*)/) || [])[1] || '';
+
+async function loadConversations() {
+	const res = await fetch('/conversations');
+	const list = await res.json();
+	const select = document.getElementById('conversations');
+	select.innerHTML = '';
+	const empty = document.createElement('option');
+	empty.value = '';
+	empty.innerText = '(new conversation)';
+	select.appendChild(empty);
+	list.forEach(c => {
+		const opt = document.createElement('option');
+		opt.value = c.id;
+		opt.innerText = (c.title || '(empty)') + ' · ' + c.messages + ' messages · ' + new Date(c.updated).toLocaleString();
+		select.appendChild(opt);
+	});
+	select.value = list.some(c => c.id === conversationId) ? conversationId : '';
+}
+
+async function loadConversation(id) {
+	if (!id) return newConversation();
+	const res = await fetch('/conversations/' + id);
+	if (!res.ok) return newConversation();
+	const conv = await res.json();
+	conversationId = conv.id;
+	renderConversation(conv);
+	const metrics = await (await fetch('/metrics')).json();
+	showConversationUsage(metrics.byConversation[conv.id]);
+}
+
+// renderConversation replays the history: messages in bubbles, tool calls
+// and results in traces
+function renderConversation(conv) {
+	document.getElementById('chatMessages').innerHTML = '';
+	if (conv.summary) addMessage('trace', 'Summary of earlier messages: ' + conv.summary);
+	let trace = null;
+	(conv.messages || []).forEach(m => {
+		if (m.role === 'user') {
+			trace = null;
+			addMessage('user', m.content);
+		} else if (m.role === 'tool') {
+			if (trace) trace.innerText += '\n  = ' + m.content;
+		} else {
+			if (m.tool_calls) {
+				if (!trace) trace = addMessage('trace', '');
+				m.tool_calls.forEach(tc => trace.innerText += (trace.innerText ? '\n' : '') + '→ ' + tc.function.name + ' ' + tc.function.arguments);
+			}
+			if (m.content) {
+				addMessage('bot', m.content);
+				trace = null;
+			}
+		}
+	});
+}
+
+async function newConversation() {
+	const res = await fetch('/conversations', { method: 'POST' });
+	const conv = await res.json();
+	conversationId = conv.id;
+	renderConversation(conv);
+	showConversationUsage(null);
+	loadConversations();
+}
+
+async function deleteConversation() {
+	if (!conversationId) return;
+	await fetch('/conversations/' + conversationId, { method: 'DELETE' });
+	conversationId = '';
+	document.getElementById('chatMessages').innerHTML = '';
+	showConversationUsage(null);
+	loadConversations();
+}
+
+loadConversations().then(() => { if (conversationId) loadConversation(conversationId); });
+
+// readEvents parses the server-sent events of a response body
+async function readEvents(body, onEvent) {
+	const reader = body.getReader();
+	const decoder = new TextDecoder();
+	let buffer = '';
+	for (;;) {
+		const { done, value } = await reader.read();
+		if (done) break;
+		buffer += decoder.decode(value, { stream: true });
+		let end;
+		while ((end = buffer.indexOf('\n\n')) >= 0) {
+			const block = buffer.slice(0, end);
+			buffer = buffer.slice(end + 2);
+			let event = 'message', data = '';
+			block.split('\n').forEach(line => {
+				if (line.startsWith('event: ')) event = line.slice(7);
+				else if (line.startsWith('data: ')) data += line.slice(6);
+			});
+			if (data) onEvent(event, JSON.parse(data));
+		}
+	}
+}
+
+// formatSteps renders the agent trace, one line per model or tool step
+function formatSteps(steps) {
+	return steps.map(s => {
+		let line = '#' + s.iteration + ' ';
+		if (s.kind === 'tool') line += s.toolCall.function.name + '(' + s.toolCall.function.arguments + ') → ' + (s.error ? 'error: ' + s.error : s.result);
+		else if (s.error) line += 'model → error: ' + s.error;
+		else if (s.toolCalls) line += 'model requested ' + s.toolCalls + ' tool call(s)';
+		else line += 'model answered';
+		if (s.usage) line += ' [' + formatUsage(s.usage) + ']';
+		return line + ' (' + s.durationMs + ' ms)';
+	}).join('\n');
+}
+
+// ==================== Usage ====================
+// formatUsage renders a token count; "~" marks counts estimated because the
+// server did not report them
+function formatUsage(u) {
+	if (!u) return '';
+	return (u.estimated ? '~' : '') + u.promptTokens + ' in / ' + u.completionTokens + ' out tokens' + (u.model ? ' · ' + u.model : '');
+}
+
+function showConversationUsage(stats) {
+	document.getElementById('conversationUsage').innerText = stats && stats.calls
+		? stats.calls + ' LLM calls · ' + stats.totalTokens + ' tokens · ' + stats.avgLatencyMs + ' ms avg'
+		: '';
+}
+
+// loadUsage renders /metrics as one table per grouping
+async function loadUsage() {
+	const res = await fetch('/metrics');
+	const m = await res.json();
+	const container = document.getElementById('usage');
+	container.innerHTML = '';
+	const table = (title, rows) => {
+		const h3 = document.createElement('h3'); h3.innerText = title; container.appendChild(h3);
+		const t = document.createElement('table'); t.className = 'usage-table';
+		const head = t.insertRow();
+		['', 'calls', 'errors', 'estimated', 'prompt', 'completion', 'total', 'avg ms', 'max ms'].forEach(h => {
+			const th = document.createElement('th'); th.innerText = h; head.appendChild(th);
+		});
+		Object.keys(rows).sort().forEach(k => {
+			const s = rows[k], row = t.insertRow();
+			[k, s.calls, s.errors, s.estimated, s.promptTokens, s.completionTokens, s.totalTokens, s.avgLatencyMs, s.maxLatencyMs].forEach(v => row.insertCell().innerText = v);
+		});
+		container.appendChild(t);
+	};
+	table('Total since ' + new Date(m.since).toLocaleString(), { all: m.total });
+	table('By model', m.byModel);
+	table('By tool decision', m.byDecision);
+	table('By conversation', m.byConversation);
+}
+setInterval(() => { if (document.getElementById('usage').style.display !== 'none') loadUsage(); }, 5000);
+document.querySelector('[data-tab="usage"]').addEventListener('click', loadUsage);
+
 function addMessage(role, text) {
 	const container = document.getElementById('chatMessages');
 	const div = document.createElement('div');
@@ -150,6 +340,7 @@ function addMessage(role, text) {
 	div.innerText = text;
 	container.appendChild(div);
 	setTimeout(() => container.scrollTop = container.scrollHeight, 50);
+	return div;
 }
 
 // ==================== Tools ====================
@@ -194,6 +385,80 @@ async function loadResources(auto = false) {
 }
 setInterval(() => loadResources(true), 5000);
 
+// ==================== Direct MCP ====================
+// With -mcp-ws the page opens its own MCP session over WebSocket and calls
+// the tools of that server directly, without going through this server
+const mcpWebSocketURL = {{.MCPWebSocket}};
+let mcpSocket = null, mcpNextID = 1;
+const mcpPending = {};
+
+function mcpRequest(method, params) {
+	const id = mcpNextID++;
+	mcpSocket.send(JSON.stringify({ jsonrpc: '2.0', id, method, params }));
+	return new Promise((resolve, reject) => mcpPending[id] = { resolve, reject });
+}
+
+function connectMCP() {
+	const status = document.getElementById('mcpStatus');
+	status.innerText = 'Connecting to ' + mcpWebSocketURL + '...';
+	mcpSocket = new WebSocket(mcpWebSocketURL, 'mcp');
+	mcpSocket.onmessage = e => {
+		const msg = JSON.parse(e.data);
+		const pending = mcpPending[msg.id];
+		// notifications and requests of the server are not handled
+		if (msg.method || !pending) return;
+		delete mcpPending[msg.id];
+		if (msg.error) pending.reject(new Error(msg.error.message));
+		else pending.resolve(msg.result);
+	};
+	mcpSocket.onclose = () => {
+		status.innerText = 'Disconnected from ' + mcpWebSocketURL;
+		Object.keys(mcpPending).forEach(id => { mcpPending[id].reject(new Error('connection closed')); delete mcpPending[id]; });
+		mcpSocket = null;
+	};
+	mcpSocket.onopen = async () => {
+		try {
+			const init = await mcpRequest('initialize', { protocolVersion: '2025-06-18', capabilities: {}, clientInfo: { name: 'MCP Go UI (browser)', version: '1.0' } });
+			mcpSocket.send(JSON.stringify({ jsonrpc: '2.0', method: 'notifications/initialized', params: {} }));
+			status.innerText = 'Connected to ' + init.serverInfo.name + ' ' + init.serverInfo.version + ' at ' + mcpWebSocketURL;
+			const { tools } = await mcpRequest('tools/list', {});
+			renderMCPTools(tools);
+		} catch (err) {
+			status.innerText = '❌ ' + err.message;
+		}
+	};
+}
+
+function renderMCPTools(tools) {
+	const container = document.getElementById('mcpTools');
+	container.innerHTML = '';
+	tools.forEach(t => {
+		const div = document.createElement('div');
+		div.className = 'tool';
+		const h3 = document.createElement('h3'); h3.innerText = t.name; div.appendChild(h3);
+		const p = document.createElement('p'); p.innerText = t.description || ''; div.appendChild(p);
+		const args = document.createElement('input');
+		args.value = JSON.stringify(Object.fromEntries(Object.keys((t.inputSchema || {}).properties || {}).map(k => [k, ''])));
+		args.style.width = '60%';
+		const button = document.createElement('button'); button.innerText = 'Call';
+		const result = document.createElement('pre');
+		button.onclick = async () => {
+			try {
+				const res = await mcpRequest('tools/call', { name: t.name, arguments: JSON.parse(args.value || '{}') });
+				result.innerText = (res.isError ? '❌ ' : '') + (res.content || []).map(c => c.text || JSON.stringify(c)).join('\n');
+			} catch (err) {
+				result.innerText = '❌ ' + err.message;
+			}
+		};
+		div.append(args, button, result);
+		container.appendChild(div);
+	});
+}
+
+if (mcpWebSocketURL) {
+	document.querySelector('[data-tab="mcp"]').addEventListener('click', () => { if (!mcpSocket) connectMCP(); });
+}
+
 loadTools();
 loadResources();
 </script>
@@ -205,61 +470,200 @@ loadResources();
 
 // respondError centralizes HTTP error response
 func respondError(w http.ResponseWriter, err error) {
+	respondErrorWithSteps(w, err, nil)
+}
+
+// respondErrorWithSteps is respondError for a failed agent run, keeping the
+// trace of the steps that did happen
+func respondErrorWithSteps(w http.ResponseWriter, err error, steps []llm.Step) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	w.WriteHeader(errorStatus(err))
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "steps": steps})
 }
 
-// getDynamicToolList returns available tools as a formatted string
-func getDynamicToolList(ctx context.Context, mcpClient *client.Client) string {
+// errorStatus maps the typed errors of the LLM client to an HTTP status, so
+// that an unreachable or overloaded model is not reported as a bug of the UI
+func errorStatus(err error) int {
+	var statusErr *llm.StatusError
+	switch {
+	case errors.Is(err, llm.ErrCircuitOpen), errors.Is(err, llm.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, llm.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &statusErr):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getLLMTools converts the MCP tools into the "tools" of a chat completions request
+func getLLMTools(ctx context.Context, mcpClient *client.Client) ([]llm.Tool, error) {
 	res, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
 	if err != nil {
-		return "- calculate: arithmetic tool (default)\n"
+		return nil, err
 	}
-	list := ""
+	var tools []llm.Tool
 	for _, t := range res.Tools {
-		list += fmt.Sprintf("- %s: %s with input schema %s \n", t.Name, t.Description, t.InputSchema)
+		params := t.RawInputSchema
+		if len(params) == 0 {
+			params, _ = json.Marshal(t.InputSchema)
+		}
+		tools = append(tools, llm.NewTool(t.Name, t.Description, params))
 	}
-	return list
+	return tools, nil
 }
 
-// callLLM sends a prompt to LLM and returns parsed JSON
-func callLLM(systemPrompt, userPrompt string) (map[string]any, error) {
-	reqBody := LLMRequest{
-		Model: "qwen/qwen3-vl-4b",
-		Messages: MessageList{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-		MaxNewTokens: 50,
-		Temperature:  0.0,
-		N:            1,
+// callTool dispatches a tool call of the model to the MCP server and returns
+// the text to feed back as the "tool" message. Failures are reported to the
+// model by the agent, so that it can recover or explain them.
+func callTool(ctx context.Context, mcpClient *client.Client, call llm.ToolCall) (string, error) {
+	var arguments map[string]any
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return "", fmt.Errorf("invalid arguments JSON: %w", err)
+		}
 	}
-	data, _ := json.Marshal(reqBody)
-	resp, err := http.Post("http://127.0.0.1:1234/v1/chat/completions", "application/json", bytes.NewReader(data))
+
+	callReq := mcp.CallToolRequest{Params: mcp.CallToolParams{Name: call.Function.Name, Arguments: arguments}}
+	res, err := mcpClient.CallTool(ctx, callReq)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	var llmResp LLMResponse
-	if err := json.Unmarshal(body, &llmResp); err != nil {
-		return nil, err
+
+	text := ""
+	for _, c := range res.Content {
+		switch v := c.(type) {
+		case mcp.TextContent:
+			text += v.Text
+		default:
+			text += fmt.Sprintf("[%T]", v)
+		}
 	}
-	if len(llmResp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices returned from LLM")
+	if res.IsError {
+		return "", errors.New(text)
 	}
+	return text, nil
+}
+
+// systemPrompt is sent first in every conversation
+const systemPrompt = "You are an assistant. Use the available tools when the user's request requires them, then answer in natural language."
+
+// conversationCookie keeps the conversation of a browser session
+const conversationCookie = "conversation"
+
+// sessionCookie identifies the browser session, which owns its conversations:
+// another session can neither list nor load nor delete them
+const sessionCookie = "session"
 
-	var parsed map[string]any
-	if err := json.Unmarshal([]byte(llmResp.Choices[0].Message.Content), &parsed); err != nil {
-		return nil, fmt.Errorf("invalid JSON from LLM: %v", err)
+// runAgent answers a message of conv with the agent: it keeps calling the
+// model through chat, running the tools it asks for and feeding the results
+// back, until it writes the final answer. onStep, when not nil, receives the
+// trace. On success the message, the tool calls and results and the answer
+// are appended to conv.
+func runAgent(ctx context.Context, mcpClient *client.Client, chat llm.ChatFunc, conv *llm.Conversation, message string, onStep func(llm.Step)) (*llm.AgentResult, error) {
+	tools, err := getLLMTools(ctx, mcpClient)
+	if err != nil {
+		return nil, fmt.Errorf("listing tools: %w", err)
+	}
+
+	messages := append(conv.Context(systemPrompt), llm.Message{Role: llm.RoleUser, Content: message})
+	runTool := func(ctx context.Context, call llm.ToolCall) (string, error) {
+		return callTool(ctx, mcpClient, call)
+	}
+	result, err := llm.RunAgent(ctx, chat, tools, runTool, messages, &llm.AgentOptions{
+		OnStep: func(step llm.Step) {
+			if step.Kind == llm.StepTool {
+				fmt.Printf("tool call %s(%s) -> %s%s\n", step.ToolCall.Function.Name, step.ToolCall.Function.Arguments, step.Result, step.Error)
+			}
+			if onStep != nil {
+				onStep(step)
+			}
+		},
+	})
+	if err != nil {
+		return result, fmt.Errorf("LLM error: %w", err)
 	}
-	return parsed, nil
+
+	conv.Append(result.Messages[len(messages)-1:]...)
+	return result, nil
+}
+
+// sessionFor returns the browser session of r, starting a new one when the
+// request has no session cookie
+func sessionFor(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(sessionCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	id := randid.New()
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	return id
+}
+
+// conversationFor begins the turn of a chat message on the conversation it
+// belongs to, among those of the session: the one it names, else the one of
+// the conversation cookie, else a new one. The cookie is set to it. A turn
+// waits for the previous turns on the conversation, and end must be called
+// once it is saved.
+func conversationFor(w http.ResponseWriter, r *http.Request, store *llm.ConversationStore, id string) (conv *llm.Conversation, end func(), err error) {
+	owner := sessionFor(w, r)
+	if id == "" {
+		if c, err := r.Cookie(conversationCookie); err == nil {
+			id = c.Value
+		}
+	}
+	conv, end, err = store.Begin(r.Context(), owner, id)
+	if errors.Is(err, llm.ErrConversationNotFound) {
+		conv, end, err = store.Begin(r.Context(), owner, store.Create(owner).ID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	setConversationCookie(w, conv.ID)
+	return conv, end, nil
+}
+
+func setConversationCookie(w http.ResponseWriter, id string) {
+	// readable by the page, which loads the conversation back on reload
+	http.SetCookie(w, &http.Cookie{Name: conversationCookie, Value: id, Path: "/", SameSite: http.SameSiteLaxMode})
+}
+
+// saveConversation drops (and summarizes) the oldest turns of conv beyond the
+// token budget and stores it. The summaries count in the metrics of conv.
+func saveConversation(ctx context.Context, store *llm.ConversationStore, metrics *llm.Metrics, conv *llm.Conversation, memory *llm.MemoryOptions) {
+	var opts llm.MemoryOptions
+	if memory != nil {
+		opts = *memory
+	}
+	if opts.Summarizer != nil {
+		opts.Summarizer = metrics.Provider(opts.Summarizer, conv.ID)
+	}
+	if err := llm.Compact(ctx, conv, &opts); err != nil {
+		log.Printf("Compacting conversation %s: %v", conv.ID, err)
+	}
+	store.Save(conv)
 }
 
 // ==================== Main ====================
 
 func main() {
+	historyTokens := flag.Int("history-tokens", llm.DefaultTokenBudget, "token budget of the conversation history sent to the LLM")
+	summarize := flag.Bool("summarize", true, "summarize the messages dropped from the history instead of forgetting them")
+	mcpWebSocket := flag.String("mcp-ws", "", "WebSocket URL of an MCP server the page talks to directly, e.g. ws://localhost:8081/mcp (the order server of example 5 started with -transport tcp,ws -ws-origin http://localhost:8080)")
+	llmConfig := llm.Config{Provider: llm.ProviderOpenAI}
+	llmConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		log.Fatalf("Error creating LLM provider: %v", err)
+	}
+
+	memory := &llm.MemoryOptions{TokenBudget: *historyTokens}
+	if *summarize {
+		memory.Summarizer = provider
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -283,13 +687,33 @@ func main() {
 
 	fmt.Printf("Connected to MCP server: %s (%s)\n", serverInfo.ServerInfo.Name, serverInfo.ServerInfo.Version)
 
-	// ==================== HTTP Handlers ====================
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("🚀 MCP Go UI running at http://localhost:8080")
+	log.Fatal(http.ListenAndServe(":8080", newHandler(mcpClient, provider, memory, *mcpWebSocket)))
+}
+
+// ==================== HTTP Handlers ====================
+
+// newHandler returns the routes of the UI, chatting with provider and
+// calling the tools of mcpClient. memory bounds the conversation histories.
+func newHandler(mcpClient *client.Client, provider llm.Provider, memory *llm.MemoryOptions, mcpWebSocket string) http.Handler {
+	// Conversations live in memory, owned by the browser session (cookie)
+	// that created them, which continues one of them or picks it by ID
+	store := llm.NewConversationStore()
+
+	// Tokens and latency of every LLM call, per model, conversation and tool
+	// decision, served at /metrics
+	metrics := llm.NewMetrics()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// the session starts with the page, before its requests run in
+		// parallel
+		sessionFor(w, r)
 		tmpl := template.Must(template.New("ui").Parse(uiTemplate))
-		_ = tmpl.Execute(w, nil)
+		_ = tmpl.Execute(w, struct{ MCPWebSocket string }{mcpWebSocket})
 	})
 
-	http.HandleFunc("/tools", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/tools", func(w http.ResponseWriter, r *http.Request) {
 		res, err := mcpClient.ListTools(r.Context(), mcp.ListToolsRequest{})
 		if err != nil {
 			respondError(w, err)
@@ -304,7 +728,7 @@ func main() {
 		_ = json.NewEncoder(w).Encode(tools)
 	})
 
-	http.HandleFunc("/resources", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/resources", func(w http.ResponseWriter, r *http.Request) {
 		res, err := mcpClient.ListResources(r.Context(), mcp.ListResourcesRequest{})
 		if err != nil {
 			respondError(w, err)
@@ -318,7 +742,7 @@ func main() {
 		_ = json.NewEncoder(w).Encode(list)
 	})
 
-	http.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "only POST", http.StatusMethodNotAllowed)
 			return
@@ -329,68 +753,143 @@ func main() {
 			return
 		}
 
-		systemPrompt := fmt.Sprintf(`
-You are an assistant. Decide if the user's request requires a tool.
-Available tools:
-%s
-If found, return JSON: {"tool":"<tool_name>","arguments":{...}}
-If not, return JSON: {"message":"<plain text reply>"}
-Return ONLY JSON.`, getDynamicToolList(r.Context(), mcpClient))
-
-		parsed, err := callLLM(systemPrompt, msg.Message)
+		conv, end, err := conversationFor(w, r, store, msg.ConversationID)
 		if err != nil {
-			respondError(w, fmt.Errorf("LLM error: %v", err))
+			respondError(w, err)
 			return
 		}
-		fmt.Println("LLM parsed:", parsed)
-
-		tool, _ := parsed["tool"].(string)
-		arguments, _ := parsed["arguments"].(map[string]any)
-		message, _ := parsed["message"].(string)
-
-		reply := ""
-		if message == "" && tool != "" {
-			// validate if tool exists
-			res, _ := mcpClient.ListTools(r.Context(), mcp.ListToolsRequest{})
-			found := false
-			for _, t := range res.Tools {
-				if t.Name == tool {
-					found = true
-					break
-				}
-			}
-			if !found {
-				respondError(w, fmt.Errorf("tool %s not found on server", tool))
-				return
+		defer end()
+		result, err := runAgent(r.Context(), mcpClient, metrics.Chat(provider.Chat, conv.ID), conv, msg.Message, nil)
+		if err != nil {
+			var steps []llm.Step
+			if result != nil {
+				steps = result.Steps
 			}
+			respondErrorWithSteps(w, err, steps)
+			return
+		}
 
-			callReq := mcp.CallToolRequest{Params: mcp.CallToolParams{Name: tool, Arguments: arguments}}
-			callToolResponse, err := mcpClient.CallTool(r.Context(), callReq)
-			if err != nil {
-				respondError(w, err)
-				return
-			}
+		reply := result.Answer
+		if reply == "" {
+			reply = "no answer"
+		}
 
-			if len(callToolResponse.Content) > 0 {
-				switch v := callToolResponse.Content[0].(type) {
-				case mcp.TextContent:
-					reply = v.Text
-				default:
-					reply = fmt.Sprintf("unknown content type: %T", v)
-				}
-			} else {
-				reply = "no answer"
-			}
-		} else if message != "" {
-			reply = message
-		} else {
+		saveConversation(r.Context(), store, metrics, conv, memory)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"response":          reply,
+			"steps":             result.Steps,
+			"conversationId":    conv.ID,
+			"usage":             result.Usage,
+			"conversationUsage": metrics.Conversation(conv.ID),
+		})
+	})
+
+	// /chat/stream is /chat as server-sent events: "delta" events carry the
+	// text and tool call fragments as the model generates them, "step" events
+	// the agent trace, and a final "done" or "error" event the outcome
+	mux.HandleFunc("/chat/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var msg ChatMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondError(w, errors.New("streaming not supported"))
+			return
+		}
+
+		conv, end, err := conversationFor(w, r, store, msg.ConversationID)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		defer end()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		send := func(event string, v any) {
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			flusher.Flush()
+		}
+
+		chat := metrics.Chat(llm.StreamFunc(provider, func(d llm.Delta) { send("delta", d) }), conv.ID)
+		result, err := runAgent(r.Context(), mcpClient, chat, conv, msg.Message, func(step llm.Step) { send("step", step) })
+		if err != nil {
+			send("error", map[string]any{"error": err.Error(), "status": errorStatus(err)})
+			return
+		}
+
+		reply := result.Answer
+		if reply == "" {
 			reply = "no answer"
 		}
+		saveConversation(r.Context(), store, metrics, conv, memory)
+		send("done", map[string]any{
+			"response":          reply,
+			"steps":             result.Steps,
+			"conversationId":    conv.ID,
+			"usage":             result.Usage,
+			"conversationUsage": metrics.Conversation(conv.ID),
+		})
+	})
 
+	// /metrics reports the tokens and latency of the LLM calls so far, to
+	// compare models on the same workflows. Only the conversations of the
+	// session are listed; the other groupings are aggregates.
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := metrics.Snapshot()
+		mine := make(map[string]llm.Stats)
+		for _, conv := range store.List(sessionFor(w, r)) {
+			if stats, ok := snapshot.ByConversation[conv.ID]; ok {
+				mine[conv.ID] = stats
+			}
+		}
+		snapshot.ByConversation = mine
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"response": reply})
+		_ = json.NewEncoder(w).Encode(snapshot)
 	})
 
-	fmt.Println("🚀 MCP Go UI running at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// ==================== Conversations ====================
+	mux.HandleFunc("GET /conversations", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(store.List(sessionFor(w, r)))
+	})
+
+	// POST starts a new conversation of the session
+	mux.HandleFunc("POST /conversations", func(w http.ResponseWriter, r *http.Request) {
+		conv := store.Create(sessionFor(w, r))
+		setConversationCookie(w, conv.ID)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(conv)
+	})
+
+	// GET loads a conversation and makes it the one of the session
+	mux.HandleFunc("GET /conversations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		conv, ok := store.Get(sessionFor(w, r), r.PathValue("id"))
+		if !ok {
+			http.Error(w, "conversation not found", http.StatusNotFound)
+			return
+		}
+		setConversationCookie(w, conv.ID)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(conv)
+	})
+
+	mux.HandleFunc("DELETE /conversations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !store.Delete(sessionFor(w, r), r.PathValue("id")) {
+			http.Error(w, "conversation not found", http.StatusNotFound)
+			return
+		}
+		metrics.Forget(r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
 }
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"mcp/llm"
+	"mcp/llm/llmtest"
+)
+
+// The tests of this directory run with the file list, since server.go is a
+// package main too:
+//
+//	go test 6-order-client-server-ia-community/ui/client-ui.go 6-order-client-server-ia-community/ui/client-ui_test.go
+
+// newUI serves the UI with a fake LLM answering with rules and an in-process
+// MCP server with a multiply tool.
+func newUI(t *testing.T, rules ...llmtest.Rule) *httptest.Server {
+	t.Helper()
+	return newUIMemory(t, &llm.MemoryOptions{TokenBudget: 100000}, false, rules...)
+}
+
+// newUIMemory is newUI with the given history options, summarizing with the
+// fake LLM when summarize is set.
+func newUIMemory(t *testing.T, memory *llm.MemoryOptions, summarize bool, rules ...llmtest.Rule) *httptest.Server {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := server.NewMCPServer("Calculator", "1.0.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("multiply", mcp.WithNumber("x", mcp.Required()), mcp.WithNumber("y", mcp.Required())),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(fmt.Sprintf("%.2f", req.GetFloat("x", 0)*req.GetFloat("y", 0))), nil
+		})
+	mcpClient, err := client.NewInProcessClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mcpClient.Close() })
+	if err := mcpClient.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		ClientInfo:      mcp.Implementation{Name: "test", Version: "1.0"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := llmtest.NewHandler(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llmServer := httptest.NewServer(h)
+	t.Cleanup(llmServer.Close)
+	provider, err := llm.New(llm.Config{Provider: llm.ProviderOpenAI, BaseURL: llmServer.URL + "/v1", Model: "fake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summarize {
+		memory.Summarizer = provider
+	}
+	ui := httptest.NewServer(newHandler(mcpClient, provider, memory, ""))
+	t.Cleanup(ui.Close)
+	return ui
+}
+
+// multiplyRules make the fake LLM call multiply and answer with its result.
+var multiplyRules = []llmtest.Rule{
+	llmtest.CallTool(`^Multiply (\d+) by (\d+)$`, "multiply", `{"x": $1, "y": $2}`),
+	{Role: llm.RoleTool, Match: `^(.+)$`, Reply: "The result is $1."},
+}
+
+// browser returns a client keeping the cookies of a browser session.
+func browser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar, Timeout: 5 * time.Second}
+}
+
+type chatReply struct {
+	Response       string     `json:"response"`
+	Steps          []llm.Step `json:"steps"`
+	ConversationID string     `json:"conversationId"`
+	Error          string     `json:"error"`
+}
+
+func chat(t *testing.T, c *http.Client, ui *httptest.Server, msg ChatMessage) (int, chatReply) {
+	t.Helper()
+	body, _ := json.Marshal(msg)
+	resp, err := c.Post(ui.URL+"/chat", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0, chatReply{}
+	}
+	defer resp.Body.Close()
+	var reply chatReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Errorf("/chat answer: %v", err)
+	}
+	return resp.StatusCode, reply
+}
+
+// getJSON gets path into v and returns the status.
+func getJSON(t *testing.T, c *http.Client, ui *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := c.Get(ui.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestChat(t *testing.T) {
+	ui := newUI(t, multiplyRules...)
+	alice := browser(t)
+
+	status, reply := chat(t, alice, ui, ChatMessage{Message: "Multiply 6 by 7"})
+	if status != http.StatusOK || reply.Response != "The result is 42.00." {
+		t.Fatalf("/chat = %d %+v", status, reply)
+	}
+	var tools []string
+	for _, step := range reply.Steps {
+		if step.Kind == llm.StepTool {
+			tools = append(tools, step.ToolCall.Function.Name+"="+step.Result)
+		}
+	}
+	if len(tools) != 1 || tools[0] != "multiply=42.00" {
+		t.Errorf("tool steps = %v, want multiply=42.00", tools)
+	}
+
+	// the next message continues the conversation of the session cookie
+	if _, next := chat(t, alice, ui, ChatMessage{Message: "Multiply 2 by 3"}); next.ConversationID != reply.ConversationID {
+		t.Errorf("second message in conversation %s, want %s", next.ConversationID, reply.ConversationID)
+	}
+	var conv llm.Conversation
+	if status := getJSON(t, alice, ui, "/conversations/"+reply.ConversationID, &conv); status != http.StatusOK {
+		t.Fatalf("GET /conversations/%s: %d", reply.ConversationID, status)
+	}
+	// user message, tool call, tool result and answer for each message
+	if len(conv.Messages) != 8 || conv.Title != "Multiply 6 by 7" {
+		t.Errorf("conversation %q with %d messages, want 8", conv.Title, len(conv.Messages))
+	}
+
+	// another browser session does not see it
+	bob := browser(t)
+	var list []llm.ConversationInfo
+	if getJSON(t, bob, ui, "/conversations", &list); len(list) != 0 {
+		t.Errorf("conversations of another session: %+v", list)
+	}
+	if status := getJSON(t, bob, ui, "/conversations/"+reply.ConversationID, &conv); status != http.StatusNotFound {
+		t.Errorf("GET of another session's conversation: %d, want 404", status)
+	}
+	if _, other := chat(t, bob, ui, ChatMessage{Message: "Multiply 1 by 1", ConversationID: reply.ConversationID}); other.ConversationID == reply.ConversationID {
+		t.Error("another session added to the conversation")
+	}
+}
+
+// A message the LLM answers without a tool gets the answer alone.
+func TestChatPlainMessage(t *testing.T) {
+	ui := newUI(t, append([]llmtest.Rule{llmtest.Reply(`^Hello$`, "Hi! Ask me to multiply two numbers.")}, multiplyRules...)...)
+	alice := browser(t)
+
+	status, reply := chat(t, alice, ui, ChatMessage{Message: "Hello"})
+	if status != http.StatusOK || reply.Response != "Hi! Ask me to multiply two numbers." {
+		t.Fatalf("/chat = %d %+v", status, reply)
+	}
+	for _, step := range reply.Steps {
+		if step.Kind == llm.StepTool {
+			t.Errorf("tool step for a plain message: %+v", step)
+		}
+	}
+	var conv llm.Conversation
+	if status := getJSON(t, alice, ui, "/conversations/"+reply.ConversationID, &conv); status != http.StatusOK {
+		t.Fatalf("GET /conversations/%s: %d", reply.ConversationID, status)
+	}
+	// user message and answer
+	if len(conv.Messages) != 2 {
+		t.Errorf("conversation with %d messages, want 2", len(conv.Messages))
+	}
+}
+
+type streamEvent struct {
+	name string
+	data json.RawMessage
+}
+
+// chatStream posts msg to /chat/stream and returns its events.
+func chatStream(t *testing.T, c *http.Client, ui *httptest.Server, msg ChatMessage) []streamEvent {
+	t.Helper()
+	body, _ := json.Marshal(msg)
+	resp, err := c.Post(ui.URL+"/chat/stream", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("/chat/stream = %d %s", resp.StatusCode, ct)
+	}
+	var (
+		events []streamEvent
+		name   string
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if event, ok := strings.CutPrefix(line, "event: "); ok {
+			name = event
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+			events = append(events, streamEvent{name, json.RawMessage(data)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestChatStream(t *testing.T) {
+	ui := newUI(t, multiplyRules...)
+	events := chatStream(t, browser(t), ui, ChatMessage{Message: "Multiply 6 by 7"})
+
+	// the tool call streams, then its steps, then the answer and its step
+	var names []string
+	for _, e := range events {
+		if len(names) == 0 || names[len(names)-1] != e.name {
+			names = append(names, e.name)
+		}
+	}
+	if want := []string{"delta", "step", "delta", "step", "done"}; !slices.Equal(names, want) {
+		t.Fatalf("events = %v, want %v (repeats aside)", names, want)
+	}
+
+	var (
+		args, text strings.Builder
+		steps      []llm.StepKind
+	)
+	for _, e := range events[:len(events)-1] {
+		switch e.name {
+		case "delta":
+			var d llm.Delta
+			if err := json.Unmarshal(e.data, &d); err != nil {
+				t.Fatal(err)
+			}
+			text.WriteString(d.Content)
+			if d.ToolCall != nil {
+				args.WriteString(d.ToolCall.Arguments)
+			}
+		case "step":
+			var step llm.Step
+			if err := json.Unmarshal(e.data, &step); err != nil {
+				t.Fatal(err)
+			}
+			steps = append(steps, step.Kind)
+		}
+	}
+	if args.String() != `{"x": 6, "y": 7}` {
+		t.Errorf("streamed arguments = %q", args.String())
+	}
+	if text.String() != "The result is 42.00." {
+		t.Errorf("streamed text = %q", text.String())
+	}
+	if want := []llm.StepKind{llm.StepModel, llm.StepTool, llm.StepModel}; !slices.Equal(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+
+	var done chatReply
+	if err := json.Unmarshal(events[len(events)-1].data, &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Response != "The result is 42.00." || done.ConversationID == "" || len(done.Steps) != 3 {
+		t.Errorf("done = %+v", done)
+	}
+}
+
+func TestChatStreamLLMError(t *testing.T) {
+	ui := newUI(t)
+	events := chatStream(t, browser(t), ui, ChatMessage{Message: "Multiply 6 by 7"})
+	// the failed model step, then the error
+	if len(events) != 2 || events[0].name != "step" || events[1].name != "error" {
+		t.Fatalf("events = %+v, want a step and an error", events)
+	}
+	var e struct {
+		Error  string `json:"error"`
+		Status int    `json:"status"`
+	}
+	if err := json.Unmarshal(events[1].data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Error == "" || e.Status != http.StatusBadGateway {
+		t.Errorf("error event = %+v, want a bad gateway", e)
+	}
+}
+
+// Concurrent messages on a conversation all make it to its history.
+func TestChatConcurrent(t *testing.T) {
+	ui := newUI(t, multiplyRules...)
+	alice := browser(t)
+	_, first := chat(t, alice, ui, ChatMessage{Message: "Multiply 1 by 1"})
+
+	const messages = 8
+	var wg sync.WaitGroup
+	for i := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, reply := chat(t, alice, ui, ChatMessage{Message: fmt.Sprintf("Multiply %d by 2", i), ConversationID: first.ConversationID}); status != http.StatusOK {
+				t.Errorf("/chat = %d %+v", status, reply)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var conv llm.Conversation
+	getJSON(t, alice, ui, "/conversations/"+first.ConversationID, &conv)
+	if want := 4 * (messages + 1); len(conv.Messages) != want {
+		t.Fatalf("%d messages in the conversation, want %d", len(conv.Messages), want)
+	}
+}
+
+// Deleting a conversation drops its metrics, which would otherwise grow with
+// every conversation ever started.
+func TestDeleteConversation(t *testing.T) {
+	ui := newUI(t, multiplyRules...)
+	alice := browser(t)
+	_, reply := chat(t, alice, ui, ChatMessage{Message: "Multiply 6 by 7"})
+
+	var metrics llm.MetricsSnapshot
+	if getJSON(t, alice, ui, "/metrics", &metrics); metrics.ByConversation[reply.ConversationID].Calls != 2 {
+		t.Fatalf("metrics of the conversation = %+v, want 2 calls", metrics.ByConversation[reply.ConversationID])
+	}
+
+	del := func(c *http.Client) int {
+		req, _ := http.NewRequest(http.MethodDelete, ui.URL+"/conversations/"+reply.ConversationID, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := del(browser(t)); status != http.StatusNotFound {
+		t.Errorf("DELETE by another session: %d, want 404", status)
+	}
+	if status := del(alice); status != http.StatusNoContent {
+		t.Fatalf("DELETE: %d, want 204", status)
+	}
+
+	metrics = llm.MetricsSnapshot{}
+	getJSON(t, alice, ui, "/metrics", &metrics)
+	if _, ok := metrics.ByConversation[reply.ConversationID]; ok {
+		t.Error("metrics of the deleted conversation still served")
+	}
+	if metrics.Total.Calls != 2 {
+		t.Errorf("total calls = %d, want 2", metrics.Total.Calls)
+	}
+}
+
+func TestChatLLMError(t *testing.T) {
+	ui := newUI(t)
+	status, reply := chat(t, browser(t), ui, ChatMessage{Message: "Multiply 6 by 7"})
+	// the 404 of the LLM is a bad gateway of the UI, not a bug of its own
+	if status != http.StatusBadGateway || reply.Error == "" {
+		t.Fatalf("/chat = %d %+v, want %d", status, reply, http.StatusBadGateway)
+	}
+}
+
+// A session sees the metrics of its own conversations only.
+func TestMetricsPerSession(t *testing.T) {
+	ui := newUI(t, multiplyRules...)
+	alice, bob := browser(t), browser(t)
+	_, aliceReply := chat(t, alice, ui, ChatMessage{Message: "Multiply 6 by 7"})
+	_, bobReply := chat(t, bob, ui, ChatMessage{Message: "Multiply 2 by 3"})
+
+	var metrics llm.MetricsSnapshot
+	getJSON(t, alice, ui, "/metrics", &metrics)
+	if len(metrics.ByConversation) != 1 || metrics.ByConversation[aliceReply.ConversationID].Calls != 2 {
+		t.Errorf("conversations in the metrics of alice = %+v, want only %s", metrics.ByConversation, aliceReply.ConversationID)
+	}
+	if _, ok := metrics.ByConversation[bobReply.ConversationID]; ok {
+		t.Error("the conversation of bob is in the metrics of alice")
+	}
+	// the aggregates cover every session
+	if metrics.Total.Calls != 4 || metrics.ByDecision["multiply"].Calls != 2 || metrics.ByDecision[llm.DecisionAnswer].Calls != 2 {
+		t.Errorf("aggregates = %+v by decision %+v, want the 4 calls", metrics.Total, metrics.ByDecision)
+	}
+}
+
+// The calls summarizing the history count in the metrics of the
+// conversation.
+func TestSummaryMetrics(t *testing.T) {
+	rules := append([]llmtest.Rule{llmtest.Reply(`^user: Multiply`, "The user multiplied numbers.")}, multiplyRules...)
+	ui := newUIMemory(t, &llm.MemoryOptions{TokenBudget: 40}, true, rules...)
+	alice := browser(t)
+
+	chat(t, alice, ui, ChatMessage{Message: "Multiply 6 by 7"})
+	_, reply := chat(t, alice, ui, ChatMessage{Message: "Multiply 2 by 3"})
+
+	var conv llm.Conversation
+	getJSON(t, alice, ui, "/conversations/"+reply.ConversationID, &conv)
+	if conv.Summary != "The user multiplied numbers." {
+		t.Fatalf("summary = %q, want the one of the fake LLM", conv.Summary)
+	}
+	var metrics llm.MetricsSnapshot
+	getJSON(t, alice, ui, "/metrics", &metrics)
+	if calls := metrics.ByConversation[reply.ConversationID].Calls; calls != 5 {
+		t.Errorf("calls of the conversation = %d, want 4 for the turns and 1 for the summary", calls)
+	}
+}
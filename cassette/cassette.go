@@ -0,0 +1,381 @@
+// Package cassette records the traffic of an MCP client to a file and plays it
+// back later.
+//
+// A [Cassette] sits on the two channels an LLM driven client talks through:
+// the HTTP requests sent to the language model ([Cassette.HTTPClient], to be
+// set as the HTTPClient of an llm.Config) and the JSON-RPC exchanges with
+// the MCP server ([Cassette.Transport], which wraps any [mcp.Transport]).
+// Depending on its [Mode] it either records both to a JSON file, serves them
+// back from that file without touching the network, or lets the live
+// traffic through while comparing it with the file.
+//
+// Every request is matched with the first unused interaction of the cassette
+// with the same kind and method, so a replay tolerates extra list calls or
+// reconnections. Whenever the live traffic diverges from the cassette (a
+// request with other arguments, a reply that changed, a request that was
+// never recorded or a recording that was never requested) a [Diff] is kept
+// and [Cassette.Report] prints them, with the JSON paths that changed. This
+// shows, for instance, that a new model no longer passes the same idOrder to
+// the getOrder tool.
+//
+// Only bodies are recorded: HTTP headers, and with them API keys, are never
+// written to the cassette. Requests and notifications that the MCP server
+// sends to the client are not recorded either.
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects what a [Cassette] does with the traffic.
+type Mode int
+
+const (
+	// ModeReplay serves the recorded responses without contacting the LLM
+	// or the MCP server, and reports the requests that differ.
+	ModeReplay Mode = iota
+	// ModeRecord lets the traffic through and writes it to the cassette on
+	// [Cassette.Close].
+	ModeRecord
+	// ModeCompare lets the traffic through and reports where requests and
+	// responses differ from the cassette, which is left unchanged.
+	ModeCompare
+)
+
+// String returns the name accepted by [ParseMode].
+func (m Mode) String() string {
+	switch m {
+	case ModeReplay:
+		return "replay"
+	case ModeRecord:
+		return "record"
+	case ModeCompare:
+		return "compare"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// ParseMode parses "replay", "record" or "compare".
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "replay":
+		return ModeReplay, nil
+	case "record":
+		return ModeRecord, nil
+	case "compare":
+		return ModeCompare, nil
+	default:
+		return 0, fmt.Errorf("cassette: unknown mode %q", name)
+	}
+}
+
+// Kinds of [Interaction].
+const (
+	KindLLM = "llm"
+	KindMCP = "mcp"
+)
+
+// DefaultIgnore lists the JSON keys left out of the comparisons: values that
+// change on every run even when the behavior is the same.
+var DefaultIgnore = []string{"id", "created", "system_fingerprint", "usage", "tool_call_id", "created_at", "total_duration", "load_duration", "eval_duration", "prompt_eval_duration"}
+
+// ErrNotRecorded is returned, in replay mode, for a request with no
+// recorded interaction left to serve it.
+var ErrNotRecorded = errors.New("cassette: request not recorded")
+
+// version is the format of the cassette file.
+const version = 1
+
+// Interaction is one recorded exchange.
+type Interaction struct {
+	// Kind is KindLLM for an HTTP request to the model and KindMCP for a
+	// JSON-RPC request or notification sent to the MCP server.
+	Kind string `json:"kind"`
+	// Method is the HTTP method or the JSON-RPC method.
+	Method string `json:"method"`
+	// Path and Status are only set for HTTP requests.
+	Path        string `json:"path,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// Request is the HTTP body or the JSON-RPC params. Bodies that are not
+	// JSON, such as event streams, are kept as a JSON string.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Response is the HTTP body or the JSON-RPC result.
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error is the JSON-RPC error, when the call failed.
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+// Name identifies the interaction in reports, e.g. "POST /v1/chat/completions"
+// or "tools/call".
+func (i *Interaction) Name() string {
+	if i.Kind == KindLLM {
+		return i.Method + " " + i.Path
+	}
+	return i.Method
+}
+
+// Change is a value that differs between the cassette and the live traffic.
+type Change struct {
+	// Path is the JSON path of the value, e.g. arguments.idOrder.
+	Path     string `json:"path"`
+	Recorded string `json:"recorded"`
+	Live     string `json:"live"`
+}
+
+// Problems reported by a [Diff].
+const (
+	ProblemRequest     = "request differs"
+	ProblemResponse    = "response differs"
+	ProblemUnexpected  = "not in the cassette"
+	ProblemNotReplayed = "recorded but never requested"
+)
+
+// Diff is a divergence between the live traffic and the cassette.
+type Diff struct {
+	// Index is the position of the interaction in the cassette, -1 for a
+	// request that was not recorded.
+	Index   int      `json:"index"`
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Problem string   `json:"problem"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// file is the JSON document written to disk.
+type file struct {
+	Version      int           `json:"version"`
+	Recorded     time.Time     `json:"recorded"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Cassette records or replays the traffic of a client. It is safe for
+// concurrent use.
+type Cassette struct {
+	// Ignore lists the JSON keys skipped by the comparisons; it defaults to
+	// DefaultIgnore and may be changed before the cassette is used.
+	Ignore []string
+
+	path string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	dropped      map[int]bool // recorded interactions left out of the file
+	diffs        []Diff
+	closed       bool
+}
+
+// Open returns a cassette backed by the file at path. In ModeRecord the file
+// is created (or replaced) on Close; the other modes load it now.
+func Open(path string, mode Mode) (*Cassette, error) {
+	c := &Cassette{Ignore: DefaultIgnore, path: path, mode: mode}
+	if mode == ModeRecord {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cassette: %s: %w", path, err)
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("cassette: %s: unsupported version %d", path, f.Version)
+	}
+	c.interactions = f.Interactions
+	c.used = make([]bool, len(f.Interactions))
+	return c, nil
+}
+
+// Mode returns the mode the cassette was opened with.
+func (c *Cassette) Mode() Mode { return c.mode }
+
+// Path returns the file backing the cassette.
+func (c *Cassette) Path() string { return c.path }
+
+// Close ends the session. In ModeRecord it writes the cassette file; in the
+// other modes it reports the interactions that were never requested. Calling
+// Close again does nothing.
+func (c *Cassette) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if c.mode == ModeRecord {
+		data, err := json.MarshalIndent(file{Version: version, Recorded: time.Now().UTC(), Interactions: c.kept()}, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(c.path, append(data, '\n'), 0o644)
+	}
+
+	for i, used := range c.used {
+		if !used {
+			in := &c.interactions[i]
+			c.diffs = append(c.diffs, Diff{Index: i, Kind: in.Kind, Name: in.Name(), Problem: ProblemNotReplayed})
+		}
+	}
+	return nil
+}
+
+// Diffs returns the divergences found so far.
+func (c *Cassette) Diffs() []Diff {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Diff(nil), c.diffs...)
+}
+
+// Report writes a readable list of the divergences to w. It is meant to be
+// called after Close, so that interactions never requested are included.
+func (c *Cassette) Report(w io.Writer) error {
+	diffs := c.Diffs()
+	if c.mode == ModeRecord {
+		_, err := fmt.Fprintf(w, "cassette %s: %d interactions recorded\n", c.path, c.Len())
+		return err
+	}
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintf(w, "cassette %s: no differences\n", c.path)
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "cassette %s: %d differences\n", c.path, len(diffs))
+	for _, d := range diffs {
+		index := "-"
+		if d.Index >= 0 {
+			index = fmt.Sprint(d.Index)
+		}
+		fmt.Fprintf(&b, "  #%s %s %s: %s\n", index, d.Kind, d.Name, d.Problem)
+		for _, ch := range d.Changes {
+			fmt.Fprintf(&b, "      %s: %s -> %s\n", ch.Path, ch.Recorded, ch.Live)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Len returns the number of interactions in the cassette.
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == ModeRecord {
+		return len(c.kept())
+	}
+	return len(c.interactions)
+}
+
+// record appends a new interaction and returns its index.
+func (c *Cassette) record(in Interaction) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, in)
+	return len(c.interactions) - 1
+}
+
+// drop leaves the interaction at index out of the cassette, for a request
+// that got no response. The indices of the other interactions are kept.
+func (c *Cassette) drop(index int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dropped == nil {
+		c.dropped = make(map[int]bool)
+	}
+	c.dropped[index] = true
+}
+
+// kept returns the interactions that were not dropped, leaving out as well
+// the HTTP requests whose response body was never read nor closed, and so
+// never completed.
+func (c *Cassette) kept() []Interaction {
+	kept := make([]Interaction, 0, len(c.interactions))
+	for i, in := range c.interactions {
+		if !c.dropped[i] && (in.Kind != KindLLM || in.Status != 0) {
+			kept = append(kept, in)
+		}
+	}
+	return kept
+}
+
+// complete fills the response of the interaction at index once it arrives.
+func (c *Cassette) complete(index int, fill func(*Interaction)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fill(&c.interactions[index])
+}
+
+// match finds the first unused interaction of the given kind and method,
+// marks it used and compares its request with the live one. It returns the
+// index and a copy of the interaction, or -1 when there is none left, which
+// is reported as unexpected.
+func (c *Cassette) match(kind, method, path string, request json.RawMessage) (int, Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.interactions {
+		in := c.interactions[i]
+		if c.used[i] || in.Kind != kind || in.Method != method || in.Path != path {
+			continue
+		}
+		c.used[i] = true
+		if changes := compare(in.Request, request, c.Ignore); len(changes) > 0 {
+			c.diffs = append(c.diffs, Diff{Index: i, Kind: kind, Name: in.Name(), Problem: ProblemRequest, Changes: changes})
+		}
+		return i, in
+	}
+
+	in := Interaction{Kind: kind, Method: method, Path: path}
+	c.diffs = append(c.diffs, Diff{Index: -1, Kind: kind, Name: in.Name(), Problem: ProblemUnexpected})
+	return -1, in
+}
+
+// compareResponse reports a live response that differs from the recorded
+// interaction at index.
+func (c *Cassette) compareResponse(index int, live Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	in := c.interactions[index]
+	changes := compare(in.Response, live.Response, c.Ignore)
+	changes = append(changes, compare(in.Error, live.Error, c.Ignore)...)
+	if in.Status != live.Status {
+		changes = append(changes, Change{Path: "status", Recorded: fmt.Sprint(in.Status), Live: fmt.Sprint(live.Status)})
+	}
+	if len(changes) > 0 {
+		c.diffs = append(c.diffs, Diff{Index: index, Kind: in.Kind, Name: in.Name(), Problem: ProblemResponse, Changes: changes})
+	}
+}
+
+// body converts an HTTP body for storage: JSON as is, anything else as a
+// JSON string.
+func body(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	s, _ := json.Marshal(string(data))
+	return s
+}
+
+// unbody reverses [body].
+func unbody(raw json.RawMessage) []byte {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
@@ -0,0 +1,170 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxChanges caps the changes kept for one interaction; streamed replies of
+// another model easily differ in every chunk.
+const maxChanges = 20
+
+// maxValue caps the length of the values shown in a [Change].
+const maxValue = 120
+
+// compare returns the values that differ between a recorded and a live body.
+// Event streams and newline delimited JSON are compared event by event, and
+// strings holding JSON (such as tool call arguments) are compared field by
+// field, so that the paths point at the values that actually changed.
+func compare(recorded, live json.RawMessage, ignore []string) []Change {
+	if bytes.Equal(recorded, live) {
+		return nil
+	}
+	var changes []Change
+	diffValues("", decode(unbody(recorded)), decode(unbody(live)), ignore, &changes)
+	if len(changes) > maxChanges {
+		more := len(changes) - maxChanges
+		changes = append(changes[:maxChanges], Change{Path: "...", Recorded: fmt.Sprintf("%d more", more), Live: fmt.Sprintf("%d more", more)})
+	}
+	return changes
+}
+
+// decode turns a body into a JSON value: a document, a list with the events
+// of a stream, or the plain text.
+func decode(data []byte) any {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	var v any
+	if json.Unmarshal(data, &v) == nil {
+		return v
+	}
+
+	var events []any
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "data:") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		} else if strings.Contains(line, ":") && !strings.HasPrefix(line, "{") {
+			// other SSE fields (event:, id:, comments)
+			continue
+		}
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		var event any
+		if json.Unmarshal([]byte(line), &event) != nil {
+			return string(data)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// diffValues appends to changes the differences between a and b under path.
+func diffValues(path string, a, b any, ignore []string, changes *[]Change) {
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			diffObjects(path, a, b, ignore, changes)
+			return
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			for i := 0; i < max(len(a), len(b)); i++ {
+				var x, y any = missing{}, missing{}
+				if i < len(a) {
+					x = a[i]
+				}
+				if i < len(b) {
+					y = b[i]
+				}
+				diffValues(fmt.Sprintf("%s[%d]", path, i), x, y, ignore, changes)
+			}
+			return
+		}
+	case string:
+		if b, ok := b.(string); ok && a != b {
+			// tool call arguments and tool results are JSON inside a string
+			if x, y, ok := embedded(a, b); ok {
+				diffValues(path, x, y, ignore, changes)
+				return
+			}
+		}
+	}
+
+	if !equal(a, b) {
+		*changes = append(*changes, Change{Path: strings.TrimPrefix(path, "."), Recorded: show(a), Live: show(b)})
+	}
+}
+
+func diffObjects(path string, a, b map[string]any, ignore []string, changes *[]Change) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if slices.Contains(ignore, k) {
+			continue
+		}
+		x, ok := a[k]
+		if !ok {
+			x = missing{}
+		}
+		y, ok := b[k]
+		if !ok {
+			y = missing{}
+		}
+		diffValues(path+"."+k, x, y, ignore, changes)
+	}
+}
+
+// embedded decodes two strings that both hold a JSON object or array.
+func embedded(a, b string) (any, any, bool) {
+	var x, y any
+	if !isDocument(a) || !isDocument(b) || json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return nil, nil, false
+	}
+	return x, y, true
+}
+
+func isDocument(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")
+}
+
+// missing stands for a key or element present on one side only.
+type missing struct{}
+
+func equal(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	_, am := a.(missing)
+	_, bm := b.(missing)
+	return am == bm && bytes.Equal(x, y)
+}
+
+// show renders a value for a report.
+func show(v any) string {
+	if _, ok := v.(missing); ok {
+		return "(missing)"
+	}
+	data, _ := json.Marshal(v)
+	s := string(data)
+	if len(s) > maxValue {
+		s = s[:maxValue] + "..."
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		recorded, live string
+		ignore         []string
+		want           []Change
+	}{
+		{
+			name:     "equal",
+			recorded: `{"a":1}`,
+			live:     `{"a":1}`,
+		},
+		{
+			name:     "nested",
+			recorded: `{"order":{"lines":[{"sku":"A","qty":1},{"sku":"B","qty":2}]}}`,
+			live:     `{"order":{"lines":[{"sku":"A","qty":3}],"status":"open"}}`,
+			want: []Change{
+				{Path: "order.lines[0].qty", Recorded: "1", Live: "3"},
+				{Path: "order.lines[1]", Recorded: `{"qty":2,"sku":"B"}`, Live: "(missing)"},
+				{Path: "order.status", Recorded: "(missing)", Live: `"open"`},
+			},
+		},
+		{
+			name:     "sse",
+			recorded: "data: {\"delta\":\"Hel\"}\n\ndata: {\"delta\":\"lo\"}\n\ndata: [DONE]\n\n",
+			live:     "event: message\ndata: {\"delta\":\"Hel\"}\n\ndata: {\"delta\":\"p\"}\n\ndata: [DONE]\n\n",
+			want:     []Change{{Path: "[1].delta", Recorded: `"lo"`, Live: `"p"`}},
+		},
+		{
+			name:     "ndjson",
+			recorded: "{\"done\":false}\n{\"done\":true}\n",
+			live:     "{\"done\":false}\n{\"done\":false}\n{\"done\":true}\n",
+			want: []Change{
+				{Path: "[1].done", Recorded: "true", Live: "false"},
+				{Path: "[2]", Recorded: "(missing)", Live: `{"done":true}`},
+			},
+		},
+		{
+			name:     "json in a string",
+			recorded: `{"arguments":"{\"idOrder\":\"42\",\"full\":true}"}`,
+			live:     `{"arguments":"{\"full\":true,\"idOrder\":\"43\"}"}`,
+			want:     []Change{{Path: "arguments.idOrder", Recorded: `"42"`, Live: `"43"`}},
+		},
+		{
+			name:     "plain string",
+			recorded: `{"text":"order 42"}`,
+			live:     `{"text":"order 43"}`,
+			want:     []Change{{Path: "text", Recorded: `"order 42"`, Live: `"order 43"`}},
+		},
+		{
+			name:     "ignored keys",
+			recorded: `{"id":"a","usage":{"total_tokens":10},"choices":[{"id":"x","text":"hi"}]}`,
+			live:     `{"id":"b","usage":{"total_tokens":12},"choices":[{"id":"y","text":"hi"}]}`,
+			ignore:   DefaultIgnore,
+		},
+		{
+			name:     "plain text",
+			recorded: "upstream timed out",
+			live:     "bad gateway",
+			want:     []Change{{Path: "", Recorded: `"upstream timed out"`, Live: `"bad gateway"`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compare(body([]byte(tt.recorded)), body([]byte(tt.live)), tt.ignore)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compare =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareTruncates(t *testing.T) {
+	var recorded, live []string
+	for i := range maxChanges + 5 {
+		recorded = append(recorded, fmt.Sprintf("data: {\"n\":%d}\n", i))
+		live = append(live, fmt.Sprintf("data: {\"n\":%d}\n", -i-1))
+	}
+	got := compare(body([]byte(strings.Join(recorded, "\n"))), body([]byte(strings.Join(live, "\n"))), nil)
+	if len(got) != maxChanges+1 {
+		t.Fatalf("%d changes, want %d", len(got), maxChanges+1)
+	}
+	if last := got[maxChanges]; last != (Change{Path: "...", Recorded: "5 more", Live: "5 more"}) {
+		t.Errorf("last change = %+v, want the count of the others", last)
+	}
+
+	long := strings.Repeat("x", 2*maxValue)
+	got = compare(body([]byte(`{"a":"`+long+`"}`)), body([]byte(`{"a":1}`)), nil)
+	want, _ := json.Marshal(long)
+	if len(got) != 1 || got[0].Recorded != string(want[:maxValue])+"..." {
+		t.Errorf("long value shown as %+v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HTTPClient returns a client whose requests go through the cassette; the
+// requests that are let through use the transport of base, or
+// http.DefaultTransport when base is nil. Set it as the HTTPClient of an
+// llm.Config to record or replay the conversation with the model.
+func (c *Cassette) HTTPClient(base *http.Client) *http.Client {
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+	client.Transport = c.RoundTripper(client.Transport)
+	return client
+}
+
+// RoundTripper wraps next, or http.DefaultTransport when nil, so that its
+// requests go through the cassette.
+func (c *Cassette) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{cassette: c, next: next}
+}
+
+type roundTripper struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	c := t.cassette
+	switch c.mode {
+	case ModeReplay:
+		index, in := c.match(KindLLM, req.Method, req.URL.Path, body(reqBody))
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL.Path)
+		}
+		resp := &http.Response{
+			Status:     fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			StatusCode: in.Status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewReader(unbody(in.Response))),
+			Request:    req,
+		}
+		if in.ContentType != "" {
+			resp.Header.Set("Content-Type", in.ContentType)
+		}
+		return resp, nil
+
+	case ModeRecord:
+		// recorded before the request is sent, to keep the order of
+		// concurrent requests, and dropped if it gets no response
+		index := c.record(Interaction{Kind: KindLLM, Method: req.Method, Path: req.URL.Path, Request: body(reqBody)})
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			c.drop(index)
+			return nil, err
+		}
+		resp.Body = tee(resp.Body, func(data []byte) {
+			c.complete(index, func(in *Interaction) {
+				in.Status, in.ContentType, in.Response = resp.StatusCode, resp.Header.Get("Content-Type"), body(data)
+			})
+		})
+		return resp, nil
+
+	default:
+		index, _ := c.match(KindLLM, req.Method, req.URL.Path, body(reqBody))
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || index < 0 {
+			return resp, err
+		}
+		resp.Body = tee(resp.Body, func(data []byte) {
+			c.compareResponse(index, Interaction{Status: resp.StatusCode, Response: body(data)})
+		})
+		return resp, nil
+	}
+}
+
+// tee returns a body that keeps a copy of what is read from rc and hands it
+// to done at the end of the body or when it is closed, whichever comes first.
+// Streamed replies still reach the caller chunk by chunk.
+func tee(rc io.ReadCloser, done func([]byte)) io.ReadCloser {
+	return &teeBody{ReadCloser: rc, done: done}
+}
+
+type teeBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *teeBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *teeBody) finish() {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+}
@@ -0,0 +1,118 @@
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// flakyTransport fails its first request and sends the others to next.
+type flakyTransport struct {
+	next   http.RoundTripper
+	failed bool
+}
+
+var errFlaky = errors.New("connection reset")
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.failed {
+		t.failed = true
+		return nil, errFlaky
+	}
+	return t.next.RoundTrip(req)
+}
+
+// A request that got no response is left out of the cassette.
+func TestRecordDropsFailedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"answer":42}`)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	c, err := Open(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := c.HTTPClient(&http.Client{Transport: &flakyTransport{next: http.DefaultTransport}})
+	post := func() (*http.Response, error) {
+		return client.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"question":"?"}`))
+	}
+	if _, err := post(); !errors.Is(err, errFlaky) {
+		t.Fatalf("first request: %v, want %v", err, errFlaky)
+	}
+	resp, err := post()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 1 {
+		t.Fatalf("%d interactions on disk, want 1", n)
+	}
+	resp, err = c.HTTPClient(nil).Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"question":"?"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answer struct{ Answer int }
+	err = json.NewDecoder(resp.Body).Decode(&answer)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || answer.Answer != 42 {
+		t.Errorf("replayed %d %+v, %v, want 200 and the answer 42", resp.StatusCode, answer, err)
+	}
+	c.Close()
+	if diffs := c.Diffs(); len(diffs) != 0 {
+		t.Errorf("replay diffs: %+v", diffs)
+	}
+}
+
+// A response whose body was never read nor closed did not complete, and is
+// left out of the cassette as well.
+func TestRecordDropsUnreadResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"answer":42}`)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	c, err := Open(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.HTTPClient(nil).Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len = %d before the body is read, want 0", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	c, err = Open(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("%d interactions on disk, want 0", n)
+	}
+}
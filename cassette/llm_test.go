@@ -0,0 +1,100 @@
+package cassette
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mcp/llm"
+	"mcp/llm/llmtest"
+)
+
+// chat asks the model through the cassette, with baseURL as the server.
+func chat(t *testing.T, c *Cassette, baseURL, question string) *llm.Message {
+	t.Helper()
+	provider, err := llm.New(llm.Config{BaseURL: baseURL + "/v1", Model: "fake", HTTPClient: c.HTTPClient(nil), Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	reply, err := provider.Chat(ctx, []llm.Message{{Role: "user", Content: question}}, nil)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	return reply
+}
+
+// recordLLM records a question about order 42 to the fake model, and returns
+// the cassette and the address the server had.
+func recordLLM(t *testing.T) (string, string) {
+	t.Helper()
+	handler, err := llmtest.NewHandler(
+		llmtest.CallTool("order 42", "getOrder", `{"idOrder":"42"}`),
+		llmtest.Reply(".", "I cannot help with that."),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := open(t, path, ModeRecord)
+	reply := chat(t, c, server.URL, "Where is order 42?")
+	if len(reply.ToolCalls) != 1 || reply.ToolCalls[0].Function.Name != "getOrder" {
+		t.Fatalf("recorded reply = %+v, want a getOrder call", reply)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, server.URL
+}
+
+func TestReplayLLM(t *testing.T) {
+	// the server is gone: the replies come from the cassette alone
+	path, url := recordLLM(t)
+
+	for range 2 {
+		c := open(t, path, ModeReplay)
+		reply := chat(t, c, url, "Where is order 42?")
+		if len(reply.ToolCalls) != 1 || reply.ToolCalls[0].Function.Name != "getOrder" || reply.ToolCalls[0].Function.Arguments != `{"idOrder":"42"}` {
+			t.Errorf("replayed reply = %+v, want the recorded getOrder call", reply)
+		}
+		c.Close()
+		if diffs := c.Diffs(); len(diffs) != 0 {
+			t.Errorf("diffs of an identical replay: %+v", diffs)
+		}
+	}
+}
+
+func TestReplayLLMChangedRequest(t *testing.T) {
+	path, url := recordLLM(t)
+
+	c := open(t, path, ModeReplay)
+	chat(t, c, url, "Where is order 43?")
+	c.Close()
+
+	diffs := c.Diffs()
+	if len(diffs) != 1 {
+		t.Fatalf("diffs = %+v, want one", diffs)
+	}
+	d := diffs[0]
+	if d.Kind != KindLLM || d.Name != "POST /v1/chat/completions" || d.Problem != ProblemRequest {
+		t.Errorf("diff = %+v", d)
+	}
+	want := Change{Path: "messages[0].content", Recorded: `"Where is order 42?"`, Live: `"Where is order 43?"`}
+	if len(d.Changes) != 1 || d.Changes[0] != want {
+		t.Errorf("changes = %+v, want %+v", d.Changes, want)
+	}
+
+	var report strings.Builder
+	if err := c.Report(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), `messages[0].content: "Where is order 42?" -> "Where is order 43?"`) {
+		t.Errorf("report lacks the change:\n%s", report.String())
+	}
+}
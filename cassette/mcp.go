@@ -0,0 +1,235 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// codeNotRecorded is the JSON-RPC error code of replies to requests missing
+// from the cassette.
+const codeNotRecorded = -32603
+
+// Transport wraps t so that the JSON-RPC traffic of its connections goes
+// through the cassette. In ModeReplay t is never used and may be nil: the
+// connections answer from the cassette, and can be opened again as often as
+// needed, so a reconnecting session replays as well.
+func (c *Cassette) Transport(t mcp.Transport) mcp.Transport {
+	return &transport{cassette: c, next: t}
+}
+
+type transport struct {
+	cassette *Cassette
+	next     mcp.Transport
+}
+
+func (t *transport) Connect(ctx context.Context) (mcp.Connection, error) {
+	if t.cassette.mode == ModeReplay {
+		return &replayConn{cassette: t.cassette, incoming: make(chan jsonrpc.Message, 16), done: make(chan struct{})}, nil
+	}
+	conn, err := t.next.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{Connection: conn, cassette: t.cassette, pending: make(map[any]int)}, nil
+}
+
+// wire is a JSON-RPC message as encoded on the wire.
+type wire struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func encode(msg jsonrpc.Message) (wire, error) {
+	var w wire
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return w, err
+	}
+	err = json.Unmarshal(data, &w)
+	return w, err
+}
+
+// recordConn passes the messages to the real connection, recording (or, in
+// ModeCompare, comparing) the requests of the client and the responses of
+// the server.
+type recordConn struct {
+	mcp.Connection
+	cassette *Cassette
+
+	mu      sync.Mutex
+	pending map[any]int // request id -> interaction, -1 when not tracked
+}
+
+func (c *recordConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	req, ok := msg.(*jsonrpc.Request)
+	if !ok {
+		return c.Connection.Write(ctx, msg)
+	}
+	w, err := encode(req)
+	if err != nil {
+		return err
+	}
+
+	// recorded before the request is sent, so that the response cannot
+	// arrive first
+	var index int
+	if c.cassette.mode == ModeRecord {
+		index = c.cassette.record(Interaction{Kind: KindMCP, Method: req.Method, Request: w.Params})
+	} else {
+		index, _ = c.cassette.match(KindMCP, req.Method, "", w.Params)
+	}
+	if req.IsCall() {
+		c.mu.Lock()
+		c.pending[req.ID.Raw()] = index
+		c.mu.Unlock()
+	}
+
+	if err := c.Connection.Write(ctx, msg); err != nil {
+		if req.IsCall() {
+			c.mu.Lock()
+			delete(c.pending, req.ID.Raw())
+			c.mu.Unlock()
+		}
+		c.drop(index)
+		return err
+	}
+	return nil
+}
+
+func (c *recordConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	msg, err := c.Connection.Read(ctx)
+	if err != nil {
+		c.dropPending()
+		return msg, err
+	}
+	resp, ok := msg.(*jsonrpc.Response)
+	if !ok {
+		return msg, nil
+	}
+
+	c.mu.Lock()
+	index, ok := c.pending[resp.ID.Raw()]
+	delete(c.pending, resp.ID.Raw())
+	c.mu.Unlock()
+	if !ok || index < 0 {
+		return msg, nil
+	}
+
+	w, err := encode(resp)
+	if err != nil {
+		return msg, nil
+	}
+	if c.cassette.mode == ModeRecord {
+		c.cassette.complete(index, func(in *Interaction) { in.Response, in.Error = w.Result, w.Error })
+	} else {
+		c.cassette.compareResponse(index, Interaction{Response: w.Result, Error: w.Error})
+	}
+	return msg, nil
+}
+
+func (c *recordConn) Close() error {
+	err := c.Connection.Close()
+	c.dropPending()
+	return err
+}
+
+// drop leaves out of the cassette the recorded interaction at index, which
+// got no response. Interactions being compared are left alone.
+func (c *recordConn) drop(index int) {
+	if c.cassette.mode == ModeRecord && index >= 0 {
+		c.cassette.drop(index)
+	}
+}
+
+// dropPending drops the calls still waiting for a response, which will never
+// come once the connection failed or closed. Replaying them would turn a
+// failed call into an empty success.
+func (c *recordConn) dropPending() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[any]int)
+	c.mu.Unlock()
+
+	for _, index := range pending {
+		c.drop(index)
+	}
+}
+
+// replayConn answers the requests of the client from the cassette.
+type replayConn struct {
+	cassette *Cassette
+	incoming chan jsonrpc.Message
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (c *replayConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	req, ok := msg.(*jsonrpc.Request)
+	if !ok {
+		// responses to requests of the server, which are not replayed
+		return nil
+	}
+	w, err := encode(req)
+	if err != nil {
+		return err
+	}
+	index, in := c.cassette.match(KindMCP, req.Method, "", w.Params)
+	if !req.IsCall() {
+		return nil
+	}
+
+	reply := map[string]any{"jsonrpc": "2.0", "id": req.ID.Raw()}
+	switch {
+	case index < 0:
+		reply["error"] = map[string]any{"code": codeNotRecorded, "message": fmt.Sprintf("%v: %s", ErrNotRecorded, req.Method)}
+	case len(in.Error) > 0:
+		reply["error"] = in.Error
+	case len(in.Response) > 0:
+		reply["result"] = in.Response
+	default:
+		reply["result"] = json.RawMessage("{}")
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	resp, err := jsonrpc.DecodeMessage(data)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c.incoming <- resp:
+		return nil
+	case <-c.done:
+		return mcp.ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *replayConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case msg := <-c.incoming:
+		return msg, nil
+	case <-c.done:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *replayConn) SessionID() string { return "" }
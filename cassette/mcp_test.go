@@ -0,0 +1,265 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const timeout = 5 * time.Second
+
+type orderArgs struct {
+	IDOrder string `json:"idOrder"`
+}
+
+// orderServer serves a getOrder tool, and a stuck tool that does not answer
+// until release is closed, even once its call is canceled.
+func orderServer(release <-chan struct{}) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "orders", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "getOrder"}, func(_ context.Context, _ *mcp.CallToolRequest, args orderArgs) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "order " + args.IDOrder}}}, nil, nil
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "stuck"}, func(context.Context, *mcp.CallToolRequest, orderArgs) (*mcp.CallToolResult, any, error) {
+		<-release
+		return nil, nil, errors.New("released")
+	})
+	return server
+}
+
+// connect starts a client session through the cassette, with a live server
+// unless the cassette replays.
+func connect(t *testing.T, c *Cassette) *mcp.ClientSession {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var next mcp.Transport
+	if c.Mode() != ModeReplay {
+		clientTransport, serverTransport := mcp.NewInMemoryTransports()
+		if _, err := orderServer(nil).Connect(ctx, serverTransport, nil); err != nil {
+			t.Fatal(err)
+		}
+		next = clientTransport
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil).Connect(ctx, c.Transport(next), nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	return session
+}
+
+func getOrder(t *testing.T, session *mcp.ClientSession, id string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "getOrder", Arguments: map[string]any{"idOrder": id}})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	return res.Content[0].(*mcp.TextContent).Text
+}
+
+// record records a session calling getOrder for 42.
+func record(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c, err := Open(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := connect(t, c)
+	if got := getOrder(t, session, "42"); got != "order 42" {
+		t.Fatalf("recorded getOrder = %q", got)
+	}
+	session.Close()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func open(t *testing.T, path string, mode Mode) *Cassette {
+	t.Helper()
+	c, err := Open(path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReplayMCP(t *testing.T) {
+	path := record(t)
+
+	for range 2 {
+		c := open(t, path, ModeReplay)
+		session := connect(t, c)
+		if got := getOrder(t, session, "42"); got != "order 42" {
+			t.Errorf("replayed getOrder = %q, want order 42", got)
+		}
+		session.Close()
+		c.Close()
+		if diffs := c.Diffs(); len(diffs) != 0 {
+			t.Errorf("diffs of an identical replay: %+v", diffs)
+		}
+	}
+}
+
+func TestReplayMCPChangedRequest(t *testing.T) {
+	path := record(t)
+
+	c := open(t, path, ModeReplay)
+	session := connect(t, c)
+	// the recorded reply is served anyway, and the change is reported
+	if got := getOrder(t, session, "43"); got != "order 42" {
+		t.Errorf("replayed getOrder = %q, want the recorded order 42", got)
+	}
+	session.Close()
+	c.Close()
+
+	diffs := c.Diffs()
+	if len(diffs) != 1 {
+		t.Fatalf("diffs = %+v, want one", diffs)
+	}
+	d := diffs[0]
+	if d.Kind != KindMCP || d.Name != "tools/call" || d.Problem != ProblemRequest || d.Index < 0 {
+		t.Errorf("diff = %+v", d)
+	}
+	if len(d.Changes) != 1 || d.Changes[0] != (Change{Path: "arguments.idOrder", Recorded: `"42"`, Live: `"43"`}) {
+		t.Errorf("changes = %+v, want arguments.idOrder 42 -> 43", d.Changes)
+	}
+
+	var report strings.Builder
+	if err := c.Report(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1 differences", "mcp tools/call: request differs", `arguments.idOrder: "42" -> "43"`} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestReplayMCPUnexpectedAndUnused(t *testing.T) {
+	path := record(t)
+
+	c := open(t, path, ModeReplay)
+	session := connect(t, c)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// a call that was never recorded fails instead of returning nothing
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "stuck", Arguments: map[string]any{}}); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if _, err := session.ListTools(ctx, nil); err == nil || !strings.Contains(err.Error(), ErrNotRecorded.Error()) {
+		t.Errorf("ListTools = %v, want %v", err, ErrNotRecorded)
+	}
+	session.Close()
+	c.Close()
+
+	var problems []string
+	for _, d := range c.Diffs() {
+		problems = append(problems, d.Name+": "+d.Problem)
+	}
+	want := []string{"tools/call: request differs", "tools/list: " + ProblemUnexpected}
+	if got := strings.Join(problems, ", "); !strings.HasPrefix(got, strings.Join(want, ", ")) {
+		t.Errorf("diffs = %s, want %s", got, strings.Join(want, ", "))
+	}
+}
+
+// severedTransport lets a test cut the connection under a session, as when
+// the server goes away.
+type severedTransport struct {
+	mcp.Transport
+	conn mcp.Connection
+}
+
+func (t *severedTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	conn, err := t.Transport.Connect(ctx)
+	t.conn = conn
+	return conn, err
+}
+
+// A call without a response when the connection ends is left out of the
+// cassette, so that it does not replay as an empty success.
+func TestRecordDropsUnansweredCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := open(t, path, ModeRecord)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	if _, err := orderServer(release).Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	severed := &severedTransport{Transport: clientTransport}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil).Connect(ctx, c.Transport(severed), nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	getOrder(t, session, "42")
+
+	stuckCtx, stuckCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer stuckCancel()
+	if _, err := session.CallTool(stuckCtx, &mcp.CallToolParams{Name: "stuck", Arguments: map[string]any{"idOrder": "1"}}); err == nil {
+		t.Fatal("stuck call answered")
+	}
+	severed.conn.Close()
+	session.Wait()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = open(t, path, ModeReplay)
+	var calls []string
+	for _, in := range c.interactions {
+		if in.Method == "tools/call" {
+			calls = append(calls, string(in.Request))
+		}
+	}
+	if len(calls) != 1 || !strings.Contains(calls[0], "getOrder") {
+		t.Errorf("recorded calls = %s, want only getOrder", calls)
+	}
+}
+
+func TestCompareMCP(t *testing.T) {
+	path := record(t)
+
+	c := open(t, path, ModeCompare)
+	session := connect(t, c)
+	if got := getOrder(t, session, "43"); got != "order 43" {
+		t.Errorf("compared getOrder = %q, want the live order 43", got)
+	}
+	session.Close()
+	c.Close()
+
+	var request, response bool
+	for _, d := range c.Diffs() {
+		if d.Name != "tools/call" {
+			continue
+		}
+		switch d.Problem {
+		case ProblemRequest:
+			request = true
+		case ProblemResponse:
+			response = len(d.Changes) == 1 && d.Changes[0].Path == "content[0].text" && d.Changes[0].Live == `"order 43"`
+		}
+	}
+	if !request || !response {
+		t.Errorf("diffs = %+v, want the request and the response of tools/call", c.Diffs())
+	}
+
+	// the cassette is left as recorded
+	c = open(t, path, ModeReplay)
+	session = connect(t, c)
+	defer session.Close()
+	if got := getOrder(t, session, "42"); got != "order 42" {
+		t.Errorf("getOrder after compare = %q, want order 42", got)
+	}
+}
@@ -0,0 +1,65 @@
+// Command fake-llm é um servidor compatível com a API da OpenAI que responde
+// com respostas pré-definidas, para correr os exemplos sem um LLM (ex: em CI).
+//
+// As respostas vêm de regras num ficheiro JSON: cada regra tem uma expressão
+// regular aplicada à última mensagem e a resposta (texto e/ou tool calls),
+// que pode usar os grupos da expressão ($1, $2...):
+//
+//	fake-llm -addr 127.0.0.1:1234 -fixtures cmd/fake-llm/fixtures.json
+//
+// Os exemplos usam 127.0.0.1:1234 por omissão, por isso basta arrancá-lo em
+// vez do LM Studio. O fixtures.json ao lado cobre os prompts dos exemplos.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"mcp/llm/llmtest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:1234", "endereço HTTP do servidor")
+	fixtures := flag.String("fixtures", "cmd/fake-llm/fixtures.json", "ficheiro JSON com as regras de resposta")
+	verbose := flag.Bool("v", false, "regista cada pedido recebido")
+	flag.Parse()
+
+	rules, err := llmtest.LoadRules(*fixtures)
+	if err != nil {
+		log.Fatalf("Erro ao carregar as regras: %v", err)
+	}
+	handler, err := llmtest.NewHandler(rules...)
+	if err != nil {
+		log.Fatalf("Erro nas regras: %v", err)
+	}
+
+	if *verbose {
+		handler.OnRequest = func(req llmtest.Request) {
+			data, _ := json.Marshal(req)
+			log.Printf("%s %s", req.Path, data)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("LLM falso rodando em %s com %d regras...", *addr, len(rules))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Erro HTTP: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Command mcp-bridge liga um transporte stdio a um transporte TCP ou Unix
+// socket, encaminhando as mensagens MCP nos dois sentidos.
+//
+// Para expor um servidor remoto a um host que só sabe lançar servidores stdio:
+//
+//	mcp-bridge -connect 127.0.0.1:9000
+//	mcp-bridge -unix /tmp/order.sock
+//
+// Para expor um servidor stdio na rede (um processo por ligação):
+//
+//	mcp-bridge -listen :9000 -- go run ./6-order-client-server-ia-community/server.go
+//	mcp-bridge -listen-unix /tmp/order.sock -- ./server
+//
+// O stdout é o canal MCP, por isso tudo o que o bridge regista vai para stderr.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
+)
+
+var verbose bool
+
+func main() {
+	connect := flag.String("connect", "", "endereço TCP do servidor MCP remoto a expor em stdio")
+	socket := flag.String("unix", "", "Unix socket do servidor MCP remoto a expor em stdio")
+	listen := flag.String("listen", "", "endereço TCP onde expor o servidor stdio dado após --")
+	listenUnix := flag.String("listen-unix", "", "Unix socket onde expor o servidor stdio dado após --")
+	flag.BoolVar(&verbose, "v", false, "regista cada mensagem encaminhada")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "uso: %s (-connect addr | -unix path)\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "     %s (-listen addr | -listen-unix path) -- comando [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("mcp-bridge: ")
+
+	// Ctrl+C / SIGTERM fecham os dois lados de todas as ligações
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch {
+	case *connect != "":
+		err = serveStdio(ctx, &mcp.StdioTransport{}, tcp.NewTransport(*connect), *connect)
+	case *socket != "":
+		err = serveStdio(ctx, &mcp.StdioTransport{}, unix.NewTransport(*socket), *socket)
+	case *listen != "" || *listenUnix != "":
+		err = serveNetwork(ctx, *listen, *listenUnix, flag.Args())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serveStdio expõe o servidor remoto no transporte local, o stdin/stdout
+// deste processo
+func serveStdio(ctx context.Context, local, remote mcp.Transport, addr string) error {
+	remoteConn, err := remote.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("erro ao ligar a %s: %w", addr, err)
+	}
+	localConn, err := local.Connect(ctx)
+	if err != nil {
+		remoteConn.Close()
+		return err
+	}
+
+	log.Printf("stdio <-> %s", addr)
+	bridge(ctx, localConn, remoteConn, "stdio", addr)
+	return nil
+}
+
+// serveNetwork aceita ligações e lança uma instância do servidor stdio para
+// cada uma delas
+func serveNetwork(ctx context.Context, addr, socket string, command []string) error {
+	if len(command) == 0 {
+		return errors.New("falta o comando do servidor stdio, após --")
+	}
+
+	var (
+		listener net.Listener
+		err      error
+	)
+	if socket != "" {
+		listener, err = unix.Listen(socket, 0600)
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("a expor %q em %s", command, listener.Addr())
+
+	// Fecha o listener quando o processo recebe um sinal, o que termina o
+	// ciclo de Accept
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(ctx, conn, command)
+		}()
+	}
+}
+
+func serveConn(ctx context.Context, conn net.Conn, command []string) {
+	peer := conn.RemoteAddr().String()
+	remoteConn := tcp.NewConnection(conn)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	localConn, err := (&mcp.CommandTransport{Command: cmd}).Connect(ctx)
+	if err != nil {
+		log.Printf("%s: erro ao lançar o servidor: %v", peer, err)
+		remoteConn.Close()
+		return
+	}
+
+	log.Printf("%s <-> %s (pid %d)", peer, command[0], cmd.Process.Pid)
+	bridge(ctx, remoteConn, localConn, peer, command[0])
+}
+
+// bridge encaminha mensagens entre a e b até um dos lados fechar (ou ctx
+// terminar) e depois fecha os dois
+func bridge(ctx context.Context, a, b mcp.Connection, aName, bName string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, 2)
+	go func() { errc <- forward(ctx, a, b, aName+" -> "+bName) }()
+	go func() { errc <- forward(ctx, b, a, bName+" -> "+aName) }()
+
+	err := <-errc
+	cancel()
+	a.Close()
+	b.Close()
+	<-errc
+
+	if closedNormally(err) {
+		log.Printf("%s <-> %s: ligação terminada", aName, bName)
+	} else {
+		log.Printf("%s <-> %s: ligação terminada: %v", aName, bName, err)
+	}
+}
+
+// forward copia as mensagens lidas de from para to
+func forward(ctx context.Context, from, to mcp.Connection, direction string) error {
+	for {
+		msg, err := from.Read(ctx)
+		if err != nil {
+			return err
+		}
+		if verbose {
+			log.Printf("%s: %s", direction, describe(msg))
+		}
+		if err := to.Write(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// describe resume uma mensagem JSON-RPC para os logs
+func describe(msg jsonrpc.Message) string {
+	switch msg := msg.(type) {
+	case *jsonrpc.Request:
+		if !msg.ID.IsValid() {
+			return "notificação " + msg.Method
+		}
+		return fmt.Sprintf("pedido %s (id %v)", msg.Method, msg.ID.Raw())
+	case *jsonrpc.Response:
+		if msg.Error != nil {
+			return fmt.Sprintf("erro (id %v): %v", msg.ID.Raw(), msg.Error)
+		}
+		return fmt.Sprintf("resposta (id %v)", msg.ID.Raw())
+	default:
+		return fmt.Sprintf("%T", msg)
+	}
+}
+
+func closedNormally(err error) bool {
+	return err == nil ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, mcp.ErrConnectionClosed) ||
+		errors.Is(err, net.ErrClosed)
+}
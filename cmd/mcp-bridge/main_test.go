@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+	"mcp/transport/transporttest"
+	"mcp/transport/unix"
+)
+
+// stdioBridge corre serveStdio entre um transporte em memória, no lugar do
+// stdin/stdout, e um servidor TCP em loopback. Devolve a ponta do host, a do
+// servidor e o resultado de serveStdio.
+func stdioBridge(t *testing.T) (host, server mcp.Connection, done <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	t.Cleanup(cancel)
+	local, hostSide := mcp.NewInMemoryTransports()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serveStdio(ctx, local, tcp.NewTransport(listener.Addr().String()), listener.Addr().String())
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = tcp.NewConnection(conn)
+	t.Cleanup(func() { server.Close() })
+	host, err = hostSide.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { host.Close() })
+	return host, server, errc
+}
+
+// relay escreve msg em from e devolve o que chega a to
+func relay(t *testing.T, from, to mcp.Connection, msg jsonrpc.Message) jsonrpc.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	if err := from.Write(ctx, msg); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := to.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return got
+}
+
+func waitBridge(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveStdio = %v", err)
+		}
+	case <-time.After(transporttest.Timeout):
+		t.Fatal("the bridge did not end")
+	}
+}
+
+// checkClosed verifica que conn foi fechada do outro lado
+func checkClosed(t *testing.T, conn mcp.Connection, side string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	if msg, err := conn.Read(ctx); err == nil || ctx.Err() != nil {
+		t.Errorf("%s side read %v, %v; want the connection closed", side, msg, err)
+	}
+}
+
+func TestBridgeForwards(t *testing.T) {
+	host, server, _ := stdioBridge(t)
+
+	id, _ := jsonrpc.MakeID(float64(1))
+	got := relay(t, host, server, &jsonrpc.Request{ID: id, Method: "tools/list", Params: json.RawMessage(`{}`)})
+	if req, ok := got.(*jsonrpc.Request); !ok || req.Method != "tools/list" || req.ID != id {
+		t.Fatalf("server got %#v, want the tools/list request", got)
+	}
+
+	got = relay(t, server, host, &jsonrpc.Response{ID: id, Result: json.RawMessage(`{"tools":[]}`)})
+	if resp, ok := got.(*jsonrpc.Response); !ok || resp.ID != id || string(resp.Result) != `{"tools":[]}` {
+		t.Fatalf("host got %#v, want the response", got)
+	}
+
+	// as notificações do servidor também chegam ao host
+	got = relay(t, server, host, &jsonrpc.Request{Method: "notifications/tools/list_changed", Params: json.RawMessage(`{}`)})
+	if req, ok := got.(*jsonrpc.Request); !ok || req.Method != "notifications/tools/list_changed" || req.ID.IsValid() {
+		t.Fatalf("host got %#v, want the notification", got)
+	}
+}
+
+func TestBridgeStdioClosed(t *testing.T) {
+	host, server, done := stdioBridge(t)
+	host.Close()
+	waitBridge(t, done)
+	checkClosed(t, server, "tcp")
+}
+
+func TestBridgeTCPClosed(t *testing.T) {
+	host, server, done := stdioBridge(t)
+	server.Close()
+	waitBridge(t, done)
+	checkClosed(t, host, "stdio")
+}
+
+// serveNetwork liga cada ligação a um processo: com o cat, o que o cliente
+// envia volta para ele depois de passar pelo processo.
+func TestServeNetwork(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("no cat to run as the stdio server")
+	}
+	socket := filepath.Join(t.TempDir(), "bridge.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- serveNetwork(ctx, "", socket, []string{cat}) }()
+
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer dialCancel()
+	var conn mcp.Connection
+	for {
+		if conn, err = unix.NewTransport(socket).Connect(dialCtx); err == nil {
+			break
+		}
+		select {
+		case <-dialCtx.Done():
+			t.Fatalf("Connect: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	for i := range 2 {
+		id, _ := jsonrpc.MakeID(float64(i))
+		got := relay(t, conn, conn, &jsonrpc.Request{ID: id, Method: "ping"})
+		if req, ok := got.(*jsonrpc.Request); !ok || req.Method != "ping" || req.ID != id {
+			t.Fatalf("echo = %#v, want the ping %d", got, i)
+		}
+	}
+
+	// fechar o cliente termina o processo, e o sinal termina o servidor
+	conn.Close()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveNetwork = %v", err)
+		}
+	case <-time.After(transporttest.Timeout):
+		t.Fatal("serveNetwork did not end")
+	}
+}
@@ -0,0 +1,154 @@
+// Command mcp-gateway junta vários servidores MCP atrás de uma única sessão.
+//
+// Cada -upstream dá um nome (o namespace das tools, ex: orders.getOrder) e o
+// endereço do servidor:
+//
+//	mcp-gateway -addr :9100 \
+//		-upstream orders=tcp://127.0.0.1:9000 \
+//		-upstream greeter=unix:///tmp/greeter.sock \
+//		-upstream calc="cmd:go run ./6-order-client-server-ia-community/server.go"
+//
+// Com -stdio o gateway serve no stdin/stdout, para ser lançado por hosts (ou
+// pela UI) que só sabem usar servidores stdio.
+//
+// Endereços suportados: tcp://host:port, unix:///caminho, ws://host/mcp,
+// wss://host/mcp, http(s)://host/mcp (streamable HTTP) e cmd:comando args.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/gateway"
+	"mcp/transport/tcp"
+	"mcp/transport/unix"
+	"mcp/transport/websocket"
+)
+
+// upstreamFlags acumula os -upstream repetidos
+type upstreamFlags []gateway.Upstream
+
+func (f *upstreamFlags) String() string {
+	names := make([]string, len(*f))
+	for i, u := range *f {
+		names[i] = u.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *upstreamFlags) Set(value string) error {
+	name, target, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("esperado nome=endereço, recebido %q", value)
+	}
+	transport, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, gateway.Upstream{Name: name, Transport: transport})
+	return nil
+}
+
+// parseTarget escolhe o transporte a partir do endereço de um upstream
+func parseTarget(target string) (mcp.Transport, error) {
+	if command, ok := strings.CutPrefix(target, "cmd:"); ok {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("comando vazio em %q", target)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		return &mcp.CommandTransport{Command: cmd}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return tcp.NewTransport(u.Host), nil
+	case "unix":
+		return unix.NewTransport(u.Path), nil
+	case "ws", "wss":
+		return websocket.NewTransport(target), nil
+	case "http", "https":
+		return &mcp.StreamableClientTransport{Endpoint: target}, nil
+	default:
+		return nil, fmt.Errorf("endereço não suportado %q", target)
+	}
+}
+
+func main() {
+	var upstreams upstreamFlags
+	flag.Var(&upstreams, "upstream", "servidor a agregar, como nome=endereço (repetível)")
+	addr := flag.String("addr", ":9100", "endereço TCP onde servir o gateway")
+	stdio := flag.Bool("stdio", false, "serve o gateway no stdin/stdout em vez de TCP")
+	flag.Parse()
+
+	// Com -stdio, o stdout é o canal MCP e os logs vão para stderr
+	log.SetOutput(os.Stderr)
+
+	if len(upstreams) == 0 {
+		log.Fatal("indique pelo menos um -upstream")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// As sessões com os upstreams vivem enquanto ctx; o limite de 30s vale
+	// só para o initialize (um ctx com timeout cortava o stream dos
+	// upstreams http ao fim da ligação)
+	gw, err := gateway.New(ctx, upstreams, &gateway.Options{HandshakeTimeout: 30 * time.Second})
+	if err != nil {
+		log.Fatalf("Erro ao ligar aos upstreams: %v", err)
+	}
+	defer gw.Close()
+
+	for _, u := range upstreams {
+		log.Printf("upstream %s ligado", u.Name)
+	}
+
+	if *stdio {
+		if err := gw.Server().Run(ctx, &mcp.StdioTransport{}); err != nil && ctx.Err() == nil {
+			log.Printf("Erro MCP stdio: %v", err)
+		}
+		return
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Erro ao abrir listener: %v", err)
+	}
+	log.Printf("Gateway MCP rodando em %s...", listener.Addr())
+
+	srv := tcp.NewServer(gw.Server())
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			log.Printf("Erro MCP TCP: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	closed, err := srv.Shutdown(drainCtx)
+	if err != nil {
+		log.Printf("Tempo de drenagem esgotado: %v", err)
+	}
+	log.Printf("Gateway encerrado, %d sessões fechadas", closed)
+}
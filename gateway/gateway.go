@@ -0,0 +1,550 @@
+// Package gateway aggregates several MCP servers behind a single one.
+//
+// A [Gateway] connects as a client to every [Upstream] and exposes their
+// tools, prompts and resources on its own [mcp.Server], with the names
+// prefixed by the name of the upstream: the getOrder tool of the "orders"
+// upstream is served as "orders.getOrder". Calls are routed back to the
+// upstream that owns the feature, and the lists are refreshed whenever an
+// upstream reports that they changed, which in turn notifies the clients of
+// the gateway.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Separator joins the name of an upstream and the name of one of its tools
+// or prompts.
+const Separator = "."
+
+// Upstream is a server aggregated by a [Gateway].
+type Upstream struct {
+	// Name namespaces the features of the upstream. It must be unique and
+	// must not contain [Separator].
+	Name string
+	// Transport connects to the upstream.
+	Transport mcp.Transport
+}
+
+// Options configures a [Gateway]. The zero value is valid.
+type Options struct {
+	// Implementation identifies the gateway to its clients. It defaults to
+	// "mcp-gateway".
+	Implementation *mcp.Implementation
+	// ErrorLog receives upstream errors. The standard logger is used when nil.
+	ErrorLog *log.Logger
+	// HandshakeTimeout bounds the initialize handshake with each upstream
+	// and the first listing of its features. Zero means no limit. Unlike a
+	// deadline on the context given to [New], it leaves the sessions
+	// running once connected.
+	HandshakeTimeout time.Duration
+}
+
+// Gateway serves the features of its upstreams on a single [mcp.Server].
+type Gateway struct {
+	server    *mcp.Server
+	upstreams []*upstream
+	errorLog  *log.Logger
+	timeout   time.Duration // handshake timeout
+
+	mu        sync.Mutex
+	resources map[string]*upstream // resource URI to the upstream serving it
+	templates map[string]*upstream // URI template to the upstream serving it
+
+	closed atomic.Bool
+}
+
+// Namespace returns the name under which the gateway exposes the tool or
+// prompt name of upstream.
+func Namespace(upstream, name string) string {
+	return upstream + Separator + name
+}
+
+// New connects to every upstream and returns a gateway serving their
+// features. It fails if any upstream cannot be reached; an upstream that
+// disconnects later has its features removed. The sessions with the
+// upstreams last as long as ctx, so ctx should not carry a deadline meant
+// for connecting: use [Options.HandshakeTimeout] instead.
+func New(ctx context.Context, upstreams []Upstream, opts *Options) (*Gateway, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	impl := opts.Implementation
+	if impl == nil {
+		impl = &mcp.Implementation{Name: "mcp-gateway", Version: "v1.0.0"}
+	}
+
+	g := &Gateway{
+		// The lists start empty and are filled as upstreams connect, so the
+		// capabilities are announced up front.
+		server: mcp.NewServer(impl, &mcp.ServerOptions{
+			HasTools:     true,
+			HasPrompts:   true,
+			HasResources: true,
+		}),
+		errorLog:  opts.ErrorLog,
+		timeout:   opts.HandshakeTimeout,
+		resources: make(map[string]*upstream),
+		templates: make(map[string]*upstream),
+	}
+
+	names := make(map[string]bool)
+	for _, up := range upstreams {
+		switch {
+		case up.Name == "" || strings.Contains(up.Name, Separator):
+			return nil, fmt.Errorf("gateway: invalid upstream name %q", up.Name)
+		case names[up.Name]:
+			return nil, fmt.Errorf("gateway: duplicate upstream name %q", up.Name)
+		}
+		names[up.Name] = true
+		g.upstreams = append(g.upstreams, &upstream{gateway: g, name: up.Name})
+	}
+
+	for i, u := range g.upstreams {
+		if err := u.connect(ctx, upstreams[i].Transport); err != nil {
+			g.Close()
+			return nil, fmt.Errorf("gateway: upstream %s: %w", u.name, err)
+		}
+	}
+	return g, nil
+}
+
+// Server returns the server to run on the transports of the gateway clients.
+func (g *Gateway) Server() *mcp.Server {
+	return g.server
+}
+
+// Close closes the sessions with every upstream.
+func (g *Gateway) Close() error {
+	g.closed.Store(true)
+
+	var errs []error
+	for _, u := range g.upstreams {
+		if s := u.getSession(); s != nil {
+			if err := s.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Gateway) logf(format string, args ...any) {
+	if g.errorLog != nil {
+		g.errorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// upstream is the session of the gateway with one server, and the features
+// of that server currently registered on the gateway.
+type upstream struct {
+	gateway *Gateway
+	name    string
+
+	mu      sync.Mutex
+	session *mcp.ClientSession
+
+	// syncMu serializes the refreshes of the feature lists below.
+	syncMu    sync.Mutex
+	tools     []string // exposed names
+	prompts   []string // exposed names
+	resources []string // URIs
+	templates []string // URI templates
+}
+
+func (u *upstream) connect(ctx context.Context, transport mcp.Transport) error {
+	// Notifications are handled synchronously by the session, and refreshing
+	// the lists needs to call the upstream back, so it runs on its own.
+	client := mcp.NewClient(&mcp.Implementation{Name: "mcp-gateway", Version: "v1.0.0"}, &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) {
+			go u.syncTools(context.Background())
+		},
+		PromptListChangedHandler: func(context.Context, *mcp.PromptListChangedRequest) {
+			go u.syncPrompts(context.Background())
+		},
+		ResourceListChangedHandler: func(context.Context, *mcp.ResourceListChangedRequest) {
+			go u.syncResources(context.Background())
+		},
+	})
+
+	// The session keeps ctx, which the streamable HTTP transport uses for
+	// its stream, so the timeout closes the connection instead.
+	var handshake *handshakeTransport
+	if timeout := u.gateway.timeout; timeout > 0 {
+		handshake = &handshakeTransport{Transport: transport}
+		transport = handshake
+		handshake.start(timeout)
+	}
+	session, err := client.Connect(ctx, transport, nil)
+	if handshake != nil && !handshake.stop() {
+		if session != nil {
+			session.Close()
+		}
+		return fmt.Errorf("no answer to initialize within %v", u.gateway.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	u.session = session
+	u.mu.Unlock()
+
+	syncCtx := ctx
+	if u.gateway.timeout > 0 {
+		var cancel context.CancelFunc
+		syncCtx, cancel = context.WithTimeout(ctx, u.gateway.timeout)
+		defer cancel()
+	}
+	u.syncTools(syncCtx)
+	u.syncPrompts(syncCtx)
+	u.syncResources(syncCtx)
+
+	go func() {
+		err := session.Wait()
+		u.mu.Lock()
+		u.session = nil
+		u.mu.Unlock()
+		u.removeAll()
+		if err != nil && !u.gateway.closed.Load() && !errors.Is(err, mcp.ErrConnectionClosed) {
+			u.gateway.logf("gateway: upstream %s disconnected: %v", u.name, err)
+		}
+	}()
+	return nil
+}
+
+// handshakeTransport closes the connection made by its Transport if stop is
+// not called within the timeout given to start.
+type handshakeTransport struct {
+	mcp.Transport
+	timer *time.Timer
+
+	mu      sync.Mutex
+	conn    mcp.Connection
+	expired bool
+}
+
+func (t *handshakeTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	conn, err := t.Transport.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expired {
+		conn.Close()
+		return nil, mcp.ErrConnectionClosed
+	}
+	t.conn = conn
+	return conn, nil
+}
+
+func (t *handshakeTransport) start(timeout time.Duration) {
+	t.timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.expired = true
+		if t.conn != nil {
+			t.conn.Close()
+		}
+	})
+}
+
+// stop cancels the timeout. It reports false if the connection was closed
+// already.
+func (t *handshakeTransport) stop() bool {
+	t.timer.Stop()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.expired
+}
+
+func (u *upstream) getSession() *mcp.ClientSession {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.session
+}
+
+func (u *upstream) capabilities() *mcp.ServerCapabilities {
+	s := u.getSession()
+	if s == nil || s.InitializeResult() == nil || s.InitializeResult().Capabilities == nil {
+		return &mcp.ServerCapabilities{}
+	}
+	return s.InitializeResult().Capabilities
+}
+
+var errDisconnected = errors.New("gateway: upstream disconnected")
+
+func (u *upstream) syncTools(ctx context.Context) {
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+
+	session := u.getSession()
+	if session == nil || u.capabilities().Tools == nil {
+		return
+	}
+
+	var names []string
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			// the list is incomplete: nothing is removed, and the tools
+			// added so far are kept track of
+			u.gateway.logf("gateway: upstream %s: listing tools: %v", u.name, err)
+			u.tools = union(u.tools, names)
+			return
+		}
+		exposed := *tool
+		exposed.Name = Namespace(u.name, tool.Name)
+		if u.add("tool "+exposed.Name, func() { u.gateway.server.AddTool(&exposed, u.callTool(tool.Name)) }) {
+			names = append(names, exposed.Name)
+		}
+	}
+
+	u.gateway.server.RemoveTools(missing(u.tools, names)...)
+	u.tools = names
+}
+
+func (u *upstream) callTool(name string) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		session := u.getSession()
+		if session == nil {
+			return nil, errDisconnected
+		}
+		params := &mcp.CallToolParams{Meta: req.Params.Meta, Name: name}
+		if len(req.Params.Arguments) > 0 {
+			params.Arguments = req.Params.Arguments
+		}
+		return session.CallTool(ctx, params)
+	}
+}
+
+func (u *upstream) syncPrompts(ctx context.Context) {
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+
+	session := u.getSession()
+	if session == nil || u.capabilities().Prompts == nil {
+		return
+	}
+
+	var names []string
+	for prompt, err := range session.Prompts(ctx, nil) {
+		if err != nil {
+			u.gateway.logf("gateway: upstream %s: listing prompts: %v", u.name, err)
+			u.prompts = union(u.prompts, names)
+			return
+		}
+		exposed := *prompt
+		exposed.Name = Namespace(u.name, prompt.Name)
+		if u.add("prompt "+exposed.Name, func() { u.gateway.server.AddPrompt(&exposed, u.getPrompt(prompt.Name)) }) {
+			names = append(names, exposed.Name)
+		}
+	}
+
+	u.gateway.server.RemovePrompts(missing(u.prompts, names)...)
+	u.prompts = names
+}
+
+func (u *upstream) getPrompt(name string) mcp.PromptHandler {
+	return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		session := u.getSession()
+		if session == nil {
+			return nil, errDisconnected
+		}
+		return session.GetPrompt(ctx, &mcp.GetPromptParams{
+			Meta:      req.Params.Meta,
+			Name:      name,
+			Arguments: req.Params.Arguments,
+		})
+	}
+}
+
+// syncResources refreshes the resources and resource templates. Their URIs
+// are kept as they are so that links to them stay valid; only their names
+// are namespaced, and a URI or URI template already served by another
+// upstream is skipped. A list that cannot be read in full removes nothing,
+// as for the tools and prompts.
+func (u *upstream) syncResources(ctx context.Context) {
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+
+	session := u.getSession()
+	if session == nil || u.capabilities().Resources == nil {
+		return
+	}
+
+	var uris []string
+	complete := true
+	for resource, err := range session.Resources(ctx, nil) {
+		if err != nil {
+			u.gateway.logf("gateway: upstream %s: listing resources: %v", u.name, err)
+			complete = false
+			break
+		}
+		if !u.gateway.claim(u.gateway.resources, u, resource.URI) {
+			u.gateway.logf("gateway: upstream %s: resource %s already served by another upstream", u.name, resource.URI)
+			continue
+		}
+		exposed := *resource
+		exposed.Name = Namespace(u.name, resource.Name)
+		if u.add("resource "+exposed.URI, func() { u.gateway.server.AddResource(&exposed, u.readResource) }) {
+			uris = append(uris, exposed.URI)
+		} else {
+			u.gateway.release(u.gateway.resources, u, resource.URI)
+		}
+	}
+	if complete {
+		gone := missing(u.resources, uris)
+		u.gateway.server.RemoveResources(gone...)
+		u.gateway.release(u.gateway.resources, u, gone...)
+		u.resources = uris
+	} else {
+		u.resources = union(u.resources, uris)
+	}
+
+	var templates []string
+	complete = true
+	for template, err := range session.ResourceTemplates(ctx, nil) {
+		if err != nil {
+			u.gateway.logf("gateway: upstream %s: listing resource templates: %v", u.name, err)
+			complete = false
+			break
+		}
+		if !u.gateway.claim(u.gateway.templates, u, template.URITemplate) {
+			u.gateway.logf("gateway: upstream %s: resource template %s already served by another upstream", u.name, template.URITemplate)
+			continue
+		}
+		exposed := *template
+		exposed.Name = Namespace(u.name, template.Name)
+		if u.add("resource template "+exposed.URITemplate, func() { u.gateway.server.AddResourceTemplate(&exposed, u.readResource) }) {
+			templates = append(templates, exposed.URITemplate)
+		} else {
+			u.gateway.release(u.gateway.templates, u, template.URITemplate)
+		}
+	}
+	if complete {
+		gone := missing(u.templates, templates)
+		u.gateway.server.RemoveResourceTemplates(gone...)
+		u.gateway.release(u.gateway.templates, u, gone...)
+		u.templates = templates
+	} else {
+		u.templates = union(u.templates, templates)
+	}
+}
+
+func (u *upstream) readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	session := u.getSession()
+	if session == nil {
+		return nil, errDisconnected
+	}
+	return session.ReadResource(ctx, &mcp.ReadResourceParams{
+		Meta: req.Params.Meta,
+		URI:  req.Params.URI,
+	})
+}
+
+// claim records u in owners, g.resources or g.templates, as the upstream
+// serving the resource URI or URI template key. It reports false if another
+// upstream serves it already.
+func (g *Gateway) claim(owners map[string]*upstream, u *upstream, key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if owner, ok := owners[key]; ok && owner != u {
+		return false
+	}
+	owners[key] = u
+	return true
+}
+
+// release forgets the keys claimed by u in owners.
+func (g *Gateway) release(owners map[string]*upstream, u *upstream, keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		if owners[key] == u {
+			delete(owners, key)
+		}
+	}
+}
+
+// add registers a feature with register, which panics on definitions the
+// server rejects, such as a tool without an object input schema. It reports
+// whether the feature was registered.
+func (u *upstream) add(what string, register func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			u.gateway.logf("gateway: upstream %s: skipping %s: %v", u.name, what, r)
+			ok = false
+		}
+	}()
+	register()
+	return true
+}
+
+// removeAll removes every feature of the upstream from the gateway. The
+// resources and resource templates it served are then offered to the other
+// upstreams, which skipped those they serve as well.
+func (u *upstream) removeAll() {
+	u.syncMu.Lock()
+	s := u.gateway.server
+	s.RemoveTools(u.tools...)
+	s.RemovePrompts(u.prompts...)
+	s.RemoveResources(u.resources...)
+	u.gateway.release(u.gateway.resources, u, u.resources...)
+	s.RemoveResourceTemplates(u.templates...)
+	u.gateway.release(u.gateway.templates, u, u.templates...)
+	released := len(u.resources) > 0 || len(u.templates) > 0
+	u.tools, u.prompts, u.resources, u.templates = nil, nil, nil, nil
+	u.syncMu.Unlock()
+
+	if !released || u.gateway.closed.Load() {
+		return
+	}
+	for _, other := range u.gateway.upstreams {
+		if other != u {
+			other.syncResources(context.Background())
+		}
+	}
+}
+
+// missing returns the elements of old that are not in current.
+func missing(old, current []string) []string {
+	var out []string
+	for _, s := range old {
+		if !contains(current, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// union returns list followed by the elements of more that it lacks.
+func union(list, more []string) []string {
+	for _, s := range more {
+		if !contains(list, s) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+)
+
+const timeout = 5 * time.Second
+
+var discard = log.New(io.Discard, "", 0)
+
+// connect starts a client session with the gateway.
+func connect(t *testing.T, g *Gateway) *mcp.ClientSession {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	if _, err := g.Server().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// eventually polls cond until it holds or the test times out.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasTool(session *mcp.ClientSession, name string) bool {
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		return false
+	}
+	for _, tool := range res.Tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+func echo(_ context.Context, _ *mcp.CallToolRequest, args echoArgs) (*mcp.CallToolResult, any, error) {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: args.Text}}}, nil, nil
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	// accepts the connection but never answers initialize
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = New(context.Background(), []Upstream{{Name: "silent", Transport: tcp.NewTransport(listener.Addr().String())}}, &Options{HandshakeTimeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "initialize") {
+		t.Fatalf("New = %v, want a handshake timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout {
+		t.Fatalf("New returned after %v", elapsed)
+	}
+}
+
+// The handshake timeout must not end the stream a streamable HTTP upstream
+// sends its notifications on.
+func TestHandshakeTimeoutKeepsSession(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "upstream", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, echo)
+	httpServer := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	defer httpServer.Close()
+
+	const handshake = 100 * time.Millisecond
+	g, err := New(context.Background(), []Upstream{{Name: "http", Transport: &mcp.StreamableClientTransport{Endpoint: httpServer.URL}}}, &Options{HandshakeTimeout: handshake})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	session := connect(t, g)
+	if !hasTool(session, "http.echo") {
+		t.Fatal("http.echo missing")
+	}
+
+	time.Sleep(3 * handshake)
+	mcp.AddTool(server, &mcp.Tool{Name: "shout"}, echo)
+	eventually(t, "http.shout", func() bool { return hasTool(session, "http.shout") })
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "http.echo", Arguments: map[string]any{"text": "hi"}})
+	if err != nil || res.IsError {
+		t.Fatalf("CallTool after the handshake timeout = %+v, %v", res, err)
+	}
+}
+
+// memoryUpstream returns an upstream named name connected to server over
+// the in-memory transport, and the session of server.
+func memoryUpstream(t *testing.T, name string, server *mcp.Server) (Upstream, *mcp.ServerSession) {
+	t.Helper()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	session, err := server.Connect(context.Background(), serverTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Upstream{Name: name, Transport: clientTransport}, session
+}
+
+// templateUpstream returns an upstream serving the URI template order://{id}
+// and the server behind it, with its session.
+func templateUpstream(t *testing.T, name string) (Upstream, *mcp.Server, *mcp.ServerSession) {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: name, Version: "v1.0.0"}, nil)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{Name: "order", URITemplate: "order://{id}"},
+		func(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: req.Params.URI, Text: name}}}, nil
+		})
+	up, session := memoryUpstream(t, name, server)
+	return up, server, session
+}
+
+func templateNames(session *mcp.ClientSession) []string {
+	res, err := session.ListResourceTemplates(context.Background(), nil)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, template := range res.ResourceTemplates {
+		names = append(names, template.Name)
+	}
+	return names
+}
+
+func TestResourceTemplateOwners(t *testing.T) {
+	first, _, firstSession := templateUpstream(t, "first")
+	second, secondServer, _ := templateUpstream(t, "second")
+	g, err := New(context.Background(), []Upstream{first, second}, &Options{ErrorLog: discard})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	session := connect(t, g)
+
+	read := func() string {
+		res, err := session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: "order://42"})
+		if err != nil {
+			return err.Error()
+		}
+		return res.Contents[0].Text
+	}
+	if got := strings.Join(templateNames(session), ","); got != "first.order" {
+		t.Fatalf("templates = %s, want first.order", got)
+	}
+	if got := read(); got != "first" {
+		t.Fatalf("order://42 read from %s, want first", got)
+	}
+
+	// the second upstream refreshes its lists: the template stays with the
+	// first one
+	secondServer.AddResource(&mcp.Resource{Name: "catalog", URI: "catalog://all"}, nil)
+	eventually(t, "second.catalog", func() bool {
+		res, err := session.ListResources(context.Background(), nil)
+		return err == nil && len(res.Resources) == 1
+	})
+	if got := read(); got != "first" {
+		t.Fatalf("order://42 read from %s after a refresh of second, want first", got)
+	}
+
+	// the first upstream leaves, and the second one, which skipped the
+	// template, serves it without having to change its lists
+	firstSession.Close()
+	eventually(t, "second.order", func() bool { return strings.Join(templateNames(session), ",") == "second.order" })
+	if got := read(); got != "second" {
+		t.Fatalf("order://42 read from %s, want second", got)
+	}
+}
+
+// orderUpstream returns an upstream whose getOrder tool answers with the
+// name of the upstream.
+func orderUpstream(t *testing.T, name string) Upstream {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: name, Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "getOrder"}, func(_ context.Context, _ *mcp.CallToolRequest, args struct {
+		IDOrder string `json:"idOrder"`
+	}) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: name + " " + args.IDOrder}}}, nil, nil
+	})
+	up, _ := memoryUpstream(t, name, server)
+	return up
+}
+
+func TestNamespacedRouting(t *testing.T) {
+	g, err := New(context.Background(), []Upstream{orderUpstream(t, "orders"), orderUpstream(t, "archive")}, &Options{ErrorLog: discard})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	session := connect(t, g)
+
+	for _, name := range []string{"orders", "archive"} {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: Namespace(name, "getOrder"), Arguments: map[string]any{"idOrder": "42"}})
+		if err != nil || res.IsError {
+			t.Fatalf("%s.getOrder = %+v, %v", name, res, err)
+		}
+		if got, want := res.Content[0].(*mcp.TextContent).Text, name+" 42"; got != want {
+			t.Errorf("%s.getOrder answered %q, want %q", name, got, want)
+		}
+	}
+	if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "getOrder", Arguments: map[string]any{"idOrder": "42"}}); err == nil {
+		t.Error("getOrder without a namespace succeeded")
+	}
+}
+
+func TestToolListChanged(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "upstream", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, echo)
+	up, _ := memoryUpstream(t, "up", server)
+	g, err := New(context.Background(), []Upstream{up}, &Options{ErrorLog: discard})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	if _, err := g.Server().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) { changed <- struct{}{} },
+	}).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	mcp.AddTool(server, &mcp.Tool{Name: "shout"}, echo)
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		t.Fatal("no tools/list_changed from the gateway")
+	}
+	eventually(t, "up.shout", func() bool { return hasTool(session, "up.shout") })
+
+	server.RemoveTools("echo")
+	eventually(t, "up.echo removed", func() bool { return !hasTool(session, "up.echo") })
+	if !hasTool(session, "up.shout") {
+		t.Error("up.shout removed along with up.echo")
+	}
+}
+
+// A tool list that fails partway removes nothing, and the tools it added
+// are still removed once the upstream drops them.
+func TestPartialToolList(t *testing.T) {
+	var failing atomic.Bool
+	// one tool per page, the pages after the first failing on demand
+	server := mcp.NewServer(&mcp.Implementation{Name: "upstream", Version: "v1.0.0"}, &mcp.ServerOptions{PageSize: 1})
+	server.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if params, ok := req.GetParams().(*mcp.ListToolsParams); ok && params.Cursor != "" && failing.Load() {
+				return nil, errors.New("page unavailable")
+			}
+			return next(ctx, method, req)
+		}
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "b"}, echo)
+	mcp.AddTool(server, &mcp.Tool{Name: "c"}, echo)
+	up, _ := memoryUpstream(t, "up", server)
+	g, err := New(context.Background(), []Upstream{up}, &Options{ErrorLog: discard})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer g.Close()
+	session := connect(t, g)
+	if !hasTool(session, "up.b") || !hasTool(session, "up.c") {
+		t.Fatal("tools of the upstream missing")
+	}
+
+	// a comes first, and is added by the refresh that fails on the page of b
+	failing.Store(true)
+	mcp.AddTool(server, &mcp.Tool{Name: "a"}, echo)
+	eventually(t, "up.a", func() bool { return hasTool(session, "up.a") })
+	if !hasTool(session, "up.b") || !hasTool(session, "up.c") {
+		t.Error("tools removed by an incomplete list")
+	}
+
+	failing.Store(false)
+	server.RemoveTools("a")
+	eventually(t, "up.a removed", func() bool { return !hasTool(session, "up.a") })
+}
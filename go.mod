@@ -3,6 +3,7 @@ module mcp
 go 1.24.3
 
 require (
+	github.com/google/jsonschema-go v0.3.0
 	github.com/mark3labs/mcp-go v0.41.1
 	github.com/modelcontextprotocol/go-sdk v1.0.0
 )
@@ -10,7 +11,6 @@ require (
 require (
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
-	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/invopop/jsonschema v0.13.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
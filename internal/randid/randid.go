@@ -0,0 +1,15 @@
+// Package randid generates the random ids of this module: the session ids of
+// the transport connections and the ids of LLM conversations.
+package randid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// New returns a random 128 bit hex encoded id.
+func New() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxIterations bounds the model calls of [RunAgent] when
+// [AgentOptions.MaxIterations] is not set.
+const DefaultMaxIterations = 8
+
+// ErrMaxIterations is returned by [RunAgent] when the model is still asking
+// for tools after the maximum number of iterations.
+var ErrMaxIterations = errors.New("llm: agent reached the maximum number of iterations")
+
+// ChatFunc sends the conversation and the available tools to the model and
+// returns its reply.
+type ChatFunc func(ctx context.Context, messages []Message, tools []Tool) (*Message, error)
+
+// ToolFunc runs a tool call and returns its result. An error does not stop
+// the agent: it is given to the model as the result of the call, so that the
+// model can retry or explain it.
+type ToolFunc func(ctx context.Context, call ToolCall) (string, error)
+
+// AgentOptions configures [RunAgent]. The zero value is valid.
+type AgentOptions struct {
+	// MaxIterations is the maximum number of model calls. It defaults to
+	// [DefaultMaxIterations].
+	MaxIterations int
+	// OnStep, when set, is called after every step, e.g. to show progress.
+	OnStep func(Step)
+}
+
+// StepKind tells model steps from tool steps.
+type StepKind string
+
+const (
+	StepModel StepKind = "model"
+	StepTool  StepKind = "tool"
+)
+
+// Step is an entry of the trace of an agent run.
+type Step struct {
+	// Iteration is the model call the step belongs to, starting at 1.
+	Iteration int      `json:"iteration"`
+	Kind      StepKind `json:"kind"`
+	// Content is the text of the model reply.
+	Content string `json:"content,omitempty"`
+	// ToolCall is the call made in a tool step, or the first call requested
+	// by the model in a model step.
+	ToolCall *ToolCall `json:"toolCall,omitempty"`
+	// ToolCalls is the number of tools requested in a model step.
+	ToolCalls int `json:"toolCalls,omitempty"`
+	// Result is the result of a tool step.
+	Result string `json:"result,omitempty"`
+	// Error is set when the model call or the tool call failed.
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	// Usage is the token count of a model step.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// AgentResult is the outcome of an agent run.
+type AgentResult struct {
+	// Answer is the final text of the model.
+	Answer string
+	// Messages is the whole conversation, including the tool calls, their
+	// results and the final answer.
+	Messages []Message
+	// Steps is the trace of the run.
+	Steps []Step
+	// Usage sums the tokens of the model calls.
+	Usage Usage
+}
+
+// RunAgent calls the model with messages and tools, runs the tool calls it
+// requests with call and feeds their results back, until the model replies
+// without asking for tools. The arguments of a call are validated against
+// the schema of the tool first; a validation error is fed back instead of
+// calling the tool.
+//
+// The result, trace included, is returned even when the run fails, either
+// because the model could not be called or with [ErrMaxIterations].
+func RunAgent(ctx context.Context, chat ChatFunc, tools []Tool, call ToolFunc, messages []Message, opts *AgentOptions) (*AgentResult, error) {
+	if opts == nil {
+		opts = &AgentOptions{}
+	}
+	maxIterations := opts.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+
+	result := &AgentResult{Messages: append([]Message(nil), messages...)}
+	addStep := func(step Step) {
+		result.Steps = append(result.Steps, step)
+		if opts.OnStep != nil {
+			opts.OnStep(step)
+		}
+	}
+
+	for i := 1; i <= maxIterations; i++ {
+		start := time.Now()
+		reply, err := chat(ctx, result.Messages, tools)
+		step := Step{Iteration: i, Kind: StepModel, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			step.Error = err.Error()
+			addStep(step)
+			return result, err
+		}
+		step.Content = reply.Content
+		if reply.Usage != nil {
+			step.Usage = reply.Usage
+			result.Usage.Add(*reply.Usage)
+		}
+		if len(reply.ToolCalls) > 0 {
+			step.ToolCall = &reply.ToolCalls[0]
+			step.ToolCalls = len(reply.ToolCalls)
+		}
+		addStep(step)
+
+		if reply.Role == "" {
+			reply.Role = RoleAssistant
+		}
+		result.Messages = append(result.Messages, *reply)
+		if len(reply.ToolCalls) == 0 {
+			result.Answer = reply.Content
+			return result, nil
+		}
+
+		for _, tc := range reply.ToolCalls {
+			start := time.Now()
+			output, err := "", checkArguments(tools, tc)
+			if err == nil {
+				output, err = call(ctx, tc)
+			}
+			step := Step{Iteration: i, Kind: StepTool, ToolCall: &tc, Result: output}
+			if err != nil {
+				step.Error = err.Error()
+				output = "error: " + err.Error()
+			}
+			step.DurationMs = time.Since(start).Milliseconds()
+			addStep(step)
+
+			result.Messages = append(result.Messages, Message{Role: RoleTool, ToolCallID: tc.ID, Content: output})
+		}
+	}
+
+	return result, ErrMaxIterations
+}
+
+// checkArguments validates the arguments of call against the parameters
+// schema of its tool. Unknown tools and schemas that cannot be used are left
+// for the tool call to report.
+func checkArguments(tools []Tool, call ToolCall) error {
+	for _, t := range tools {
+		if t.Function.Name != call.Function.Name || t.Function.Parameters == nil {
+			continue
+		}
+		_, resolved, err := resolveSchema(t.Function.Parameters)
+		if err != nil {
+			return nil
+		}
+
+		arguments := call.Function.Arguments
+		if arguments == "" {
+			arguments = "{}"
+		}
+		var instance any
+		if err := json.Unmarshal([]byte(arguments), &instance); err != nil {
+			return fmt.Errorf("invalid arguments JSON: %w", err)
+		}
+		if err := resolved.Validate(instance); err != nil {
+			return fmt.Errorf("invalid arguments: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"mcp/llm"
+	"mcp/llm/llmtest"
+)
+
+var orderTools = []llm.Tool{
+	llm.NewTool("getOrder", "Returns an order", json.RawMessage(`{"type":"object","properties":{"idOrder":{"type":"string"}},"required":["idOrder"]}`)),
+	llm.NewTool("getCustomer", "Returns a customer", json.RawMessage(`{"type":"object","properties":{"id":{"type":"string"}},"required":["id"]}`)),
+}
+
+// orderCalls runs the order tools, keeping the calls it was given.
+type orderCalls struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (o *orderCalls) call(_ context.Context, tc llm.ToolCall) (string, error) {
+	o.mu.Lock()
+	o.calls = append(o.calls, tc.Function.Name+" "+tc.Function.Arguments)
+	o.mu.Unlock()
+
+	var args map[string]string
+	json.Unmarshal([]byte(tc.Function.Arguments), &args)
+	switch tc.Function.Name {
+	case "getOrder":
+		return fmt.Sprintf("order %s by customer 7", args["idOrder"]), nil
+	case "getCustomer":
+		return fmt.Sprintf("customer %s is João", args["id"]), nil
+	}
+	return "", fmt.Errorf("unknown tool %s", tc.Function.Name)
+}
+
+// agentChat returns the chat of a fake LLM server answering with rules.
+func agentChat(t *testing.T, rules ...llmtest.Rule) (llm.ChatFunc, *llmtest.Server) {
+	t.Helper()
+	server := llmtest.NewServer(rules...)
+	t.Cleanup(server.Close)
+	cfg := server.Config()
+	cfg.Retries = -1
+	p, err := llm.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Chat, server
+}
+
+func question(q string) []llm.Message {
+	return []llm.Message{{Role: llm.RoleSystem, Content: "You answer about orders."}, {Role: llm.RoleUser, Content: q}}
+}
+
+func stepKinds(steps []llm.Step) []llm.StepKind {
+	var kinds []llm.StepKind
+	for _, s := range steps {
+		kinds = append(kinds, s.Kind)
+	}
+	return kinds
+}
+
+// The result of a tool leads the model to another one, then to the answer.
+func TestRunAgentToolLoop(t *testing.T) {
+	chat, server := agentChat(t,
+		llmtest.CallTool(`^Who ordered (\d+)\?$`, "getOrder", `{"idOrder":"$1"}`),
+		llmtest.Rule{Role: llm.RoleTool, Match: `^order \d+ by customer (\d+)$`, ToolCalls: []llmtest.ToolCall{{Name: "getCustomer", Arguments: `{"id":"$1"}`}}},
+		llmtest.Rule{Role: llm.RoleTool, Match: `^customer \d+ is (.+)$`, Reply: "It was $1."},
+	)
+	tools := &orderCalls{}
+	var onStep []llm.Step
+	result, err := llm.RunAgent(context.Background(), chat, orderTools, tools.call, question("Who ordered 42?"), &llm.AgentOptions{
+		OnStep: func(s llm.Step) { onStep = append(onStep, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Answer != "It was João." {
+		t.Errorf("answer = %q", result.Answer)
+	}
+	if want := []string{`getOrder {"idOrder":"42"}`, `getCustomer {"id":"7"}`}; !slices.Equal(tools.calls, want) {
+		t.Errorf("tool calls = %q, want %q", tools.calls, want)
+	}
+	want := []llm.StepKind{llm.StepModel, llm.StepTool, llm.StepModel, llm.StepTool, llm.StepModel}
+	if got := stepKinds(result.Steps); !slices.Equal(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+	if len(onStep) != len(result.Steps) || result.Steps[4].Iteration != 3 {
+		t.Errorf("%d steps reported, last of iteration %d", len(onStep), result.Steps[4].Iteration)
+	}
+	// the question, a call and its result per tool, and the answer
+	if len(result.Messages) != 7 || len(server.Requests()) != 3 {
+		t.Errorf("%d messages after %d model calls, want 7 after 3", len(result.Messages), len(server.Requests()))
+	}
+	last := server.Requests()[2].Messages
+	if got := last[len(last)-1]; got.Role != llm.RoleTool || got.ToolCallID != result.Messages[4].ToolCalls[0].ID {
+		t.Errorf("last message sent = %+v, want the result of getCustomer", got)
+	}
+}
+
+func TestRunAgentMaxIterations(t *testing.T) {
+	chat, server := agentChat(t,
+		llmtest.CallTool(`^Who ordered (\d+)\?$`, "getOrder", `{"idOrder":"$1"}`),
+		// the model never makes up its mind
+		llmtest.Rule{Role: llm.RoleTool, Match: `^order (\d+)`, ToolCalls: []llmtest.ToolCall{{Name: "getOrder", Arguments: `{"idOrder":"$1"}`}}},
+	)
+	tools := &orderCalls{}
+	result, err := llm.RunAgent(context.Background(), chat, orderTools, tools.call, question("Who ordered 42?"), &llm.AgentOptions{MaxIterations: 3})
+	if !errors.Is(err, llm.ErrMaxIterations) {
+		t.Fatalf("RunAgent = %v, want %v", err, llm.ErrMaxIterations)
+	}
+	// the trace is returned with the error
+	if n := len(server.Requests()); n != 3 || len(tools.calls) != 3 || len(result.Steps) != 6 {
+		t.Errorf("%d model calls, %d tool calls and %d steps, want 3, 3 and 6", n, len(tools.calls), len(result.Steps))
+	}
+	if result.Answer != "" {
+		t.Errorf("answer = %q, want none", result.Answer)
+	}
+}
+
+// Arguments not matching the schema of the tool are sent back to the model
+// without calling the tool.
+func TestRunAgentInvalidArguments(t *testing.T) {
+	tests := []struct {
+		name, arguments, error string
+	}{
+		{"schema", `{"id":42}`, "invalid arguments: "},
+		{"json", `{idOrder: 42`, "invalid arguments JSON: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat, server := agentChat(t,
+				llmtest.CallTool(`^Who ordered 42\?$`, "getOrder", tt.arguments),
+				llmtest.Rule{Role: llm.RoleTool, Match: `^error: invalid arguments`, ToolCalls: []llmtest.ToolCall{{Name: "getOrder", Arguments: `{"idOrder":"42"}`}}},
+				llmtest.Rule{Role: llm.RoleTool, Match: `^order 42 by customer (\d+)$`, Reply: "Customer $1."},
+			)
+			tools := &orderCalls{}
+			result, err := llm.RunAgent(context.Background(), chat, orderTools, tools.call, question("Who ordered 42?"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Answer != "Customer 7." {
+				t.Errorf("answer = %q", result.Answer)
+			}
+			if want := []string{`getOrder {"idOrder":"42"}`}; !slices.Equal(tools.calls, want) {
+				t.Errorf("tool calls = %q, want only the valid one", tools.calls)
+			}
+			if step := result.Steps[1]; !strings.HasPrefix(step.Error, tt.error) || step.Result != "" {
+				t.Errorf("step of the invalid call = %+v, want the error %q", step, tt.error)
+			}
+			sent := server.Requests()[1].Messages
+			if got := sent[len(sent)-1].Content; !strings.HasPrefix(got, "error: "+tt.error) {
+				t.Errorf("result sent to the model = %q", got)
+			}
+		})
+	}
+}
+
+func TestRunAgentModelError(t *testing.T) {
+	// no rule answers: the fake server fails the call
+	chat, _ := agentChat(t)
+	result, err := llm.RunAgent(context.Background(), chat, orderTools, (&orderCalls{}).call, question("Who ordered 42?"), nil)
+	var se *llm.StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("RunAgent = %v, want the error of the server", err)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Kind != llm.StepModel || result.Steps[0].Error == "" {
+		t.Errorf("steps = %+v, want the failed model call", result.Steps)
+	}
+}
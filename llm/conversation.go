@@ -0,0 +1,206 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp/internal/randid"
+)
+
+// titleLength bounds the title taken from the first user message.
+const titleLength = 60
+
+// Conversation is a chat kept across requests.
+type Conversation struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Summary sums up the messages dropped to stay within the token budget.
+	Summary string `json:"summary,omitempty"`
+	// Messages is the history sent back to the model: user messages,
+	// replies, tool calls and their results. The system prompt is not kept.
+	Messages []Message `json:"messages"`
+}
+
+// ConversationInfo describes a conversation without its messages.
+type ConversationInfo struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Messages int       `json:"messages"`
+}
+
+// Context returns the messages to send to the model to continue the
+// conversation: the system prompt, the summary of the dropped messages and
+// the history.
+func (c *Conversation) Context(system string) []Message {
+	var messages []Message
+	if system != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: system})
+	}
+	if c.Summary != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: "Summary of the earlier conversation: " + c.Summary})
+	}
+	return append(messages, c.Messages...)
+}
+
+// Append adds messages to the history. The first user message becomes the
+// title of the conversation.
+func (c *Conversation) Append(messages ...Message) {
+	for _, m := range messages {
+		if c.Title == "" && m.Role == RoleUser {
+			c.Title = title(m.Content)
+		}
+	}
+	c.Messages = append(c.Messages, messages...)
+	c.Updated = time.Now()
+}
+
+func title(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > titleLength {
+		return string(r[:titleLength]) + "…"
+	}
+	return s
+}
+
+// ErrConversationNotFound is returned by [ConversationStore.Begin] for a
+// conversation that does not exist or belongs to another owner.
+var ErrConversationNotFound = errors.New("llm: conversation not found")
+
+// ConversationStore keeps conversations in memory, each one belonging to an
+// owner, such as a browser session: an owner only sees its own
+// conversations. It is safe for concurrent use; conversations are copied in
+// and out.
+//
+// A request adding a turn to a conversation runs between
+// [ConversationStore.Begin] and the end function it returns, so that
+// concurrent turns on a conversation run one after the other instead of
+// overwriting each other's messages.
+type ConversationStore struct {
+	mu    sync.Mutex
+	convs map[string]*storedConversation
+}
+
+type storedConversation struct {
+	owner string
+	conv  *Conversation
+	turn  chan struct{} // holds a value while a turn runs
+}
+
+// NewConversationStore returns an empty store.
+func NewConversationStore() *ConversationStore {
+	return &ConversationStore{convs: make(map[string]*storedConversation)}
+}
+
+// Create starts a new conversation of owner.
+func (s *ConversationStore) Create(owner string) *Conversation {
+	now := time.Now()
+	c := &Conversation{ID: randid.New(), Created: now, Updated: now}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.convs[c.ID] = &storedConversation{owner: owner, conv: c.clone(), turn: make(chan struct{}, 1)}
+	return c
+}
+
+// Get returns a copy of the conversation of owner with the given id.
+func (s *ConversationStore) Get(owner, id string) (*Conversation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.convs[id]
+	if !ok || sc.owner != owner {
+		return nil, false
+	}
+	return sc.conv.clone(), true
+}
+
+// Begin waits until no other turn runs on the conversation of owner with
+// the given id and returns a copy of it, up to date with the previous turn.
+// The caller adds its messages, calls [ConversationStore.Save] and then end,
+// which lets the next turn begin.
+func (s *ConversationStore) Begin(ctx context.Context, owner, id string) (c *Conversation, end func(), err error) {
+	s.mu.Lock()
+	sc, ok := s.convs[id]
+	s.mu.Unlock()
+	if !ok || sc.owner != owner {
+		return nil, nil, ErrConversationNotFound
+	}
+
+	select {
+	case sc.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	end = func() { <-sc.turn }
+
+	c, ok = s.Get(owner, id)
+	if !ok {
+		// deleted while waiting
+		end()
+		return nil, nil, ErrConversationNotFound
+	}
+	return c, end, nil
+}
+
+// Save stores a copy of c. A conversation deleted in the meantime is not
+// stored back.
+func (s *ConversationStore) Save(c *Conversation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sc, ok := s.convs[c.ID]; ok {
+		sc.conv = c.clone()
+	}
+}
+
+// Delete removes the conversation of owner with the given id, reporting
+// whether it existed.
+func (s *ConversationStore) Delete(owner, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.convs[id]
+	if !ok || sc.owner != owner {
+		return false
+	}
+	delete(s.convs, id)
+	return true
+}
+
+// List describes the conversations of owner, the most recently updated
+// first.
+func (s *ConversationStore) List(owner string) []ConversationInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]ConversationInfo, 0)
+	for _, sc := range s.convs {
+		if sc.owner != owner {
+			continue
+		}
+		c := sc.conv
+		list = append(list, ConversationInfo{
+			ID:       c.ID,
+			Title:    c.Title,
+			Created:  c.Created,
+			Updated:  c.Updated,
+			Messages: len(c.Messages),
+		})
+	}
+	slices.SortFunc(list, func(a, b ConversationInfo) int { return b.Updated.Compare(a.Updated) })
+	return list
+}
+
+func (c *Conversation) clone() *Conversation {
+	cc := *c
+	cc.Messages = slices.Clone(c.Messages)
+	return &cc
+}
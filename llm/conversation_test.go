@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConversationStoreOwners(t *testing.T) {
+	store := NewConversationStore()
+	mine := store.Create("alice")
+	store.Create("bob")
+
+	if list := store.List("alice"); len(list) != 1 || list[0].ID != mine.ID {
+		t.Fatalf("List(alice) = %+v, want only %s", list, mine.ID)
+	}
+	if _, ok := store.Get("bob", mine.ID); ok {
+		t.Error("Get by another owner succeeded")
+	}
+	if _, _, err := store.Begin(context.Background(), "bob", mine.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Begin by another owner = %v, want %v", err, ErrConversationNotFound)
+	}
+	if store.Delete("bob", mine.ID) {
+		t.Error("Delete by another owner succeeded")
+	}
+	if !store.Delete("alice", mine.ID) {
+		t.Error("Delete by the owner failed")
+	}
+	if list := store.List("alice"); len(list) != 0 {
+		t.Errorf("List(alice) after Delete = %+v", list)
+	}
+}
+
+// Concurrent turns on a conversation keep every message.
+func TestConversationStoreConcurrentTurns(t *testing.T) {
+	store := NewConversationStore()
+	id := store.Create("alice").ID
+
+	const turns = 20
+	var wg sync.WaitGroup
+	for i := range turns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, end, err := store.Begin(context.Background(), "alice", id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer end()
+			time.Sleep(time.Millisecond) // the model answering
+			c.Append(Message{Role: RoleUser, Content: fmt.Sprint(i)}, Message{Role: RoleAssistant, Content: "ok"})
+			store.Save(c)
+		}()
+	}
+	wg.Wait()
+
+	c, _ := store.Get("alice", id)
+	if len(c.Messages) != 2*turns {
+		t.Fatalf("%d messages after %d turns, want %d", len(c.Messages), turns, 2*turns)
+	}
+}
+
+func TestConversationStoreBeginWaits(t *testing.T) {
+	store := NewConversationStore()
+	id := store.Create("alice").ID
+
+	_, end, err := store.Begin(context.Background(), "alice", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := store.Begin(ctx, "alice", id); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Begin during another turn = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// a conversation deleted while a turn waits is not found, nor saved back
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := store.Begin(context.Background(), "alice", id)
+		done <- err
+	}()
+	store.Delete("alice", id)
+	end()
+	if err := <-done; !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("Begin on a deleted conversation = %v, want %v", err, ErrConversationNotFound)
+	}
+	store.Save(&Conversation{ID: id})
+	if _, ok := store.Get("alice", id); ok {
+		t.Error("Save brought a deleted conversation back")
+	}
+}
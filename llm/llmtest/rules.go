@@ -0,0 +1,102 @@
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Rule scripts a reply of the fake server. A rule applies when its pattern
+// matches the content of the last message of the request (the prompt for
+// completions) and the conditions it sets hold. Rules are tried in order; the
+// first that applies answers.
+type Rule struct {
+	// Match is a regular expression matched against the last message.
+	Match string `json:"match"`
+	// Role, when set, is the role the last message must have, e.g. "tool" to
+	// answer tool results.
+	Role string `json:"role,omitempty"`
+	// Tool, when set, is a tool the request must offer.
+	Tool string `json:"tool,omitempty"`
+
+	// Reply is the text of the reply. It can refer to the groups of Match
+	// as in regexp.Expand: $1, ${name}.
+	Reply string `json:"reply,omitempty"`
+	// ToolCalls are the tool calls of the reply. Their arguments are
+	// expanded like Reply.
+	ToolCalls []ToolCall `json:"toolCalls,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ToolCall is a tool call scripted by a [Rule].
+type ToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Reply returns a rule answering text when pattern matches.
+func Reply(pattern, text string) Rule {
+	return Rule{Match: pattern, Reply: text}
+}
+
+// CallTool returns a rule calling tool with arguments when pattern matches.
+func CallTool(pattern, tool, arguments string) Rule {
+	return Rule{Match: pattern, ToolCalls: []ToolCall{{Name: tool, Arguments: arguments}}}
+}
+
+// LoadRules reads rules from a JSON fixture file holding an array of rules.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("llmtest: %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func (r *Rule) compile() error {
+	re, err := regexp.Compile(r.Match)
+	if err != nil {
+		return fmt.Errorf("llmtest: rule %q: %w", r.Match, err)
+	}
+	r.re = re
+	return nil
+}
+
+// answer returns the reply of the rule to the last message, and false when
+// the rule does not apply.
+func (r *Rule) answer(last message, tools []string) (reply, bool) {
+	if r.Role != "" && r.Role != last.Role {
+		return reply{}, false
+	}
+	if r.Tool != "" && !contains(tools, r.Tool) {
+		return reply{}, false
+	}
+	m := r.re.FindStringSubmatchIndex(last.Content)
+	if m == nil {
+		return reply{}, false
+	}
+
+	expand := func(template string) string {
+		return string(r.re.ExpandString(nil, template, last.Content, m))
+	}
+	out := reply{content: expand(r.Reply)}
+	for _, tc := range r.ToolCalls {
+		out.toolCalls = append(out.toolCalls, ToolCall{Name: tc.Name, Arguments: expand(tc.Arguments)})
+	}
+	return out, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+// Package llmtest provides a fake OpenAI compatible server, scripted with
+// rules, to run the LLM clients without a model.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"mcp/llm"
+)
+
+// Handler is an http.Handler answering the chat completions and completions
+// endpoints of the OpenAI API with scripted replies. Streaming is supported.
+// A request no rule answers gets a 404 naming its last message.
+type Handler struct {
+	// OnRequest, when set, is called with every request received.
+	OnRequest func(Request)
+
+	rules []Rule
+
+	mu       sync.Mutex
+	requests []Request
+	calls    int
+}
+
+// Request is a request received by the fake server.
+type Request struct {
+	Path     string        `json:"path"`
+	Model    string        `json:"model"`
+	Messages []llm.Message `json:"messages,omitempty"`
+	Prompt   string        `json:"prompt,omitempty"`
+	Tools    []string      `json:"tools,omitempty"`
+	Stream   bool          `json:"stream,omitempty"`
+	// Schema is the JSON schema of the response_format, if any.
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// NewHandler returns a handler answering with rules.
+func NewHandler(rules ...Rule) (*Handler, error) {
+	h := &Handler{rules: append([]Rule(nil), rules...)}
+	for i := range h.rules {
+		if err := h.rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Requests returns the requests received so far.
+func (h *Handler) Requests() []Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Request(nil), h.requests...)
+}
+
+// Server is a fake server listening on a local port.
+type Server struct {
+	*Handler
+	*httptest.Server
+}
+
+// NewServer starts a fake server answering with rules. It panics when a rule
+// does not compile. Close it when done.
+func NewServer(rules ...Rule) *Server {
+	h, err := NewHandler(rules...)
+	if err != nil {
+		panic(err)
+	}
+	return &Server{Handler: h, Server: httptest.NewServer(h)}
+}
+
+// Config returns the configuration of an OpenAI compatible provider talking
+// to the server.
+func (s *Server) Config() llm.Config {
+	return llm.Config{Provider: llm.ProviderOpenAI, BaseURL: s.URL + "/v1", Model: "fake"}
+}
+
+type message struct {
+	Role    string
+	Content string
+}
+
+type reply struct {
+	content   string
+	toolCalls []ToolCall
+}
+
+type requestBody struct {
+	Model          string        `json:"model"`
+	Messages       []llm.Message `json:"messages"`
+	Prompt         string        `json:"prompt"`
+	Tools          []llm.Tool    `json:"tools"`
+	Stream         bool          `json:"stream"`
+	ResponseFormat *struct {
+		JSONSchema struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	chat := strings.HasSuffix(r.URL.Path, "/chat/completions")
+	if r.Method != http.MethodPost || !chat && !strings.HasSuffix(r.URL.Path, "/completions") {
+		writeError(w, http.StatusNotFound, "unknown endpoint "+r.Method+" "+r.URL.Path)
+		return
+	}
+
+	var body requestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	req := Request{Path: r.URL.Path, Model: body.Model, Messages: body.Messages, Prompt: body.Prompt, Stream: body.Stream}
+	for _, t := range body.Tools {
+		req.Tools = append(req.Tools, t.Function.Name)
+	}
+	if body.ResponseFormat != nil {
+		req.Schema = body.ResponseFormat.JSONSchema.Schema
+	}
+
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	h.mu.Unlock()
+	if h.OnRequest != nil {
+		h.OnRequest(req)
+	}
+
+	last := message{Role: llm.RoleUser, Content: body.Prompt}
+	if chat && len(body.Messages) > 0 {
+		m := body.Messages[len(body.Messages)-1]
+		last = message{Role: m.Role, Content: m.Content}
+	}
+
+	out, ok := h.answer(last, req.Tools)
+	if !ok {
+		// 404: clients neither retry it, which would trip their circuit
+		// breaker, nor take it as an unsupported request option (400, 422)
+		writeError(w, http.StatusNotFound, fmt.Sprintf("llmtest: no rule matches %s message %q", last.Role, last.Content))
+		return
+	}
+	ids := h.toolCallIDs(len(out.toolCalls))
+
+	switch {
+	case chat && body.Stream:
+		streamChat(w, out, ids)
+	case chat:
+		writeChat(w, out, ids)
+	case body.Stream:
+		streamCompletion(w, out)
+	default:
+		writeJSON(w, map[string]any{"choices": []any{map[string]any{"text": out.content, "finish_reason": "stop"}}})
+	}
+}
+
+func (h *Handler) answer(last message, tools []string) (reply, bool) {
+	for i := range h.rules {
+		if out, ok := h.rules[i].answer(last, tools); ok {
+			return out, true
+		}
+	}
+	return reply{}, false
+}
+
+// toolCallIDs numbers the tool calls across the whole session, so that the
+// IDs are unique and deterministic.
+func (h *Handler) toolCallIDs(n int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]string, n)
+	for i := range ids {
+		h.calls++
+		ids[i] = fmt.Sprintf("call_%d", h.calls)
+	}
+	return ids
+}
+
+func writeChat(w http.ResponseWriter, out reply, ids []string) {
+	msg := llm.Message{Role: llm.RoleAssistant, Content: out.content}
+	finish := "stop"
+	for i, tc := range out.toolCalls {
+		call := llm.ToolCall{ID: ids[i], Type: "function"}
+		call.Function.Name = tc.Name
+		call.Function.Arguments = tc.Arguments
+		msg.ToolCalls = append(msg.ToolCalls, call)
+		finish = "tool_calls"
+	}
+	writeJSON(w, map[string]any{
+		"object":  "chat.completion",
+		"choices": []any{map[string]any{"index": 0, "message": msg, "finish_reason": finish}},
+	})
+}
+
+// streamChat sends the reply a word at a time, and each tool call as its
+// name followed by its arguments in two fragments, split between runes.
+func streamChat(w http.ResponseWriter, out reply, ids []string) {
+	sse := newEventWriter(w)
+	for _, word := range words(out.content) {
+		sse.send(map[string]any{"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": word}}}})
+	}
+	for i, tc := range out.toolCalls {
+		half := len(tc.Arguments) / 2
+		for half > 0 && !utf8.RuneStart(tc.Arguments[half]) {
+			half--
+		}
+		fragments := []map[string]any{
+			{"index": i, "id": ids[i], "type": "function", "function": map[string]any{"name": tc.Name, "arguments": ""}},
+			{"index": i, "function": map[string]any{"arguments": tc.Arguments[:half]}},
+			{"index": i, "function": map[string]any{"arguments": tc.Arguments[half:]}},
+		}
+		for _, f := range fragments {
+			sse.send(map[string]any{"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"tool_calls": []any{f}}}}})
+		}
+	}
+	sse.done()
+}
+
+func streamCompletion(w http.ResponseWriter, out reply) {
+	sse := newEventWriter(w)
+	for _, word := range words(out.content) {
+		sse.send(map[string]any{"choices": []any{map[string]any{"index": 0, "text": word}}})
+	}
+	sse.done()
+}
+
+// words splits s after each space, keeping the spaces so that the pieces add
+// up to s.
+func words(s string) []string {
+	var out []string
+	for s != "" {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			return append(out, s)
+		}
+		out = append(out, s[:i+1])
+		s = s[i+1:]
+	}
+	return out
+}
+
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newEventWriter(w http.ResponseWriter) *eventWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	return &eventWriter{w: w, flusher: flusher}
+}
+
+func (e *eventWriter) send(v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(e.w, "data: %s\n\n", data)
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+}
+
+func (e *eventWriter) done() {
+	fmt.Fprint(e.w, "data: [DONE]\n\n")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": message}})
+}
@@ -0,0 +1,90 @@
+package llmtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"mcp/llm"
+)
+
+func newServer(t *testing.T, rules ...Rule) (*Handler, *httptest.Server) {
+	t.Helper()
+	h, err := NewHandler(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return h, server
+}
+
+func TestStreamChatSplitsBetweenRunes(t *testing.T) {
+	// the middle byte of the arguments falls inside the second "ã"
+	const arguments = `{"n":"ããããã"}`
+	_, server := newServer(t, CallTool(".", "greet", arguments))
+
+	body := `{"model":"fake","stream":true,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"greet"}}]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var fragments []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Function struct {
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("event %s: %v", data, err)
+		}
+		for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+			if a := tc.Function.Arguments; a != "" {
+				if !utf8.ValidString(a) || strings.ContainsRune(a, utf8.RuneError) {
+					t.Errorf("fragment %q splits a rune", a)
+				}
+				fragments = append(fragments, a)
+			}
+		}
+	}
+	if got := strings.Join(fragments, ""); got != arguments || len(fragments) != 2 {
+		t.Fatalf("arguments sent as %q, want %s in two fragments", fragments, arguments)
+	}
+}
+
+func TestNoRuleMatches(t *testing.T) {
+	h, server := newServer(t, Reply("^hello$", "hi"))
+	provider, err := llm.New(llm.Config{Provider: llm.ProviderOpenAI, BaseURL: server.URL + "/v1", Model: "fake", Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "goodbye"}}, nil)
+	var statusErr *llm.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || !strings.Contains(statusErr.Body, "goodbye") {
+		t.Fatalf("Chat = %v, want a 404 naming the message", err)
+	}
+	if n := len(h.Requests()); n != 1 {
+		t.Errorf("%d requests sent, want 1 (not retried)", n)
+	}
+}
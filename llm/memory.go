@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultTokenBudget is the history size kept by [Compact] when
+// [MemoryOptions.TokenBudget] is not set.
+const DefaultTokenBudget = 3000
+
+// MemoryOptions configures [Compact]. The zero value is valid.
+type MemoryOptions struct {
+	// TokenBudget is the estimated number of tokens the history may take.
+	// It defaults to [DefaultTokenBudget].
+	TokenBudget int
+	// Summarizer, when set, sums up the dropped messages into the summary
+	// of the conversation. Otherwise they are just dropped.
+	Summarizer Provider
+}
+
+// EstimateTokens roughly estimates the tokens of messages, at four
+// characters a token plus a few for each message.
+func EstimateTokens(messages []Message) int {
+	tokens := 0
+	for _, m := range messages {
+		chars := len(m.Content) + len(m.ToolCallID)
+		for _, tc := range m.ToolCalls {
+			chars += len(tc.ID) + len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+		tokens += 4 + (chars+3)/4
+	}
+	return tokens
+}
+
+// Compact keeps the history of c within the token budget by dropping its
+// oldest turns, a turn being a user message and the replies, tool calls and
+// results that follow it. The last turn is always kept.
+//
+// With a summarizer the dropped turns are summed up in c.Summary. An error
+// from the summarizer is returned after the turns are dropped anyway.
+func Compact(ctx context.Context, c *Conversation, opts *MemoryOptions) error {
+	if opts == nil {
+		opts = &MemoryOptions{}
+	}
+	budget := opts.TokenBudget
+	if budget <= 0 {
+		budget = DefaultTokenBudget
+	}
+
+	cut := 0
+	for EstimateTokens(c.Messages[cut:]) > budget {
+		next := nextTurn(c.Messages, cut)
+		if next < 0 {
+			break
+		}
+		cut = next
+	}
+	if cut == 0 {
+		return nil
+	}
+
+	dropped := c.Messages[:cut]
+	c.Messages = append([]Message(nil), c.Messages[cut:]...)
+	if opts.Summarizer == nil {
+		return nil
+	}
+
+	summary, err := summarize(ctx, opts.Summarizer, c.Summary, dropped)
+	if err != nil {
+		return fmt.Errorf("llm: summarizing conversation: %w", err)
+	}
+	c.Summary = summary
+	return nil
+}
+
+// nextTurn returns the index of the first user message after from, or -1
+// when the turn at from is the last one.
+func nextTurn(messages []Message, from int) int {
+	for i := from + 1; i < len(messages); i++ {
+		if messages[i].Role == RoleUser {
+			return i
+		}
+	}
+	return -1
+}
+
+func summarize(ctx context.Context, p Provider, summary string, messages []Message) (string, error) {
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Earlier summary: " + summary + "\n\n")
+	}
+	for _, m := range messages {
+		switch {
+		case m.Role == RoleTool:
+			b.WriteString("tool result: " + m.Content)
+		case len(m.ToolCalls) > 0:
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "assistant called %s(%s)\n", tc.Function.Name, tc.Function.Arguments)
+			}
+			if m.Content == "" {
+				continue
+			}
+			b.WriteString(m.Role + ": " + m.Content)
+		default:
+			b.WriteString(m.Role + ": " + m.Content)
+		}
+		b.WriteString("\n")
+	}
+
+	reply, err := p.Chat(ctx, []Message{
+		{Role: RoleSystem, Content: "Summarize the conversation below in a few sentences. Keep the names, IDs, numbers and facts needed to continue it."},
+		{Role: RoleUser, Content: b.String()},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply.Content), nil
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const systemPrompt = "You answer about orders."
+
+// turn is a user question, the tool call it leads to, its result and the
+// answer.
+func turn(i int) []Message {
+	id := fmt.Sprintf("call_%d", i)
+	return []Message{
+		{Role: RoleUser, Content: fmt.Sprintf("Where is order %d, the one I placed last week?", i)},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: id, Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: fmt.Sprintf(`{"idOrder":"%d"}`, i)}}}},
+		{Role: RoleTool, ToolCallID: id, Content: fmt.Sprintf("order %d: shipped on Monday", i)},
+		{Role: RoleAssistant, Content: fmt.Sprintf("Order %d was shipped on Monday.", i)},
+	}
+}
+
+// turns returns a conversation of n turns, and the budget its last kept
+// turns take.
+func turns(n, kept int) (*Conversation, int) {
+	c := &Conversation{}
+	for i := range n {
+		c.Append(turn(i)...)
+	}
+	return c, EstimateTokens(c.Messages[4*(n-kept):])
+}
+
+func TestCompactUnderBudget(t *testing.T) {
+	c, budget := turns(3, 3)
+	before := append([]Message(nil), c.Messages...)
+	summarizer := answers("unused")
+	if err := Compact(context.Background(), c, &MemoryOptions{TokenBudget: budget, Summarizer: summarizer}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Messages, before) || c.Summary != "" || len(summarizer.calls) != 0 {
+		t.Errorf("history within the budget changed: %d messages, summary %q, %d summaries", len(c.Messages), c.Summary, len(summarizer.calls))
+	}
+}
+
+func TestCompactDrops(t *testing.T) {
+	c, budget := turns(5, 2)
+	if err := Compact(context.Background(), c, &MemoryOptions{TokenBudget: budget}); err != nil {
+		t.Fatal(err)
+	}
+	// the two latest turns are kept whole
+	if want := append(turn(3), turn(4)...); !reflect.DeepEqual(c.Messages, want) {
+		t.Errorf("history = %+v, want the last two turns", c.Messages)
+	}
+	if c.Summary != "" {
+		t.Errorf("summary = %q without a summarizer", c.Summary)
+	}
+	if ctx := c.Context(systemPrompt); ctx[0].Role != RoleSystem || ctx[0].Content != systemPrompt || ctx[1].Role != RoleUser {
+		t.Errorf("context starts with %+v, want the system prompt then the history", ctx[:2])
+	}
+}
+
+// The last turn stays even when it alone is over the budget.
+func TestCompactKeepsLastTurn(t *testing.T) {
+	c, _ := turns(3, 1)
+	if err := Compact(context.Background(), c, &MemoryOptions{TokenBudget: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Messages, turn(2)) {
+		t.Errorf("history = %+v, want the last turn", c.Messages)
+	}
+}
+
+func TestCompactSummarizes(t *testing.T) {
+	c, budget := turns(5, 2)
+	summarizer := answers("  Orders 0 to 2 were shipped on Monday.\n", "Orders 0 to 4 were shipped on Monday.")
+	opts := &MemoryOptions{TokenBudget: budget, Summarizer: summarizer}
+	if err := Compact(context.Background(), c, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := append(turn(3), turn(4)...); !reflect.DeepEqual(c.Messages, want) {
+		t.Errorf("history = %+v, want the last two turns", c.Messages)
+	}
+	if c.Summary != "Orders 0 to 2 were shipped on Monday." {
+		t.Errorf("summary = %q", c.Summary)
+	}
+	// the summarizer is given the dropped turns only
+	if len(summarizer.calls) != 1 {
+		t.Fatalf("%d summaries, want 1", len(summarizer.calls))
+	}
+	input := summarizer.calls[0][1].Content
+	for _, want := range []string{"user: Where is order 0,", `assistant called getOrder({"idOrder":"2"})`, "tool result: order 1: shipped", "assistant: Order 2 was shipped"} {
+		if !strings.Contains(input, want) {
+			t.Errorf("summarized text lacks %q:\n%s", want, input)
+		}
+	}
+	if strings.Contains(input, "order 3") {
+		t.Errorf("summarized text has a kept turn:\n%s", input)
+	}
+
+	ctx := c.Context(systemPrompt)
+	if ctx[0].Content != systemPrompt || ctx[1].Role != RoleSystem || !strings.HasSuffix(ctx[1].Content, c.Summary) || len(ctx) != 2+len(c.Messages) {
+		t.Errorf("context starts with %+v, want the system prompt, the summary and the history", ctx[:2])
+	}
+
+	// the next summary builds on the earlier one
+	c.Append(turn(5)...)
+	c.Append(turn(6)...)
+	opts.TokenBudget = EstimateTokens(c.Messages[8:])
+	if err := Compact(context.Background(), c, opts); err != nil {
+		t.Fatal(err)
+	}
+	if input := summarizer.calls[1][1].Content; !strings.HasPrefix(input, "Earlier summary: Orders 0 to 2 were shipped on Monday.") || !strings.Contains(input, "order 4") {
+		t.Errorf("second summarized text:\n%s", input)
+	}
+	if c.Summary != "Orders 0 to 4 were shipped on Monday." || !reflect.DeepEqual(c.Messages, append(turn(5), turn(6)...)) {
+		t.Errorf("after the second compaction: summary %q, %d messages", c.Summary, len(c.Messages))
+	}
+}
+
+// A failed summary still drops the turns, and keeps the earlier summary.
+func TestCompactSummarizerError(t *testing.T) {
+	c, budget := turns(4, 1)
+	c.Summary = "earlier"
+	err := Compact(context.Background(), c, &MemoryOptions{TokenBudget: budget, Summarizer: answers()})
+	if err == nil {
+		t.Fatal("Compact succeeded with a failing summarizer")
+	}
+	if !reflect.DeepEqual(c.Messages, turn(3)) || c.Summary != "earlier" {
+		t.Errorf("after the error: %d messages, summary %q", len(c.Messages), c.Summary)
+	}
+}
@@ -0,0 +1,63 @@
+// Package llm holds what the example clients share to talk to a language
+// model: the chat message types, in the shape of the OpenAI chat completions
+// API, and an agent loop that lets the model call MCP tools until it can
+// answer.
+package llm
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a message of a chat conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message asks to run.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a tool message to the call it answers.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Usage is set by the providers on the replies they return: the tokens
+	// of the call, reported by the server or estimated. It is not sent.
+	Usage *Usage `json:"-"`
+}
+
+// ToolCall is a tool invocation requested by the model.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the tool to run and its arguments.
+type FunctionCall struct {
+	Name string `json:"name"`
+	// Arguments is the JSON encoded object of arguments.
+	Arguments string `json:"arguments"`
+}
+
+// Tool describes a tool the model may call.
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// Function is the definition of a tool.
+type Function struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the arguments, usually the input
+	// schema of an MCP tool.
+	Parameters any `json:"parameters"`
+}
+
+// NewTool returns the definition of a function tool.
+func NewTool(name, description string, parameters any) Tool {
+	return Tool{
+		Type:     "function",
+		Function: Function{Name: name, Description: description, Parameters: parameters},
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decisions of a model call that did not ask for tools, see [Call.Decision].
+const (
+	DecisionAnswer = "answer"
+	DecisionError  = "error"
+)
+
+// Call is a model call counted by [Metrics].
+type Call struct {
+	// Conversation groups the calls of a conversation; may be empty.
+	Conversation string
+	// Decision is what the model decided: the tools it asked for, joined
+	// with "+", DecisionAnswer or DecisionError.
+	Decision string
+	Usage    Usage
+	Duration time.Duration
+	Err      error
+}
+
+// Stats aggregates model calls.
+type Stats struct {
+	Calls  int `json:"calls"`
+	Errors int `json:"errors"`
+	// Estimated counts the calls whose usage was estimated.
+	Estimated        int   `json:"estimated"`
+	PromptTokens     int   `json:"promptTokens"`
+	CompletionTokens int   `json:"completionTokens"`
+	TotalTokens      int   `json:"totalTokens"`
+	LatencyMs        int64 `json:"latencyMs"`
+	AvgLatencyMs     int64 `json:"avgLatencyMs"`
+	MaxLatencyMs     int64 `json:"maxLatencyMs"`
+}
+
+func (s *Stats) add(c Call) {
+	ms := c.Duration.Milliseconds()
+	s.Calls++
+	if c.Err != nil {
+		s.Errors++
+	}
+	if c.Usage.Estimated {
+		s.Estimated++
+	}
+	s.PromptTokens += c.Usage.PromptTokens
+	s.CompletionTokens += c.Usage.CompletionTokens
+	s.TotalTokens += c.Usage.TotalTokens
+	s.LatencyMs += ms
+	s.MaxLatencyMs = max(s.MaxLatencyMs, ms)
+	s.AvgLatencyMs = s.LatencyMs / int64(s.Calls)
+}
+
+// MetricsSnapshot is the state of [Metrics] at a point in time.
+type MetricsSnapshot struct {
+	Since time.Time `json:"since"`
+	Total Stats     `json:"total"`
+	// ByModel, ByConversation and ByDecision split the calls by the model
+	// that answered, the conversation and the decision of the model.
+	ByModel        map[string]Stats `json:"byModel"`
+	ByConversation map[string]Stats `json:"byConversation"`
+	ByDecision     map[string]Stats `json:"byDecision"`
+}
+
+// Metrics counts the tokens and the latency of model calls. It is safe for
+// concurrent use.
+type Metrics struct {
+	mu             sync.Mutex
+	since          time.Time
+	total          Stats
+	byModel        map[string]*Stats
+	byConversation map[string]*Stats
+	byDecision     map[string]*Stats
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		since:          time.Now(),
+		byModel:        make(map[string]*Stats),
+		byConversation: make(map[string]*Stats),
+		byDecision:     make(map[string]*Stats),
+	}
+}
+
+// Record counts a call.
+func (m *Metrics) Record(c Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.add(c)
+	addTo(m.byModel, c.Usage.Model, c)
+	addTo(m.byConversation, c.Conversation, c)
+	addTo(m.byDecision, c.Decision, c)
+}
+
+func addTo(stats map[string]*Stats, key string, c Call) {
+	if key == "" {
+		return
+	}
+	s, ok := stats[key]
+	if !ok {
+		s = &Stats{}
+		stats[key] = s
+	}
+	s.add(c)
+}
+
+// Chat returns a [ChatFunc] calling chat and recording every call under the
+// given conversation.
+func (m *Metrics) Chat(chat ChatFunc, conversation string) ChatFunc {
+	return func(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+		start := time.Now()
+		reply, err := chat(ctx, messages, tools)
+		c := Call{Conversation: conversation, Decision: Decision(reply, err), Duration: time.Since(start), Err: err}
+		if reply != nil && reply.Usage != nil {
+			c.Usage = *reply.Usage
+		}
+		m.Record(c)
+		return reply, err
+	}
+}
+
+// Provider returns a [Provider] calling p and recording every call under
+// the given conversation, e.g. for the [MemoryOptions.Summarizer] of the
+// conversation.
+func (m *Metrics) Provider(p Provider, conversation string) Provider {
+	return chatProvider(m.Chat(p.Chat, conversation))
+}
+
+// chatProvider is a [Provider] calling a [ChatFunc].
+type chatProvider ChatFunc
+
+func (f chatProvider) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	return f(ctx, messages, tools)
+}
+
+// Decision names what the model decided in reply, for [Call.Decision].
+func Decision(reply *Message, err error) string {
+	if err != nil || reply == nil {
+		return DecisionError
+	}
+	if len(reply.ToolCalls) == 0 {
+		return DecisionAnswer
+	}
+	var names []string
+	for _, tc := range reply.ToolCalls {
+		names = append(names, tc.Function.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "+")
+}
+
+// Conversation returns the stats of a conversation.
+func (m *Metrics) Conversation(id string) Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.byConversation[id]; ok {
+		return *s
+	}
+	return Stats{}
+}
+
+// Forget drops the stats of a conversation, e.g. once it is deleted, so
+// that they do not pile up. Its calls still count in the other groupings.
+func (m *Metrics) Forget(conversation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.byConversation, conversation)
+}
+
+// Snapshot returns a copy of the metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MetricsSnapshot{
+		Since:          m.since,
+		Total:          m.total,
+		ByModel:        copyStats(m.byModel),
+		ByConversation: copyStats(m.byConversation),
+		ByDecision:     copyStats(m.byDecision),
+	}
+}
+
+func copyStats(stats map[string]*Stats) map[string]Stats {
+	out := make(map[string]Stats, len(stats))
+	for k, s := range stats {
+		out[k] = *s
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMetricsForget(t *testing.T) {
+	m := NewMetrics()
+	m.Record(Call{Conversation: "a", Decision: DecisionAnswer, Usage: Usage{Model: "fake", TotalTokens: 10}})
+	m.Record(Call{Conversation: "b", Decision: DecisionAnswer, Usage: Usage{Model: "fake", TotalTokens: 5}})
+
+	m.Forget("a")
+	snapshot := m.Snapshot()
+	if _, ok := snapshot.ByConversation["a"]; ok || len(snapshot.ByConversation) != 1 {
+		t.Errorf("ByConversation after Forget(a) = %v, want only b", snapshot.ByConversation)
+	}
+	if m.Conversation("a").Calls != 0 {
+		t.Error("Conversation(a) still has calls")
+	}
+	// the calls still count in the totals
+	if snapshot.Total.TotalTokens != 15 || snapshot.ByModel["fake"].Calls != 2 {
+		t.Errorf("totals after Forget = %+v, by model %+v", snapshot.Total, snapshot.ByModel)
+	}
+}
+
+// reply returns a ChatFunc answering with reply, or err.
+func reply(reply *Message, err error) ChatFunc {
+	return func(context.Context, []Message, []Tool) (*Message, error) {
+		return reply, err
+	}
+}
+
+func toolCalls(names ...string) *Message {
+	m := &Message{Role: "assistant", Usage: &Usage{Model: "fake", TotalTokens: 10}}
+	for _, name := range names {
+		m.ToolCalls = append(m.ToolCalls, ToolCall{Function: FunctionCall{Name: name}})
+	}
+	return m
+}
+
+func TestMetricsByDecision(t *testing.T) {
+	m := NewMetrics()
+	calls := []ChatFunc{
+		reply(toolCalls("getOrder"), nil),
+		reply(toolCalls("getOrder"), nil),
+		reply(toolCalls("getUser", "getOrder"), nil),
+		reply(&Message{Role: "assistant", Content: "done", Usage: &Usage{Model: "fake", TotalTokens: 4, Estimated: true}}, nil),
+		reply(nil, errors.New("boom")),
+	}
+	for _, call := range calls {
+		m.Chat(call, "conv")(context.Background(), nil, nil)
+	}
+
+	snapshot := m.Snapshot()
+	want := map[string]Stats{
+		"getOrder":         {Calls: 2, TotalTokens: 20},
+		"getOrder+getUser": {Calls: 1, TotalTokens: 10},
+		DecisionAnswer:     {Calls: 1, Estimated: 1, TotalTokens: 4},
+		DecisionError:      {Calls: 1, Errors: 1},
+	}
+	if len(snapshot.ByDecision) != len(want) {
+		t.Errorf("decisions = %v, want %v", snapshot.ByDecision, want)
+	}
+	for decision, w := range want {
+		got := snapshot.ByDecision[decision]
+		got.LatencyMs, got.AvgLatencyMs, got.MaxLatencyMs = 0, 0, 0
+		if got != w {
+			t.Errorf("%s: %+v, want %+v", decision, got, w)
+		}
+	}
+	if total := snapshot.Total; total.Calls != 5 || total.Errors != 1 || total.Estimated != 1 || total.TotalTokens != 34 {
+		t.Errorf("total = %+v", total)
+	}
+	if c := m.Conversation("conv"); c.Calls != 5 {
+		t.Errorf("conversation calls = %d, want 5", c.Calls)
+	}
+}
+
+type fakeProvider struct{ reply *Message }
+
+func (p fakeProvider) Chat(context.Context, []Message, []Tool) (*Message, error) {
+	return p.reply, nil
+}
+
+func TestMetricsProvider(t *testing.T) {
+	m := NewMetrics()
+	p := m.Provider(fakeProvider{&Message{Role: "assistant", Content: "summary", Usage: &Usage{TotalTokens: 7}}}, "conv")
+	if _, err := p.Chat(context.Background(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.Conversation("conv"); c.Calls != 1 || c.TotalTokens != 7 {
+		t.Errorf("conversation stats = %+v, want the call of the provider", c)
+	}
+}
@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Ollama is a [Provider] for the native Ollama chat API (/api/chat).
+type Ollama struct {
+	cfg Config
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []Tool          `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+// ollamaMessage differs from Message in the tool calls, whose arguments are
+// a JSON object instead of an encoded string and which carry no ID.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaResponse struct {
+	Model   string        `json:"model"`
+	Message ollamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+	// PromptEvalCount and EvalCount are the prompt and reply tokens, sent
+	// with the last message.
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// usage returns the tokens reported by a final response, if any.
+func (r *ollamaResponse) usage() *Usage {
+	if r.PromptEvalCount+r.EvalCount == 0 {
+		return nil
+	}
+	return &Usage{Model: r.Model, PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount, TotalTokens: r.PromptEvalCount + r.EvalCount}
+}
+
+func (p *Ollama) request(messages []Message, tools []Tool) ollamaRequest {
+	return ollamaRequest{
+		Model:    p.cfg.Model,
+		Messages: toOllama(messages),
+		Tools:    tools,
+		Options:  ollamaOptions{Temperature: p.cfg.Temperature, NumPredict: p.cfg.MaxTokens},
+	}
+}
+
+// Chat implements [Provider].
+func (p *Ollama) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	var resp ollamaResponse
+	if err := p.cfg.post(ctx, "/api/chat", p.request(messages, tools), &resp); err != nil {
+		return nil, err
+	}
+	return withUsage(fromOllama(resp.Message), resp.usage(), p.cfg.Model, messages, tools), nil
+}
+
+// ChatStream implements [StreamProvider]. Ollama streams a JSON object per
+// line; tool calls are not split, each one arrives in a single delta.
+func (p *Ollama) ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(Delta)) (*Message, error) {
+	return p.stream(ctx, messages, p.request(messages, tools), onDelta)
+}
+
+// ChatJSON implements [SchemaProvider], passing schema as the format of the
+// reply.
+func (p *Ollama) ChatJSON(ctx context.Context, messages []Message, schema json.RawMessage, onDelta func(Delta)) (*Message, error) {
+	req := p.request(messages, nil)
+	req.Format = schema
+	if onDelta != nil {
+		return p.stream(ctx, messages, req, onDelta)
+	}
+
+	var resp ollamaResponse
+	if err := p.cfg.post(ctx, "/api/chat", req, &resp); err != nil {
+		return nil, err
+	}
+	return withUsage(fromOllama(resp.Message), resp.usage(), p.cfg.Model, messages, nil), nil
+}
+
+// stream sends req, built from messages, and reads the streamed reply.
+func (p *Ollama) stream(ctx context.Context, messages []Message, req ollamaRequest, onDelta func(Delta)) (*Message, error) {
+	req.Stream = true
+	resp, err := p.cfg.do(ctx, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	a := &assembler{onDelta: onDelta}
+	var usage *Usage
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaResponse
+		if err := dec.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("llm: reading stream: %w", err)
+		}
+
+		a.add(Delta{Content: chunk.Message.Content})
+		for _, tc := range fromOllama(chunk.Message).ToolCalls {
+			index := len(a.toolCalls)
+			a.add(Delta{ToolCall: &ToolCallDelta{
+				Index:     index,
+				ID:        fmt.Sprintf("call_%d", index),
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			}})
+		}
+		if chunk.Done {
+			usage = chunk.usage()
+			break
+		}
+	}
+	return withUsage(a.message(), usage, p.cfg.Model, messages, req.Tools), nil
+}
+
+func toOllama(messages []Message) []ollamaMessage {
+	// Ollama matches tool results by tool name, not by call ID
+	names := make(map[string]string)
+
+	out := make([]ollamaMessage, len(messages))
+	for i, m := range messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content, ToolName: names[m.ToolCallID]}
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		out[i] = om
+	}
+	return out
+}
+
+func fromOllama(om ollamaMessage) *Message {
+	m := &Message{Role: om.Role, Content: om.Content}
+	if m.Role == "" {
+		m.Role = RoleAssistant
+	}
+	for i, call := range om.ToolCalls {
+		var tc ToolCall
+		tc.ID = fmt.Sprintf("call_%d", i)
+		tc.Type = "function"
+		tc.Function.Name = call.Function.Name
+		tc.Function.Arguments = string(call.Function.Arguments)
+		if tc.Function.Arguments == "" || tc.Function.Arguments == "null" {
+			tc.Function.Arguments = "{}"
+		}
+		m.ToolCalls = append(m.ToolCalls, tc)
+	}
+	return m
+}
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ollamaServer answers /api/chat with body, keeping the last request in
+// *got.
+func ollamaServer(t *testing.T, body string, got *map[string]any) Provider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	p, err := New(Config{Provider: ProviderOllama, BaseURL: server.URL + "/", Model: "qwen", MaxTokens: 64, Temperature: 0.2, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// The tool calls of the history are sent with their arguments as objects,
+// and their results with the name of the tool.
+func TestOllamaRequest(t *testing.T) {
+	var got map[string]any
+	p := ollamaServer(t, `{"message":{"role":"assistant","content":"ok"},"done":true}`, &got)
+	history := []Message{
+		{Role: RoleUser, Content: "Where is order 42?"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{
+			{ID: "call_a", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"42"}`}},
+			{ID: "call_b", Type: "function", Function: FunctionCall{Name: "getUser", Arguments: `not json`}},
+		}},
+		{Role: RoleTool, ToolCallID: "call_a", Content: "shipped"},
+		{Role: RoleTool, ToolCallID: "call_b", Content: "João"},
+	}
+	tools := []Tool{{Type: "function", Function: Function{Name: "getOrder"}}}
+	if _, err := p.Chat(context.Background(), history, tools); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"model":  "qwen",
+		"stream": false,
+		"options": map[string]any{
+			"temperature": 0.2,
+			"num_predict": float64(64),
+		},
+		"messages": []any{
+			map[string]any{"role": "user", "content": "Where is order 42?"},
+			map[string]any{"role": "assistant", "content": "", "tool_calls": []any{
+				map[string]any{"function": map[string]any{"name": "getOrder", "arguments": map[string]any{"idOrder": "42"}}},
+				map[string]any{"function": map[string]any{"name": "getUser", "arguments": map[string]any{}}},
+			}},
+			map[string]any{"role": "tool", "content": "shipped", "tool_name": "getOrder"},
+			map[string]any{"role": "tool", "content": "João", "tool_name": "getUser"},
+		},
+	}
+	tool, _ := got["tools"].([]any)
+	delete(got, "tools")
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("request =\n%s", gotJSON)
+	}
+	if len(tool) != 1 {
+		t.Errorf("tools = %v, want getOrder", tool)
+	}
+}
+
+func TestOllamaResponse(t *testing.T) {
+	var got map[string]any
+	p := ollamaServer(t, `{"model":"qwen:4b","message":{"role":"assistant","content":"","tool_calls":[
+		{"function":{"name":"getOrder","arguments":{"idOrder":"42"}}},
+		{"function":{"name":"listOrders"}}]},
+		"done":true,"prompt_eval_count":30,"eval_count":12}`, &got)
+	reply, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "orders?"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ToolCall{
+		{ID: "call_0", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"42"}`}},
+		{ID: "call_1", Type: "function", Function: FunctionCall{Name: "listOrders", Arguments: "{}"}},
+	}
+	if reply.Role != RoleAssistant || !reflect.DeepEqual(reply.ToolCalls, want) {
+		t.Errorf("reply = %+v, want the calls %+v", reply, want)
+	}
+	if u := reply.Usage; u == nil || *u != (Usage{Model: "qwen:4b", PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}) {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	var got map[string]any
+	p := ollamaServer(t, strings.Join([]string{
+		`{"message":{"role":"assistant","content":"Let "},"done":false}`,
+		`{"message":{"role":"assistant","content":"me check."},"done":false}`,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"getOrder","arguments":{"idOrder":"42"}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"getOrder","arguments":{"idOrder":"43"}}}]},"done":false}`,
+		`{"model":"qwen","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":10,"eval_count":5}`,
+		`{"message":{"role":"assistant","content":"after the end"},"done":false}`,
+	}, "\n")+"\n", &got)
+
+	var deltas []Delta
+	reply, err := Stream(context.Background(), p, []Message{{Role: RoleUser, Content: "orders 42 and 43?"}}, nil, func(d Delta) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["stream"] != true {
+		t.Errorf("stream = %v, want true", got["stream"])
+	}
+
+	if reply.Content != "Let me check." {
+		t.Errorf("content = %q", reply.Content)
+	}
+	want := []ToolCall{
+		{ID: "call_0", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"42"}`}},
+		{ID: "call_1", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"43"}`}},
+	}
+	if !reflect.DeepEqual(reply.ToolCalls, want) {
+		t.Errorf("tool calls = %+v, want %+v", reply.ToolCalls, want)
+	}
+	// two pieces of text and a delta per call, nothing after done
+	if len(deltas) != 4 || deltas[3].ToolCall == nil || deltas[3].ToolCall.Index != 1 {
+		t.Errorf("deltas = %+v", deltas)
+	}
+	if reply.Usage == nil || reply.Usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v, want the one of the last line", reply.Usage)
+	}
+}
+
+func TestOllamaStreamInvalid(t *testing.T) {
+	var got map[string]any
+	p := ollamaServer(t, `{"message":{"content":"Hi"},"done":false}`+"\n{not json\n", &got)
+	if _, err := Stream(context.Background(), p, []Message{{Role: RoleUser, Content: "hi"}}, nil, func(Delta) {}); err == nil {
+		t.Error("Stream of an invalid line succeeded")
+	}
+}
+
+func TestOllamaChatJSON(t *testing.T) {
+	var got map[string]any
+	p := ollamaServer(t, `{"message":{"role":"assistant","content":"{\"operation\":\"sum\",\"x\":1,\"y\":2}"},"done":true}`, &got)
+	var op operation
+	if err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "1 plus 2"}}, operationSchema, &op, nil); err != nil {
+		t.Fatal(err)
+	}
+	if op != (operation{"sum", 1, 2}) {
+		t.Errorf("Extract = %+v", op)
+	}
+	if format, _ := got["format"].(map[string]any); format["type"] != "object" {
+		t.Errorf("format = %v, want the schema", got["format"])
+	}
+}
@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// OpenAIChat is a [Provider] for OpenAI compatible chat completions APIs.
+type OpenAIChat struct {
+	cfg Config
+
+	// noResponseFormat is set once the server rejected response_format.
+	noResponseFormat atomic.Bool
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Tools          []Tool          `json:"tools,omitempty"`
+	MaxTokens      int             `json:"max_tokens"`
+	Temperature    float64         `json:"temperature"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// chatChunk is an event of a streamed chat completion. With include_usage
+// the last one has no choices and carries the usage.
+type chatChunk struct {
+	Model   string       `json:"model"`
+	Usage   *openAIUsage `json:"usage"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+func (p *OpenAIChat) request(messages []Message, tools []Tool) chatRequest {
+	return chatRequest{
+		Model:       p.cfg.Model,
+		Messages:    messages,
+		Tools:       tools,
+		MaxTokens:   p.cfg.MaxTokens,
+		Temperature: p.cfg.Temperature,
+	}
+}
+
+// Chat implements [Provider].
+func (p *OpenAIChat) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	return p.send(ctx, p.request(messages, tools), nil)
+}
+
+// ChatStream implements [StreamProvider] with server-sent events.
+func (p *OpenAIChat) ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(Delta)) (*Message, error) {
+	return p.send(ctx, p.request(messages, tools), onDelta)
+}
+
+// ChatJSON implements [SchemaProvider] with a json_schema response_format.
+// Servers that reject it, with an error naming it, are asked again, and from
+// then on, without it.
+func (p *OpenAIChat) ChatJSON(ctx context.Context, messages []Message, schema json.RawMessage, onDelta func(Delta)) (*Message, error) {
+	req := p.request(messages, nil)
+	if p.noResponseFormat.Load() {
+		return p.send(ctx, req, onDelta)
+	}
+
+	req.ResponseFormat = &responseFormat{Type: "json_schema"}
+	req.ResponseFormat.JSONSchema.Name = "response"
+	req.ResponseFormat.JSONSchema.Schema = schema
+
+	reply, err := p.send(ctx, req, onDelta)
+	var se *StatusError
+	if errors.As(err, &se) && rejectsResponseFormat(se) {
+		p.noResponseFormat.Store(true)
+		req.ResponseFormat = nil
+		return p.send(ctx, req, onDelta)
+	}
+	return reply, err
+}
+
+// rejectsResponseFormat reports whether se is the server refusing
+// response_format, rather than any other bad request such as an unknown model
+// or a context too long.
+func rejectsResponseFormat(se *StatusError) bool {
+	if se.StatusCode != http.StatusBadRequest && se.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	body := strings.ToLower(se.Body)
+	return strings.Contains(body, "response_format") || strings.Contains(body, "json_schema")
+}
+
+// send sends req, streaming the reply to onDelta when it is not nil.
+func (p *OpenAIChat) send(ctx context.Context, req chatRequest, onDelta func(Delta)) (*Message, error) {
+	if onDelta == nil {
+		var resp chatResponse
+		if err := p.cfg.post(ctx, "/chat/completions", req, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("llm: no choices returned")
+		}
+		return withUsage(&resp.Choices[0].Message, resp.Usage.usage(resp.Model), p.cfg.Model, req.Messages, req.Tools), nil
+	}
+
+	req.Stream = true
+	req.StreamOptions = &streamOptions{IncludeUsage: true}
+	resp, err := p.cfg.do(ctx, "/chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	a := &assembler{onDelta: onDelta}
+	var usage *Usage
+	err = readSSE(resp.Body, func(data []byte) error {
+		var chunk chatChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("llm: invalid stream event: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage(chunk.Model)
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		delta := chunk.Choices[0].Delta
+		a.add(Delta{Content: delta.Content})
+		for _, tc := range delta.ToolCalls {
+			a.add(Delta{ToolCall: &ToolCallDelta{
+				Index:     tc.Index,
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			}})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("llm: reading stream: %w", err)
+	}
+	return withUsage(a.message(), usage, p.cfg.Model, req.Messages, req.Tools), nil
+}
+
+// Completions is a [Provider] for the legacy OpenAI completions API. The
+// conversation is sent as a single prompt, so it cannot offer tools.
+type Completions struct {
+	cfg Config
+}
+
+type completionRequest struct {
+	Model         string         `json:"model"`
+	Prompt        string         `json:"prompt"`
+	MaxTokens     int            `json:"max_tokens"`
+	Temperature   float64        `json:"temperature"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+type completionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Text string `json:"text"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func (p *Completions) request(messages []Message) completionRequest {
+	return completionRequest{
+		Model:       p.cfg.Model,
+		Prompt:      prompt(messages),
+		MaxTokens:   p.cfg.MaxTokens,
+		Temperature: p.cfg.Temperature,
+	}
+}
+
+// Chat implements [Provider].
+func (p *Completions) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	if len(tools) > 0 {
+		return nil, ErrToolsUnsupported
+	}
+
+	var resp completionResponse
+	if err := p.cfg.post(ctx, "/completions", p.request(messages), &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("llm: no choices returned")
+	}
+	reply := &Message{Role: RoleAssistant, Content: resp.Choices[0].Text}
+	return withUsage(reply, resp.Usage.usage(resp.Model), p.cfg.Model, messages, nil), nil
+}
+
+// ChatStream implements [StreamProvider] with server-sent events.
+func (p *Completions) ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(Delta)) (*Message, error) {
+	if len(tools) > 0 {
+		return nil, ErrToolsUnsupported
+	}
+
+	req := p.request(messages)
+	req.Stream = true
+	req.StreamOptions = &streamOptions{IncludeUsage: true}
+
+	resp, err := p.cfg.do(ctx, "/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	a := &assembler{onDelta: onDelta}
+	var usage *Usage
+	err = readSSE(resp.Body, func(data []byte) error {
+		var chunk completionResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("llm: invalid stream event: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage(chunk.Model)
+		}
+		if len(chunk.Choices) > 0 {
+			a.add(Delta{Content: chunk.Choices[0].Text})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("llm: reading stream: %w", err)
+	}
+	return withUsage(a.message(), usage, p.cfg.Model, messages, nil), nil
+}
+
+// prompt flattens a conversation into a completions prompt. A lone user
+// message is sent as is.
+func prompt(messages []Message) string {
+	if len(messages) == 1 && messages[0].Role == RoleUser {
+		return messages[0].Content
+	}
+
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case RoleSystem:
+			b.WriteString(m.Content)
+		case RoleAssistant:
+			b.WriteString("Assistant: " + m.Content)
+		case RoleTool:
+			b.WriteString("Tool result: " + m.Content)
+		default:
+			b.WriteString("User: " + m.Content)
+		}
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Assistant:")
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names accepted by [Config.Provider].
+const (
+	// ProviderOpenAI is an OpenAI compatible chat completions API
+	// (LM Studio, llama.cpp, vLLM, OpenAI...).
+	ProviderOpenAI = "openai"
+	// ProviderCompletions is the legacy OpenAI completions API, which only
+	// takes a prompt.
+	ProviderCompletions = "completions"
+	// ProviderOllama is the native Ollama chat API.
+	ProviderOllama = "ollama"
+)
+
+// Defaults of [Config], matching a local LM Studio or Ollama install.
+const (
+	DefaultOpenAIURL   = "http://127.0.0.1:1234/v1"
+	DefaultOllamaURL   = "http://127.0.0.1:11434"
+	DefaultModel       = "qwen/qwen3-vl-4b"
+	DefaultOllamaModel = "qwen3-vl:4b"
+	DefaultMaxTokens   = 512
+)
+
+// ErrToolsUnsupported is returned by providers whose API cannot describe
+// tools to the model.
+var ErrToolsUnsupported = errors.New("llm: provider does not support tools")
+
+// Provider sends a conversation to a language model. Its Chat method is a
+// [ChatFunc], so a provider can drive [RunAgent] directly.
+type Provider interface {
+	// Chat sends the conversation and the tools the model may call and
+	// returns the reply of the model.
+	Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error)
+}
+
+// Config selects and configures a [Provider]. The zero value uses an OpenAI
+// compatible server on the default LM Studio address.
+type Config struct {
+	// Provider is one of ProviderOpenAI (the default), ProviderCompletions
+	// or ProviderOllama.
+	Provider string
+	// BaseURL is the root of the API, e.g. http://127.0.0.1:1234/v1 for
+	// OpenAI compatible servers or http://127.0.0.1:11434 for Ollama.
+	BaseURL string
+	Model   string
+	// APIKey, when set, is sent as a bearer token.
+	APIKey      string
+	MaxTokens   int
+	Temperature float64
+
+	// HTTPClient is used for the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	// Timeout bounds each attempt until the response starts, which for a
+	// reply that is not streamed means the whole generation; DefaultTimeout
+	// when zero.
+	Timeout time.Duration
+	// Retries is the number of extra attempts after a timeout, a connection
+	// failure, a 429 or a 5xx; DefaultRetries when zero, none when negative.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each next one
+	// and capped at MaxBackoff; a longer Retry-After from the server wins.
+	// DefaultBackoff when zero.
+	Backoff time.Duration
+	// BreakerThreshold consecutive failed attempts open the circuit breaker
+	// of the provider: calls then fail at once with ErrCircuitOpen for
+	// BreakerCooldown, after which one call probes the server again.
+	// DefaultBreakerThreshold and DefaultBreakerCooldown when zero; a
+	// negative threshold disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	breaker *breaker
+}
+
+// RegisterFlags defines the -llm-* flags on fs, storing their values in c.
+// The defaults are the LLM_PROVIDER, LLM_BASE_URL, LLM_MODEL, LLM_API_KEY,
+// LLM_MAX_TOKENS, LLM_TEMPERATURE, LLM_TIMEOUT and LLM_RETRIES environment
+// variables when set, and the current values of c (or the package defaults)
+// otherwise.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	c.loadEnv()
+	fs.StringVar(&c.Provider, "llm-provider", c.Provider, "LLM API: openai (chat completions), completions (legacy) or ollama")
+	fs.StringVar(&c.BaseURL, "llm-url", c.BaseURL, "base URL of the LLM API (default depends on the provider)")
+	fs.StringVar(&c.Model, "llm-model", c.Model, "LLM model (default depends on the provider)")
+	fs.StringVar(&c.APIKey, "llm-api-key", c.APIKey, "API key sent as a bearer token")
+	fs.IntVar(&c.MaxTokens, "llm-max-tokens", c.MaxTokens, "maximum number of tokens of a reply")
+	fs.Float64Var(&c.Temperature, "llm-temperature", c.Temperature, "sampling temperature")
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+	fs.DurationVar(&c.Timeout, "llm-timeout", c.Timeout, "timeout of each request until the reply starts")
+	fs.IntVar(&c.Retries, "llm-retries", c.Retries, "retries after a timeout, a connection failure, a 429 or a 5xx (negative disables them)")
+}
+
+func (c *Config) loadEnv() {
+	if v := os.Getenv("LLM_PROVIDER"); v != "" {
+		c.Provider = v
+	}
+	if v := os.Getenv("LLM_BASE_URL"); v != "" {
+		c.BaseURL = v
+	}
+	if v := os.Getenv("LLM_MODEL"); v != "" {
+		c.Model = v
+	}
+	if v := os.Getenv("LLM_API_KEY"); v != "" {
+		c.APIKey = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LLM_MAX_TOKENS")); err == nil {
+		c.MaxTokens = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("LLM_TEMPERATURE"), 64); err == nil {
+		c.Temperature = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("LLM_TIMEOUT")); err == nil {
+		c.Timeout = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LLM_RETRIES")); err == nil {
+		c.Retries = v
+	}
+}
+
+// New returns the provider selected by cfg.
+func New(cfg Config) (Provider, error) {
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = DefaultMaxTokens
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	cfg.setRetryDefaults()
+
+	switch strings.ToLower(cfg.Provider) {
+	case "", ProviderOpenAI:
+		cfg.setDefaults(DefaultOpenAIURL, DefaultModel)
+		return &OpenAIChat{cfg: cfg}, nil
+	case ProviderCompletions:
+		cfg.setDefaults(DefaultOpenAIURL, DefaultModel)
+		return &Completions{cfg: cfg}, nil
+	case ProviderOllama:
+		cfg.setDefaults(DefaultOllamaURL, DefaultOllamaModel)
+		return &Ollama{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("llm: unknown provider %q", cfg.Provider)
+	}
+}
+
+func (c *Config) setDefaults(baseURL, model string) {
+	if c.BaseURL == "" {
+		c.BaseURL = baseURL
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	if c.Model == "" {
+		c.Model = model
+	}
+}
+
+// post sends body as JSON to path under the base URL of cfg and decodes the
+// JSON response into out.
+func (c *Config) post(ctx context.Context, path string, body, out any) error {
+	resp, err := c.do(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("llm: reading response: %w", err)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("llm: invalid response: %w", err)
+	}
+	return nil
+}
+
+// do sends body as JSON to path under the base URL of cfg, retrying as
+// configured. The caller must close the body of the response, whose status
+// is successful.
+func (c *Config) do(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.retry(ctx, func(ctx context.Context) (*http.Response, error) {
+		return c.attempt(ctx, path, data)
+	})
+}
+
+// attempt sends one request, failing with ErrTimeout when the response does
+// not start within the timeout.
+func (c *Config) attempt(ctx context.Context, path string, data []byte) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(c.Timeout, func() { cancel(ErrTimeout) })
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if !timer.Stop() && err == nil {
+		// the timeout fired just as the response arrived
+		resp.Body.Close()
+		err = ErrTimeout
+	}
+	if err != nil {
+		timedOut := errors.Is(context.Cause(ctx), ErrTimeout)
+		cancel(nil)
+		if timedOut {
+			return nil, fmt.Errorf("%w after %s", ErrTimeout, c.Timeout)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer cancel(nil)
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(bytes.TrimSpace(respBody)),
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of an attempt once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
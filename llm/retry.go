@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of the retry policy of [Config].
+const (
+	DefaultTimeout          = 2 * time.Minute
+	DefaultRetries          = 2
+	DefaultBackoff          = 500 * time.Millisecond
+	MaxBackoff              = 10 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+var (
+	// ErrTimeout reports a request whose response did not start within
+	// [Config.Timeout].
+	ErrTimeout = errors.New("llm: timeout")
+	// ErrUnavailable reports a request that could not reach the server.
+	ErrUnavailable = errors.New("llm: server unavailable")
+	// ErrCircuitOpen reports a call refused without contacting the server,
+	// because the last attempts failed; see [Config.BreakerThreshold].
+	ErrCircuitOpen = errors.New("llm: circuit breaker open")
+)
+
+// StatusError is a response with an unsuccessful status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Body is the start of the response body, usually the error message of
+	// the server.
+	Body string
+	// RetryAfter is the wait asked for by a Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("llm: %s: %s", e.Status, e.Body)
+}
+
+// Temporary reports whether the request may succeed if retried: the server
+// is overloaded (429) or failed (5xx).
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || (e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented)
+}
+
+// RetryError is returned when every attempt allowed by [Config.Retries]
+// failed. Err is the error of the last one, wrapped with [ErrCircuitOpen]
+// when the circuit breaker opened before the retries ran out.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error { return e.Err }
+
+// retryable reports whether err is worth another attempt.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+}
+
+func (c *Config) setRetryDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	switch {
+	case c.Retries == 0:
+		c.Retries = DefaultRetries
+	case c.Retries < 0:
+		c.Retries = 0
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if c.BreakerThreshold > 0 {
+		c.breaker = &breaker{threshold: c.BreakerThreshold, cooldown: c.BreakerCooldown}
+	}
+}
+
+// retry runs send until it succeeds, fails with an error that is not
+// temporary, the retries are exhausted or the circuit breaker opens.
+func (c *Config) retry(ctx context.Context, send func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(c.backoff(attempt, lastErr))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				// both the cancellation and what the server last said
+				t.Stop()
+				return nil, fmt.Errorf("llm: %w (last error: %w)", ctx.Err(), lastErr)
+			}
+		}
+
+		if err := c.breaker.allow(); err != nil {
+			if lastErr != nil {
+				// opened by the failures of this call: keep what the server said
+				return nil, &RetryError{Attempts: attempt, Err: fmt.Errorf("%w (last error: %w)", err, lastErr)}
+			}
+			return nil, err
+		}
+
+		resp, err := send(ctx)
+		switch {
+		case err == nil:
+			c.breaker.record(false)
+			return resp, nil
+		case ctx.Err() != nil:
+			// canceled by the caller, which says nothing about the server
+			c.breaker.release()
+			return nil, fmt.Errorf("llm: %w", ctx.Err())
+		case !retryable(err):
+			c.breaker.record(false)
+			return nil, err
+		}
+
+		c.breaker.record(true)
+		lastErr = err
+		if attempt >= c.Retries {
+			if attempt == 0 {
+				return nil, err
+			}
+			return nil, &RetryError{Attempts: attempt + 1, Err: err}
+		}
+	}
+}
+
+// backoff returns the wait before the given retry: an exponential backoff
+// with jitter, or the Retry-After of the last response when longer.
+func (c *Config) backoff(attempt int, lastErr error) time.Duration {
+	d := c.Backoff << (attempt - 1)
+	if d <= 0 || d > MaxBackoff {
+		d = MaxBackoff
+	}
+	d = d/2 + rand.N(d/2+1)
+
+	var se *StatusError
+	if errors.As(lastErr, &se) && se.RetryAfter > d {
+		d = min(se.RetryAfter, c.Timeout)
+	}
+	return d
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// breaker is the circuit breaker shared by the calls of a provider. A nil
+// breaker lets every call through.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int // consecutive failed attempts
+	openUntil time.Time
+	probing   bool // a call is testing the server after the cooldown
+}
+
+// allow returns ErrCircuitOpen while the breaker is open. Once the cooldown
+// is over, one call at a time is let through to probe the server.
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return fmt.Errorf("%w, retrying in %s", ErrCircuitOpen, wait.Round(100*time.Millisecond))
+	}
+	if b.probing {
+		return fmt.Errorf("%w, probing the server", ErrCircuitOpen)
+	}
+	b.probing = true
+	return nil
+}
+
+// record counts the outcome of an attempt let through by allow.
+func (b *breaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// release ends an attempt without counting it.
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
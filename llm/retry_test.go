@@ -0,0 +1,293 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky serves the replies of statuses in turn, then 200s, and counts the
+// requests in *requests.
+func flaky(t *testing.T, requests *atomic.Int32, statuses ...int) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(requests.Add(1)); n <= len(statuses) {
+			http.Error(w, http.StatusText(statuses[n-1]), statuses[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func hello(p Provider) error {
+	_, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil)
+	return err
+}
+
+func TestRetryTemporary(t *testing.T) {
+	var requests atomic.Int32
+	p, err := New(Config{BaseURL: flaky(t, &requests, 503, 429), Retries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hello(p); err != nil {
+		t.Fatalf("Chat after a 503 and a 429: %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var requests atomic.Int32
+	p, err := New(Config{BaseURL: flaky(t, &requests, 500, 502, 500, 500), Retries: 2, Backoff: time.Millisecond, BreakerThreshold: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hello(p)
+	var (
+		retryErr  *RetryError
+		statusErr *StatusError
+	)
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 {
+		t.Fatalf("Chat = %v, want a RetryError after 3 attempts", err)
+	}
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Chat = %v, want the 500 of the last attempt", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRetryNotTemporary(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented} {
+		var requests atomic.Int32
+		p, err := New(Config{BaseURL: flaky(t, &requests, status), Retries: 2, Backoff: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = hello(p)
+		var retryErr *RetryError
+		if err == nil || errors.As(err, &retryErr) || requests.Load() != 1 {
+			t.Errorf("%d: Chat = %v after %d requests, want the error of the only one", status, err, requests.Load())
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	p, err := New(Config{BaseURL: server.URL, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *StatusError
+	if err := hello(p); !errors.As(err, &statusErr) || statusErr.RetryAfter != 3*time.Second {
+		t.Fatalf("Chat = %v, want a 429 asking for 3s", err)
+	}
+
+	// a longer Retry-After wins over the backoff, within the timeout
+	c := Config{Backoff: time.Millisecond, Timeout: 2 * time.Second}
+	if d := c.backoff(1, statusErr); d != 2*time.Second {
+		t.Errorf("backoff = %v, want the Retry-After capped at the timeout", d)
+	}
+	c.Timeout = time.Minute
+	if d := c.backoff(1, statusErr); d != 3*time.Second {
+		t.Errorf("backoff = %v, want the Retry-After", d)
+	}
+	if d := c.backoff(1, &StatusError{StatusCode: http.StatusServiceUnavailable}); d > time.Millisecond {
+		t.Errorf("backoff = %v, want at most the configured one", d)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"2", 2 * time.Second, 2 * time.Second},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		if d := retryAfter(tt.value); d < tt.min || d > tt.max {
+			t.Errorf("retryAfter(%q) = %v, want between %v and %v", tt.value, d, tt.min, tt.max)
+		}
+	}
+}
+
+func TestBackoffGrows(t *testing.T) {
+	c := Config{Backoff: 100 * time.Millisecond, Timeout: time.Minute}
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 20: MaxBackoff} {
+		if d := c.backoff(attempt, nil); d < limit/2 || d > limit {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, d, limit/2, limit)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// the body read, the server sees the client give up
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	p, err := New(Config{BaseURL: server.URL, Timeout: 50 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hello(p)
+	var retryErr *RetryError
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &retryErr) || retryErr.Attempts != 2 {
+		t.Fatalf("Chat = %v, want ErrTimeout after 2 attempts", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+	var (
+		requests atomic.Int32
+		failing  atomic.Bool
+	)
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+	p, err := New(Config{BaseURL: server.URL, Retries: -1, BreakerThreshold: 2, BreakerCooldown: cooldown})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two failures open the breaker, which then refuses calls at once
+	for range 2 {
+		if err := hello(p); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Chat = %v before the threshold", err)
+		}
+	}
+	if err := hello(p); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Chat = %v, want %v", err, ErrCircuitOpen)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2: the open breaker sent one", n)
+	}
+
+	// after the cooldown a failed probe opens it again
+	time.Sleep(cooldown)
+	if err := hello(p); errors.Is(err, ErrCircuitOpen) || requests.Load() != 3 {
+		t.Fatalf("probe = %v after %d requests, want it sent", err, requests.Load())
+	}
+	if err := hello(p); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Chat after a failed probe = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// and a successful one closes it
+	time.Sleep(cooldown)
+	failing.Store(false)
+	for range 3 {
+		if err := hello(p); err != nil {
+			t.Fatalf("Chat once the server is back: %v", err)
+		}
+	}
+}
+
+// After the cooldown, one call at a time probes the server.
+func TestBreakerHalfOpen(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+	b := &breaker{threshold: 1, cooldown: cooldown}
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.record(true)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow = %v during the cooldown, want %v", err, ErrCircuitOpen)
+	}
+
+	time.Sleep(cooldown)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow = %v during the probe, want %v", err, ErrCircuitOpen)
+	}
+	// a canceled probe lets the next call probe instead
+	b.release()
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after a released one refused: %v", err)
+	}
+	b.record(false)
+	if err := b.allow(); err != nil {
+		t.Errorf("allow = %v once the probe succeeded", err)
+	}
+}
+
+// A breaker opening between retries stops them, and the error tells both.
+func TestBreakerOpensDuringRetries(t *testing.T) {
+	var requests atomic.Int32
+	p, err := New(Config{BaseURL: flaky(t, &requests, 503, 503, 503, 503, 503), Retries: 4, Backoff: time.Millisecond, BreakerThreshold: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hello(p)
+	var (
+		retryErr  *RetryError
+		statusErr *StatusError
+	)
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &retryErr) || retryErr.Attempts != 2 {
+		t.Fatalf("Chat = %v, want %v after 2 attempts", err, ErrCircuitOpen)
+	}
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Chat = %v, want the 503 of the last attempt too", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+// A context ending during the backoff is reported along with the error that
+// caused the retry.
+func TestRetryCanceledDuringBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	provider, err := New(Config{BaseURL: server.URL, Retries: 3, Backoff: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = provider.Chat(ctx, []Message{{Role: RoleUser, Content: "hi"}}, nil)
+
+	var statusErr *StatusError
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Chat = %v, want the deadline and the 503", err)
+	}
+}
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// DefaultMaxAttempts bounds the model calls of [Extract] when
+// [ExtractOptions.MaxAttempts] is not set.
+const DefaultMaxAttempts = 3
+
+// ErrNoJSON is returned when a reply does not contain a JSON object.
+var ErrNoJSON = errors.New("llm: no JSON object in the reply")
+
+// SchemaProvider is a [Provider] that can constrain its replies to a JSON
+// schema, with response_format in OpenAI compatible APIs or format in Ollama.
+type SchemaProvider interface {
+	Provider
+	// ChatJSON is Chat without tools, asking for a reply that is a JSON
+	// value matching schema. The reply is streamed to onDelta when it is not
+	// nil.
+	ChatJSON(ctx context.Context, messages []Message, schema json.RawMessage, onDelta func(Delta)) (*Message, error)
+}
+
+// ExtractOptions configures [Extract]. The zero value is valid.
+type ExtractOptions struct {
+	// MaxAttempts is the maximum number of model calls. It defaults to
+	// [DefaultMaxAttempts].
+	MaxAttempts int
+	// OnDelta, when set, receives the replies as they are generated.
+	OnDelta func(Delta)
+	// OnRetry, when set, is called with the reason a reply was rejected,
+	// before the model is asked again.
+	OnRetry func(attempt int, err error)
+}
+
+// Extract asks the model for a JSON object matching schema, such as the
+// input schema of an MCP tool, and decodes it into out.
+//
+// The schema is sent to providers implementing [SchemaProvider]; other
+// providers are only told about it in the conversation. Either way the JSON
+// object is looked for in the reply with [FindJSON] and validated against
+// schema. A reply that fails is sent back to the model with the error, up to
+// MaxAttempts times.
+func Extract(ctx context.Context, p Provider, messages []Message, schema any, out any, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	raw, resolved, err := resolveSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	messages = append([]Message(nil), messages...)
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		reply, err := chatJSON(ctx, p, messages, raw, opts.OnDelta)
+		if err != nil {
+			return err
+		}
+
+		data, err := validate(resolved, reply.Content)
+		if err == nil {
+			return json.Unmarshal(data, out)
+		}
+		lastErr = err
+		if attempt == maxAttempts {
+			break
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, err)
+		}
+
+		messages = append(messages,
+			Message{Role: RoleAssistant, Content: reply.Content},
+			Message{Role: RoleUser, Content: fmt.Sprintf("Your reply is invalid: %v. Reply only with a JSON object matching this JSON schema: %s", err, raw)},
+		)
+	}
+	return fmt.Errorf("llm: no valid reply after %d attempts: %w", maxAttempts, lastErr)
+}
+
+func chatJSON(ctx context.Context, p Provider, messages []Message, schema json.RawMessage, onDelta func(Delta)) (*Message, error) {
+	if sp, ok := p.(SchemaProvider); ok {
+		return sp.ChatJSON(ctx, messages, schema, onDelta)
+	}
+	if onDelta != nil {
+		return Stream(ctx, p, messages, nil, onDelta)
+	}
+	return p.Chat(ctx, messages, nil)
+}
+
+// ValidateJSON checks that data is a JSON value matching schema.
+func ValidateJSON(schema any, data []byte) error {
+	_, resolved, err := resolveSchema(schema)
+	if err != nil {
+		return err
+	}
+	var instance any
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return resolved.Validate(instance)
+}
+
+// resolveSchema returns schema, which can be any JSON encodable value, as
+// JSON and ready to validate with.
+func resolveSchema(schema any) (json.RawMessage, *jsonschema.Resolved, error) {
+	var raw json.RawMessage
+	switch s := schema.(type) {
+	case json.RawMessage:
+		raw = s
+	case []byte:
+		raw = s
+	case string:
+		raw = json.RawMessage(s)
+	default:
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return nil, nil, fmt.Errorf("llm: encoding schema: %w", err)
+		}
+		raw = data
+	}
+
+	var s jsonschema.Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, nil, fmt.Errorf("llm: invalid schema: %w", err)
+	}
+	// Only draft 2020-12 can be validated, but the keywords used by tool
+	// schemas mean the same in the older drafts
+	s.Schema = ""
+	resolved, err := s.Resolve(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("llm: invalid schema: %w", err)
+	}
+	return raw, resolved, nil
+}
+
+// validate finds the JSON object of a reply and validates it.
+func validate(resolved *jsonschema.Resolved, reply string) ([]byte, error) {
+	text, err := FindJSON(reply)
+	if err != nil {
+		return nil, err
+	}
+	var instance any
+	if err := json.Unmarshal([]byte(text), &instance); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := resolved.Validate(instance); err != nil {
+		return nil, err
+	}
+	return []byte(text), nil
+}
+
+var (
+	thinkBlock = regexp.MustCompile(`(?s)<think>.*?</think>`)
+	codeFence  = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*(.*?)```")
+)
+
+// FindJSON returns the first JSON object of a model reply, ignoring the
+// reasoning of thinking models, code fences and any prose around it.
+func FindJSON(reply string) (string, error) {
+	reply = thinkBlock.ReplaceAllString(reply, "")
+
+	// a fenced block is where the model meant to put it
+	for _, m := range codeFence.FindAllStringSubmatch(reply, -1) {
+		if obj, ok := firstObject(m[1]); ok {
+			return obj, nil
+		}
+	}
+	if obj, ok := firstObject(reply); ok {
+		return obj, nil
+	}
+	return "", ErrNoJSON
+}
+
+// firstObject returns the first balanced {...} of s that is valid JSON.
+func firstObject(s string) (string, bool) {
+	for start := strings.IndexByte(s, '{'); start >= 0; {
+		if end := objectEnd(s[start:]); end > 0 {
+			if obj := s[start : start+end]; json.Valid([]byte(obj)) {
+				return obj, true
+			}
+		}
+		next := strings.IndexByte(s[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += 1 + next
+	}
+	return "", false
+}
+
+// objectEnd returns the length of the object s starts with, or 0 when it is
+// not closed.
+func objectEnd(s string) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// scripted is a Provider answering with replies in turn, and keeping the
+// messages of every call.
+type scripted struct {
+	mu      sync.Mutex
+	replies []*Message
+	calls   [][]Message
+}
+
+func (p *scripted) Chat(_ context.Context, messages []Message, _ []Tool) (*Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, append([]Message(nil), messages...))
+	if len(p.replies) == 0 {
+		return nil, errors.New("no more replies")
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply, nil
+}
+
+func answers(contents ...string) *scripted {
+	p := &scripted{}
+	for _, content := range contents {
+		p.replies = append(p.replies, &Message{Role: RoleAssistant, Content: content})
+	}
+	return p
+}
+
+func TestFindJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"bare", `{"operation":"sum","x":1,"y":2}`, `{"operation":"sum","x":1,"y":2}`},
+		{"prose around", `Here it is: {"x":1} as asked.`, `{"x":1}`},
+		{"nested", `{"order":{"lines":[{"sku":"A"}]},"n":2} and {"other":1}`, `{"order":{"lines":[{"sku":"A"}]},"n":2}`},
+		{"quoted braces", `{"text":"a } and a { in a string","n":1}`, `{"text":"a } and a { in a string","n":1}`},
+		{"escaped quote", `{"text":"say \"}\" twice"}`, `{"text":"say \"}\" twice"}`},
+		{"fenced", "Sure:\n```json\n{\"x\": 1}\n```\nDone {\"y\": 2}", `{"x": 1}`},
+		{"fence without JSON", "```\nno object here\n```\n{\"x\":1}", `{"x":1}`},
+		{"thinking", `<think>maybe {"x":0}?</think>{"x":1}`, `{"x":1}`},
+		{"invalid first", `{not json} then {"x":1}`, `{"x":1}`},
+		{"brace in the prose", `use {braces} like {"x":1}`, `{"x":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindJSON(tt.reply)
+			if err != nil || got != tt.want {
+				t.Errorf("FindJSON = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindJSONAbsent(t *testing.T) {
+	for _, reply := range []string{"", "no JSON at all", `{"unclosed":1`, "[1, 2]", `<think>{"x":1}</think>`, "} {"} {
+		if got, err := FindJSON(reply); !errors.Is(err, ErrNoJSON) {
+			t.Errorf("FindJSON(%q) = %q, %v, want %v", reply, got, err, ErrNoJSON)
+		}
+	}
+}
+
+func TestObjectEnd(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{`{}`, 2},
+		{`{"a":{"b":{}}} rest`, 14},
+		{`{"a":"}"}`, 9},
+		{`{"a":"\\"}x`, 10},
+		{`{"a":"\"}"}`, 11},
+		{`{"a":1`, 0},
+		{`{"a":"}`, 0},
+	}
+	for _, tt := range tests {
+		if got := objectEnd(tt.s); got != tt.want {
+			t.Errorf("objectEnd(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+
+	if obj, ok := firstObject(`{"a":1`); ok {
+		t.Errorf("firstObject of an unclosed object = %q", obj)
+	}
+	if obj, ok := firstObject(`x {"a":{"b":1}} {"c":2}`); !ok || obj != `{"a":{"b":1}}` {
+		t.Errorf("firstObject = %q, %v", obj, ok)
+	}
+}
+
+var operationSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"operation": {"type": "string", "enum": ["sum", "multiply"]},
+		"x": {"type": "number"},
+		"y": {"type": "number"}
+	},
+	"required": ["operation", "x", "y"]
+}`)
+
+type operation struct {
+	Operation string  `json:"operation"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+}
+
+func TestExtract(t *testing.T) {
+	p := answers("Sure!\n```json\n{\"operation\": \"sum\", \"x\": 2, \"y\": 3}\n```")
+	var op operation
+	if err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "2 plus 3"}}, operationSchema, &op, nil); err != nil {
+		t.Fatal(err)
+	}
+	if op != (operation{"sum", 2, 3}) || len(p.calls) != 1 {
+		t.Errorf("Extract = %+v after %d calls", op, len(p.calls))
+	}
+}
+
+func TestExtractRetries(t *testing.T) {
+	p := answers(`{"operation": "divide", "x": 2, "y": 3}`, `{"operation": "multiply", "x": 2, "y": 3}`)
+	var retries []error
+	var op operation
+	err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "2 times 3"}}, operationSchema, &op, &ExtractOptions{
+		OnRetry: func(_ int, err error) { retries = append(retries, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != (operation{"multiply", 2, 3}) || len(retries) != 1 {
+		t.Errorf("Extract = %+v after %d retries", op, len(retries))
+	}
+	// the model is shown its reply and why it was rejected
+	second := p.calls[1]
+	if len(second) != 3 || second[1].Content != `{"operation": "divide", "x": 2, "y": 3}` || !strings.Contains(second[2].Content, "invalid") {
+		t.Errorf("messages of the retry = %+v", second)
+	}
+}
+
+func TestExtractNoJSON(t *testing.T) {
+	p := answers("I don't know.", "Still no idea.", "unused")
+	var op operation
+	err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "?"}}, operationSchema, &op, &ExtractOptions{MaxAttempts: 2})
+	if !errors.Is(err, ErrNoJSON) || len(p.calls) != 2 {
+		t.Errorf("Extract = %v after %d calls, want %v after 2", err, len(p.calls), ErrNoJSON)
+	}
+}
+
+// formatServer answers with a JSON reply, except to the requests with a
+// response_format, which get status and message. It keeps in *formats
+// whether each request had one.
+func formatServer(t *testing.T, status int, message string) (url string, formats *[]bool) {
+	t.Helper()
+	var mu sync.Mutex
+	formats = new([]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		*formats = append(*formats, req.ResponseFormat != nil)
+		mu.Unlock()
+		if req.ResponseFormat != nil {
+			http.Error(w, message, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"operation\":\"sum\",\"x\":1,\"y\":1}"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, formats
+}
+
+func TestChatJSONFallback(t *testing.T) {
+	url, formats := formatServer(t, http.StatusBadRequest, `{"error":{"message":"'response_format.type' must be 'json_object' or 'text'"}}`)
+	p, err := New(Config{BaseURL: url, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		var op operation
+		if err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "1 plus 1"}}, operationSchema, &op, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// rejected once, then no longer sent
+	if want := []bool{true, false, false}; !slices.Equal(*formats, want) {
+		t.Errorf("requests with response_format = %v, want %v", *formats, want)
+	}
+}
+
+// A bad request about something else is an error, and response_format is
+// still sent.
+func TestChatJSONOtherBadRequest(t *testing.T) {
+	url, formats := formatServer(t, http.StatusBadRequest, `{"error":{"message":"model 'fake' not found"}}`)
+	p, err := New(Config{BaseURL: url, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		var op operation
+		err := Extract(context.Background(), p, []Message{{Role: RoleUser, Content: "1 plus 1"}}, operationSchema, &op, nil)
+		var se *StatusError
+		if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Extract = %v, want the 400", err)
+		}
+	}
+	if want := []bool{true, true}; !slices.Equal(*formats, want) {
+		t.Errorf("requests with response_format = %v, want %v", *formats, want)
+	}
+}
@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+// Delta is an increment of a streamed reply: either a piece of text or a
+// piece of a tool call.
+type Delta struct {
+	Content  string         `json:"content,omitempty"`
+	ToolCall *ToolCallDelta `json:"toolCall,omitempty"`
+}
+
+// ToolCallDelta is a piece of a tool call. The first delta of a call carries
+// its ID and name; the arguments arrive as fragments of the JSON text, to be
+// concatenated.
+type ToolCallDelta struct {
+	// Index identifies the call among the calls of the reply.
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// StreamProvider is a [Provider] that can stream its replies.
+type StreamProvider interface {
+	Provider
+	// ChatStream is Chat, calling onDelta as the reply is generated. The
+	// returned message is the complete reply.
+	ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(Delta)) (*Message, error)
+}
+
+// Stream calls p with streaming when it is a [StreamProvider]. Otherwise it
+// waits for the reply and hands it to onDelta in one piece.
+func Stream(ctx context.Context, p Provider, messages []Message, tools []Tool, onDelta func(Delta)) (*Message, error) {
+	if sp, ok := p.(StreamProvider); ok {
+		return sp.ChatStream(ctx, messages, tools, onDelta)
+	}
+
+	reply, err := p.Chat(ctx, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Content != "" {
+		onDelta(Delta{Content: reply.Content})
+	}
+	for i, tc := range reply.ToolCalls {
+		onDelta(Delta{ToolCall: &ToolCallDelta{Index: i, ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}})
+	}
+	return reply, nil
+}
+
+// StreamFunc returns a [ChatFunc] streaming the replies of p to onDelta, to
+// run an agent with streaming.
+func StreamFunc(p Provider, onDelta func(Delta)) ChatFunc {
+	return func(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+		return Stream(ctx, p, messages, tools, onDelta)
+	}
+}
+
+// assembler builds the complete reply out of its deltas.
+type assembler struct {
+	content   bytes.Buffer
+	toolCalls []ToolCall
+	onDelta   func(Delta)
+}
+
+func (a *assembler) add(d Delta) {
+	if d.Content == "" && d.ToolCall == nil {
+		return
+	}
+	a.content.WriteString(d.Content)
+
+	if tc := d.ToolCall; tc != nil {
+		for len(a.toolCalls) <= tc.Index {
+			a.toolCalls = append(a.toolCalls, ToolCall{Type: "function"})
+		}
+		call := &a.toolCalls[tc.Index]
+		if tc.ID != "" {
+			call.ID = tc.ID
+		}
+		call.Function.Name += tc.Name
+		call.Function.Arguments += tc.Arguments
+	}
+
+	if a.onDelta != nil {
+		a.onDelta(d)
+	}
+}
+
+func (a *assembler) message() *Message {
+	return &Message{Role: RoleAssistant, Content: a.content.String(), ToolCalls: a.toolCalls}
+}
+
+// readSSE calls fn with the data of every server-sent event of r, until the
+// end of r or the "[DONE]" event of OpenAI streams.
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(data) == 0 {
+				continue
+			}
+			if string(data) == "[DONE]" {
+				return nil
+			}
+			if err := fn(data); err != nil {
+				return err
+			}
+			data = data[:0]
+			continue
+		}
+
+		value, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			// event:, id:, retry: and comments are not used
+			continue
+		}
+		if len(data) > 0 {
+			data = append(data, '\n')
+		}
+		data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 && string(data) != "[DONE]" {
+		return fn(data)
+	}
+	return nil
+}
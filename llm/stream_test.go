@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{
+			name:   "events",
+			stream: "data: {\"a\":1}\n\ndata: {\"a\":2}\n\n",
+			want:   []string{`{"a":1}`, `{"a":2}`},
+		},
+		{
+			name:   "event split over data lines",
+			stream: "data: {\"a\":\ndata: 1}\n\n",
+			want:   []string{"{\"a\":\n1}"},
+		},
+		{
+			name:   "fields and comments skipped",
+			stream: ": keep-alive\nevent: message\nid: 7\nretry: 100\ndata:{\"a\":1}\n\n\n\n",
+			want:   []string{`{"a":1}`},
+		},
+		{
+			name:   "crlf",
+			stream: "data: {\"a\":1}\r\n\r\ndata: {\"a\":2}\r\n\r\n",
+			want:   []string{`{"a":1}`, `{"a":2}`},
+		},
+		{
+			name:   "done",
+			stream: "data: {\"a\":1}\n\ndata: [DONE]\n\ndata: {\"a\":2}\n\n",
+			want:   []string{`{"a":1}`},
+		},
+		{
+			name:   "last event without a blank line",
+			stream: "data: {\"a\":1}\n\ndata: {\"a\":2}",
+			want:   []string{`{"a":1}`, `{"a":2}`},
+		},
+		{
+			name:   "empty",
+			stream: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a byte at a time, as lines cut by the network would arrive
+			var got []string
+			err := readSSE(iotest.OneByteReader(strings.NewReader(tt.stream)), func(data []byte) error {
+				got = append(got, string(data))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := readSSE(strings.NewReader("data: 1\n\ndata: 2\n\n"), func([]byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("readSSE = %v after %d events, want the error of the first one", err, calls)
+	}
+
+	broken := io.MultiReader(strings.NewReader("data: 1\n"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if err := readSSE(broken, func([]byte) error { return nil }); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("readSSE of a broken stream = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	var deltas []Delta
+	a := &assembler{onDelta: func(d Delta) { deltas = append(deltas, d) }}
+	for _, d := range []Delta{
+		{Content: "Looking "},
+		{},
+		{Content: "up."},
+		{ToolCall: &ToolCallDelta{Index: 0, ID: "call_1", Name: "getOrder"}},
+		{ToolCall: &ToolCallDelta{Index: 1, ID: "call_2", Name: "get"}},
+		{ToolCall: &ToolCallDelta{Index: 0, Arguments: `{"idOrder":`}},
+		{ToolCall: &ToolCallDelta{Index: 1, Name: "Customer", Arguments: `{"name":"Jo`}},
+		{ToolCall: &ToolCallDelta{Index: 0, Arguments: `"42"}`}},
+		{ToolCall: &ToolCallDelta{Index: 1, Arguments: `ão"}`}},
+	} {
+		a.add(d)
+	}
+
+	want := &Message{Role: RoleAssistant, Content: "Looking up.", ToolCalls: []ToolCall{
+		{ID: "call_1", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"42"}`}},
+		{ID: "call_2", Type: "function", Function: FunctionCall{Name: "getCustomer", Arguments: `{"name":"João"}`}},
+	}}
+	if got := a.message(); !reflect.DeepEqual(got, want) {
+		t.Errorf("message = %+v, want %+v", got, want)
+	}
+	// the empty delta is not passed on
+	if len(deltas) != 8 {
+		t.Errorf("%d deltas passed on, want 8", len(deltas))
+	}
+}
+
+// The tool call fragments of an OpenAI stream make up the calls of the reply,
+// however the events are cut by the network.
+func TestChatStreamToolCalls(t *testing.T) {
+	events := []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Let me check."}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"getOrder","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"idOr"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"getOrder","arguments":"{\"idOrder\":\"43\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"der\":\"42\"}"}}]}}]}`,
+		`{"model":"served-model","choices":[],"usage":{"prompt_tokens":20,"completion_tokens":10,"total_tokens":30}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		var stream strings.Builder
+		for _, event := range events {
+			stream.WriteString("data: " + event + "\n\n")
+		}
+		stream.WriteString("data: [DONE]\n\n")
+		// flushed in pieces cutting lines and events
+		for s := stream.String(); s != ""; {
+			n := min(37, len(s))
+			io.WriteString(w, s[:n])
+			w.(http.Flusher).Flush()
+			s = s[n:]
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(Config{BaseURL: server.URL, Model: "asked-model", Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	reply, err := Stream(context.Background(), p, []Message{{Role: RoleUser, Content: "Where are orders 42 and 43?"}}, nil, func(d Delta) {
+		text.WriteString(d.Content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text.String() != "Let me check." || reply.Content != "Let me check." {
+		t.Errorf("content = %q streamed, %q replied", text.String(), reply.Content)
+	}
+	want := []ToolCall{
+		{ID: "call_1", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"42"}`}},
+		{ID: "call_2", Type: "function", Function: FunctionCall{Name: "getOrder", Arguments: `{"idOrder":"43"}`}},
+	}
+	if !reflect.DeepEqual(reply.ToolCalls, want) {
+		t.Errorf("tool calls = %+v, want %+v", reply.ToolCalls, want)
+	}
+	if reply.Usage == nil || reply.Usage.TotalTokens != 30 || reply.Usage.Model != "served-model" {
+		t.Errorf("usage = %+v, want the one of the last event", reply.Usage)
+	}
+}
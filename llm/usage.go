@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"encoding/json"
+)
+
+// Usage is the token count of a model call.
+type Usage struct {
+	// Model is the model that answered, as reported by the server.
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+	TotalTokens      int    `json:"totalTokens"`
+	// Estimated is set when the server did not report the usage and it was
+	// estimated with [EstimateUsage].
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Add adds the tokens of u2 to u. A sum is estimated when any of its terms
+// is, and keeps the model only when all the terms agree on it.
+func (u *Usage) Add(u2 Usage) {
+	switch {
+	case u.TotalTokens == 0 && u.Model == "":
+		u.Model = u2.Model
+	case u.Model != u2.Model:
+		u.Model = ""
+	}
+	u.PromptTokens += u2.PromptTokens
+	u.CompletionTokens += u2.CompletionTokens
+	u.TotalTokens += u2.TotalTokens
+	u.Estimated = u.Estimated || u2.Estimated
+}
+
+// EstimateUsage estimates the usage of a call sending messages and tools and
+// getting reply, with [EstimateTokens].
+func EstimateUsage(messages []Message, tools []Tool, reply *Message) Usage {
+	u := Usage{PromptTokens: EstimateTokens(messages), Estimated: true}
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		u.PromptTokens += (len(data) + 3) / 4
+	}
+	if reply != nil {
+		u.CompletionTokens = EstimateTokens([]Message{*reply})
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// withUsage sets the usage of reply: the one reported by the server, or an
+// estimate when the server reported none.
+func withUsage(reply *Message, usage *Usage, model string, messages []Message, tools []Tool) *Message {
+	if usage == nil || usage.TotalTokens+usage.PromptTokens+usage.CompletionTokens == 0 {
+		estimate := EstimateUsage(messages, tools, reply)
+		usage = &estimate
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.Model == "" {
+		usage.Model = model
+	}
+	reply.Usage = usage
+	return reply
+}
+
+// openAIUsage is the usage block of the OpenAI APIs.
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *openAIUsage) usage(model string) *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{Model: model, PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// streamOptions asks OpenAI compatible servers for the usage at the end of
+// a stream.
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// replyWith returns the base URL of a server answering every request with
+// body, and the path of the last request in *path.
+func replyWith(t *testing.T, body string, path *string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path != nil {
+			*path = r.URL.Path
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestUsageReported(t *testing.T) {
+	url := replyWith(t, `{"model":"served-model","choices":[{"message":{"role":"assistant","content":"hi"}}],
+		"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`, nil)
+	p, err := New(Config{BaseURL: url, Model: "asked-model", Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hello"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{Model: "served-model", PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	if reply.Usage == nil || *reply.Usage != want {
+		t.Errorf("usage = %+v, want %+v", reply.Usage, want)
+	}
+}
+
+func TestUsageEstimated(t *testing.T) {
+	url := replyWith(t, `{"choices":[{"message":{"role":"assistant","content":"a reply of a few tokens"}}]}`, nil)
+	p, err := New(Config{BaseURL: url, Model: "asked-model", Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []Message{{Role: "user", Content: "how many tokens is this?"}}
+	reply, err := p.Chat(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{
+		Model:            "asked-model",
+		PromptTokens:     EstimateTokens(messages),
+		CompletionTokens: EstimateTokens([]Message{{Role: "assistant", Content: "a reply of a few tokens"}}),
+		Estimated:        true,
+	}
+	want.TotalTokens = want.PromptTokens + want.CompletionTokens
+	if reply.Usage == nil || *reply.Usage != want {
+		t.Errorf("usage = %+v, want the estimate %+v", reply.Usage, want)
+	}
+}
+
+func TestUsageAdd(t *testing.T) {
+	var u Usage
+	u.Add(Usage{Model: "a", PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+	u.Add(Usage{Model: "a", PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2, Estimated: true})
+	if want := (Usage{Model: "a", PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5, Estimated: true}); u != want {
+		t.Errorf("sum = %+v, want %+v", u, want)
+	}
+	u.Add(Usage{Model: "b", TotalTokens: 1})
+	if u.Model != "" {
+		t.Errorf("model of a sum over two models = %q, want none", u.Model)
+	}
+}
@@ -0,0 +1,256 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Compression is a compression mode of the byte stream of a connection.
+type Compression int
+
+const (
+	// NoCompression sends frames as they are. It is the default.
+	NoCompression Compression = iota
+	// GzipCompression sends a single gzip stream in each direction.
+	GzipCompression
+	// FlateCompression sends a single raw DEFLATE stream in each direction.
+	FlateCompression
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case GzipCompression:
+		return "gzip"
+	case FlateCompression:
+		return "flate"
+	default:
+		return "Compression(" + strconv.Itoa(int(c)) + ")"
+	}
+}
+
+// ParseCompression returns the mode called name: "none", "gzip" or "flate".
+func ParseCompression(name string) (Compression, error) {
+	for _, c := range []Compression{NoCompression, GzipCompression, FlateCompression} {
+		if strings.EqualFold(strings.TrimSpace(name), c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("tcp: unknown compression %q", name)
+}
+
+// compressionHeader names the header block exchanged at connect time.
+//
+// A client offering compression starts the connection with
+//
+//	MCP-Compression: gzip, flate
+//
+// followed by a blank line, and the server answers with the same header
+// naming the mode it picked, or "none". Both sides compress everything they
+// send after their header block and flush the compressor after every frame.
+const compressionHeader = "MCP-Compression"
+
+// WithCompression enables compressing the connection with one of modes.
+//
+// A [Transport] offers modes, in order of preference, when it connects and
+// falls back to no compression when the server declines. A [Server] accepts
+// the first offered mode found in modes; it always takes part in the
+// negotiation, so servers without this option decline every offer. Clients
+// offering compression therefore need a server of this package.
+func WithCompression(modes ...Compression) Option {
+	return func(o *options) {
+		o.compression = modes
+	}
+}
+
+// Compression returns the compression mode negotiated for the connection.
+func (c *Connection) Compression() Compression {
+	return c.compression
+}
+
+// offerCompression sends the modes the client supports and switches to the
+// one chosen by the server.
+func (c *Connection) offerCompression(ctx context.Context, modes []Compression) error {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = mode.String()
+	}
+	offer := fmt.Sprintf("%s: %s\r\n\r\n", compressionHeader, strings.Join(names, ", "))
+
+	release, err := bindContext(ctx, c.conn.SetDeadline, handshakeTimeout)
+	if err != nil {
+		return err
+	}
+	err = release(c.exchangeOffer(offer, modes))
+	if err != nil {
+		return fmt.Errorf("tcp: compression negotiation: %w", err)
+	}
+	return nil
+}
+
+func (c *Connection) exchangeOffer(offer string, modes []Compression) error {
+	if _, err := io.WriteString(c.conn, offer); err != nil {
+		return err
+	}
+
+	if err := c.r.WaitFrame(); err != nil {
+		return err
+	}
+	first, err := c.r.readLine()
+	if err != nil {
+		return err
+	}
+	if first[0] == '{' {
+		// The server refused the connection before negotiating, e.g.
+		// because it is busy.
+		return fmt.Errorf("server answered %s", first)
+	}
+	value, err := c.r.readField(first, compressionHeader)
+	if err != nil {
+		return err
+	}
+
+	mode, err := ParseCompression(value)
+	if err != nil || (mode != NoCompression && !containsCompression(modes, mode)) {
+		return fmt.Errorf("server picked unsupported mode %q", value)
+	}
+	c.compress(mode)
+	return nil
+}
+
+// acceptCompression answers the compression offer the peer may start the
+// connection with, picking the first offered mode found in accepted.
+func (c *Connection) acceptCompression(ctx context.Context, accepted []Compression) error {
+	release, err := bindContext(ctx, c.conn.SetReadDeadline, c.idleTimeout)
+	if err != nil {
+		return err
+	}
+	if err := release(c.r.WaitFrame()); err != nil {
+		return err
+	}
+	if b, err := c.r.r.Peek(1); err != nil || (b[0] != 'M' && b[0] != 'm') {
+		// Not an offer: the first frame is read as usual.
+		return nil
+	}
+
+	release, err = bindContext(ctx, c.conn.SetDeadline, handshakeTimeout)
+	if err != nil {
+		return err
+	}
+	err = release(c.answerOffer(accepted))
+	if err != nil {
+		return fmt.Errorf("tcp: compression negotiation: %w", err)
+	}
+	return nil
+}
+
+func (c *Connection) answerOffer(accepted []Compression) error {
+	first, err := c.r.readLine()
+	if err != nil {
+		return err
+	}
+	value, err := c.r.readField(first, compressionHeader)
+	if err != nil {
+		return err
+	}
+
+	mode := NoCompression
+	for _, name := range strings.Split(value, ",") {
+		offered, err := ParseCompression(name)
+		if err == nil && containsCompression(accepted, offered) {
+			mode = offered
+			break
+		}
+	}
+
+	answer := fmt.Sprintf("%s: %s\r\n\r\n", compressionHeader, mode)
+	if _, err := io.WriteString(c.conn, answer); err != nil {
+		return err
+	}
+	c.compress(mode)
+	return nil
+}
+
+// compress switches both directions of the connection to mode. It must be
+// called before any frame is exchanged.
+func (c *Connection) compress(mode Compression) {
+	c.compression = mode
+
+	src := c.r.r
+	switch mode {
+	case GzipCompression:
+		zw := gzip.NewWriter(c.conn)
+		c.w.w, c.w.flush = zw, zw.Flush
+		// gzip.NewReader reads the stream header, which the peer only sends
+		// along with its first frame.
+		c.r.r = bufio.NewReader(&lazyReader{open: func() (io.Reader, error) {
+			return gzip.NewReader(src)
+		}})
+	case FlateCompression:
+		zw, _ := flate.NewWriter(c.conn, flate.DefaultCompression)
+		c.w.w, c.w.flush = zw, zw.Flush
+		c.r.r = bufio.NewReader(flate.NewReader(src))
+	}
+}
+
+func containsCompression(modes []Compression, mode Compression) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// readField parses a header block whose first line is first, up to and
+// including the blank line that ends it, and returns the value of name.
+func (f *frameReader) readField(first []byte, name string) (string, error) {
+	var (
+		value string
+		found bool
+	)
+	for line := first; len(line) > 0; {
+		key, v, ok := bytes.Cut(line, []byte{':'})
+		if !ok {
+			return "", fmt.Errorf("malformed header line %q", line)
+		}
+		if bytes.EqualFold(bytes.TrimSpace(key), []byte(name)) {
+			value, found = string(bytes.TrimSpace(v)), true
+		}
+
+		var err error
+		if line, err = f.readLine(); err != nil {
+			return "", err
+		}
+	}
+
+	if !found {
+		return "", fmt.Errorf("missing %s header", name)
+	}
+	return value, nil
+}
+
+// lazyReader opens its underlying reader on the first Read.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
@@ -0,0 +1,165 @@
+package tcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+
+	"mcp/transport/transporttest"
+)
+
+func TestCompressionSession(t *testing.T) {
+	for _, mode := range []Compression{GzipCompression, FlateCompression} {
+		t.Run(mode.String(), func(t *testing.T) {
+			transporttest.RunSession(t, serve([]Option{WithCompression(mode)}, []Option{WithCompression(GzipCompression, FlateCompression)}))
+		})
+	}
+	// a server without WithCompression declines the offer
+	t.Run("declined", func(t *testing.T) {
+		transporttest.RunSession(t, serve([]Option{WithCompression(GzipCompression)}, nil))
+	})
+}
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	read atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// orderDocument is a tool result like the order documents of the examples:
+// repetitive in shape, with values drawn from rng so that consecutive
+// documents differ.
+func orderDocument(rng *rand.Rand) json.RawMessage {
+	type line struct {
+		SKU         string  `json:"sku"`
+		Description string  `json:"description"`
+		Quantity    int     `json:"quantity"`
+		Price       float64 `json:"price"`
+	}
+	var lines []line
+	for range 50 {
+		lines = append(lines, line{
+			SKU:         fmt.Sprintf("SKU-%05d", rng.IntN(100000)),
+			Description: descriptions[rng.IntN(len(descriptions))],
+			Quantity:    rng.IntN(20) + 1,
+			Price:       float64(rng.IntN(100000)) / 100,
+		})
+	}
+	text, _ := json.Marshal(map[string]any{"idOrder": fmt.Sprint(rng.IntN(1000000)), "status": "shipped", "lines": lines})
+	result, _ := json.Marshal(map[string]any{"content": []map[string]string{{"type": "text", "text": string(text)}}})
+	return result
+}
+
+var descriptions = []string{
+	"Stainless steel widget, standard size",
+	"Brass fitting, 1/2 inch",
+	"Aluminium bracket with screws",
+	"Rubber gasket, pack of 10",
+}
+
+// BenchmarkCompression sends order documents from a client to a server and
+// reports the bytes each one takes on the wire ("wire-B/msg", including the
+// negotiation) next to its encoded size ("raw-B/msg").
+func BenchmarkCompression(b *testing.B) {
+	for _, mode := range []Compression{NoCompression, GzipCompression, FlateCompression} {
+		b.Run(mode.String(), func(b *testing.B) {
+			// a fixed set of documents, encoded up front; the flate window
+			// (32KB) holds only a few of them
+			rng := rand.New(rand.NewPCG(1, 2))
+			msgs := make([]jsonrpc.Message, 64)
+			raw := 0
+			for i := range msgs {
+				id, _ := jsonrpc.MakeID(float64(i))
+				msgs[i] = &jsonrpc.Response{ID: id, Result: orderDocument(rng)}
+				data, err := jsonrpc.EncodeMessage(msgs[i])
+				if err != nil {
+					b.Fatal(err)
+				}
+				raw += len(data)
+			}
+			raw /= len(msgs)
+
+			var clientOpts []Option
+			if mode != NoCompression {
+				clientOpts = []Option{WithCompression(mode)}
+			}
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer listener.Close()
+			accepted := make(chan *Connection, 1)
+			counter := &countingConn{}
+			go func() {
+				defer close(accepted)
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				counter.Conn = conn
+				c := NewConnection(counter)
+				if err := c.acceptCompression(context.Background(), []Compression{mode}); err != nil {
+					c.Close()
+					return
+				}
+				accepted <- c
+			}()
+
+			ctx := context.Background()
+			client, err := NewTransport(listener.Addr().String(), clientOpts...).Connect(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.Close()
+			// without an offer the server only returns once the first frame
+			// arrives, so the client starts writing right away
+			errs := make(chan error, 1)
+			go func() {
+				for i := range b.N {
+					if err := client.Write(ctx, msgs[i%len(msgs)]); err != nil {
+						errs <- err
+						return
+					}
+				}
+				errs <- nil
+			}()
+
+			server, ok := <-accepted
+			if !ok {
+				b.Fatal("negotiation failed")
+			}
+			defer server.Close()
+			if got := server.Compression(); got != mode {
+				b.Fatalf("negotiated %s, want %s", got, mode)
+			}
+
+			b.SetBytes(int64(raw))
+			b.ResetTimer()
+			for range b.N {
+				if _, err := server.Read(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if err := <-errs; err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportMetric(float64(raw), "raw-B/msg")
+			b.ReportMetric(float64(counter.read.Load())/float64(b.N), "wire-B/msg")
+		})
+	}
+}
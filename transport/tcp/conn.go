@@ -0,0 +1,364 @@
+// Package tcp implements an MCP transport over TCP connections.
+//
+// By default every JSON-RPC message is written as a single newline-terminated
+// line, the same wire format used by the stdio transport of the MCP SDK; an
+// LSP style Content-Length framing can be selected with [WithFraming]. The package
+// provides both sides of the connection: a [Transport] that dials a remote
+// server and a [Server] that accepts connections on a [net.Listener] and runs
+// an [mcp.Server] session for each one. Nothing in it is specific to TCP, so
+// it also serves other stream networks such as Unix sockets.
+package tcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/internal/randid"
+)
+
+var _ mcp.Connection = (*Connection)(nil)
+
+var (
+	// ErrFrameTooLarge reports an incoming frame over the configured limit.
+	ErrFrameTooLarge = errors.New("tcp: frame too large")
+	// ErrIdleTimeout reports that no message started within the idle timeout.
+	ErrIdleTimeout = errors.New("tcp: idle timeout")
+	// ErrReadTimeout reports a message that was not fully received in time.
+	ErrReadTimeout = errors.New("tcp: read timeout")
+	// ErrWriteTimeout reports a message that could not be written in time.
+	ErrWriteTimeout = errors.New("tcp: write timeout")
+)
+
+// codeInvalidRequest is the JSON-RPC error code sent for oversized frames.
+const codeInvalidRequest = -32600
+
+// methodCancelled is the MCP notification cancelling a request.
+const methodCancelled = "notifications/cancelled"
+
+// Connection is an [mcp.Connection] backed by a [net.Conn].
+type Connection struct {
+	conn      net.Conn
+	sessionID string
+	r         *frameReader
+	mirror    bool
+
+	compression Compression
+
+	rejectOversized bool
+	idleTimeout     time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+
+	// calls bounds the tool calls executing at a time; nil means no limit.
+	calls        *callSlots
+	queueTimeout time.Duration
+
+	writeMu sync.Mutex // serializes writes and write deadlines
+	w       *frameWriter
+
+	// requests holds the ids of the requests read whose response is not
+	// written yet.
+	requestsMu sync.Mutex
+	requests   map[jsonrpc.ID]bool // true once a cancellation was read for it
+
+	// canceled is done once the server cancels the requests in progress.
+	canceled context.Context
+	cancel   context.CancelFunc
+
+	onClose   func()
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewConnection wraps conn into an MCP connection with a unique session id.
+func NewConnection(conn net.Conn, opts ...Option) *Connection {
+	return newConnection(conn, newOptions(opts))
+}
+
+func newConnection(conn net.Conn, o options) *Connection {
+	c := &Connection{
+		conn:            conn,
+		sessionID:       randid.New(),
+		r:               newFrameReader(conn, o.maxFrameSize),
+		mirror:          o.mirrorFraming,
+		rejectOversized: o.rejectOversized,
+		idleTimeout:     o.idleTimeout,
+		readTimeout:     o.readTimeout,
+		writeTimeout:    o.writeTimeout,
+		queueTimeout:    o.queueTimeout,
+		w:               newFrameWriter(conn, o.framing),
+		requests:        make(map[jsonrpc.ID]bool),
+	}
+	c.canceled, c.cancel = context.WithCancel(context.Background())
+	if o.maxCalls > 0 {
+		c.calls = newCallSlots(o.maxCalls)
+	}
+	return c
+}
+
+// Read reads the next message from the connection.
+//
+// The read is interrupted when ctx is cancelled or its deadline expires, in
+// which case the context error is returned. An interrupted read may have
+// consumed part of a frame, so the connection must not be read again. The
+// same holds for [ErrIdleTimeout] and [ErrReadTimeout].
+func (c *Connection) Read(ctx context.Context) (jsonrpc.Message, error) {
+	if c.canceled.Err() != nil {
+		return c.cancellation()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(c.canceled, cancel)()
+
+	for {
+		frame, framing, err := c.readFrame(ctx)
+		if err != nil && c.canceled.Err() != nil {
+			return c.cancellation()
+		}
+		if err != nil && !(c.rejectOversized && errors.Is(err, ErrFrameTooLarge)) {
+			return nil, err
+		}
+		if c.mirror {
+			c.w.SetFraming(framing)
+		}
+		if err != nil {
+			// The id of the request was skipped along with the rest of the
+			// frame, so the error is answered with a null id.
+			if err := c.writeError(ctx, jsonrpc.ID{}, codeInvalidRequest, err.Error(), nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		msg, err := jsonrpc.DecodeMessage(frame)
+		if err != nil {
+			return nil, err
+		}
+		req, ok := msg.(*jsonrpc.Request)
+		if !ok || !req.ID.IsValid() {
+			return msg, nil
+		}
+
+		if c.calls != nil && req.Method == methodCallTool && !c.calls.acquire(ctx, req.ID, c.queueTimeout) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			data := busyData("tool_calls", cap(c.calls.sem), c.queueTimeout)
+			if err := c.writeError(ctx, req.ID, CodeServerBusy, "server busy: too many concurrent tool calls", data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		c.requestsMu.Lock()
+		c.requests[req.ID] = false
+		c.requestsMu.Unlock()
+		return msg, nil
+	}
+}
+
+// cancelRequests stops the reads of the connection, which then return a
+// cancellation for every request in progress, as if the peer had sent them,
+// and then [io.EOF]. The session cancels the context of the handlers, which
+// it would otherwise wait for when closed.
+func (c *Connection) cancelRequests() {
+	c.cancel()
+}
+
+// cancellation returns the next cancellation of a request in progress, or
+// io.EOF once they are all canceled.
+func (c *Connection) cancellation() (jsonrpc.Message, error) {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+
+	for id, canceled := range c.requests {
+		if canceled {
+			continue
+		}
+		c.requests[id] = true
+		params, err := json.Marshal(mcp.CancelledParams{RequestID: id.Raw(), Reason: "server shutting down"})
+		if err != nil {
+			return nil, err
+		}
+		return &jsonrpc.Request{Method: methodCancelled, Params: params}, nil
+	}
+	return nil, io.EOF
+}
+
+// inProgress returns the number of requests read whose response is not
+// written yet.
+func (c *Connection) inProgress() int {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+	return len(c.requests)
+}
+
+// readFrame reads the next frame, waiting at most the idle timeout for it to
+// start and the read timeout for it to complete.
+func (c *Connection) readFrame(ctx context.Context) ([]byte, Framing, error) {
+	release, err := bindContext(ctx, c.conn.SetReadDeadline, c.idleTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := release(c.r.WaitFrame()); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("%w: no message for %v", ErrIdleTimeout, c.idleTimeout)
+		}
+		return nil, 0, err
+	}
+
+	release, err = bindContext(ctx, c.conn.SetReadDeadline, c.readTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	frame, framing, err := c.r.ReadFrame()
+	if err = release(err); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("%w: message not received within %v", ErrReadTimeout, c.readTimeout)
+		}
+		return nil, framing, err
+	}
+	return frame, framing, nil
+}
+
+// Write writes msg to the connection as a single frame. It is safe to call
+// concurrently. Like [Connection.Read], it honors the cancellation and the
+// deadline of ctx.
+//
+// When the write timeout expires the frame may have been partially written,
+// so the connection is closed and [ErrWriteTimeout] is returned.
+func (c *Connection) Write(ctx context.Context, msg jsonrpc.Message) error {
+	// the request is over once answered, even if the answer cannot be
+	// written, or Shutdown would wait for it until its deadline
+	if resp, ok := msg.(*jsonrpc.Response); ok {
+		defer func() {
+			c.requestsMu.Lock()
+			delete(c.requests, resp.ID)
+			c.requestsMu.Unlock()
+		}()
+		if c.calls != nil {
+			defer c.calls.done(resp.ID)
+		}
+	}
+
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(ctx, data)
+}
+
+// writeError answers the request id, which may be the zero id, with a
+// JSON-RPC error. The SDK does not expose its error type, so the response is
+// encoded here.
+func (c *Connection) writeError(ctx context.Context, id jsonrpc.ID, code int64, message string, errData any) error {
+	type wireError struct {
+		Code    int64  `json:"code"`
+		Message string `json:"message"`
+		Data    any    `json:"data,omitempty"`
+	}
+	data, err := json.Marshal(struct {
+		JSONRPC string    `json:"jsonrpc"`
+		ID      any       `json:"id"`
+		Error   wireError `json:"error"`
+	}{"2.0", id.Raw(), wireError{code, message, errData}})
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(ctx, data)
+}
+
+func (c *Connection) writeFrame(ctx context.Context, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	release, err := bindContext(ctx, c.conn.SetWriteDeadline, c.writeTimeout)
+	if err != nil {
+		return err
+	}
+
+	err = release(c.w.WriteFrame(data))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.Close()
+		return fmt.Errorf("%w: message not written within %v", ErrWriteTimeout, c.writeTimeout)
+	}
+	return err
+}
+
+// Close closes the underlying connection. It is safe to call more than once.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return c.closeErr
+}
+
+// SessionID returns the id generated for this connection.
+func (c *Connection) SessionID() string {
+	return c.sessionID
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Connection) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// bindContext arms setDeadline with the deadline of ctx, or with timeout from
+// now when it is positive and comes first, and arranges for the pending I/O to
+// be interrupted as soon as ctx is done. The returned release function must be
+// called with the result of the I/O; it disarms the watcher and reports the
+// context error in place of the resulting timeout. An expired timeout is
+// reported as [os.ErrDeadlineExceeded].
+func bindContext(ctx context.Context, setDeadline func(time.Time) error, timeout time.Duration) (release func(error) error, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	ioDeadline := deadline
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); !hasDeadline || t.Before(deadline) {
+			ioDeadline = t
+		}
+	}
+	if err := setDeadline(ioDeadline); err != nil {
+		return nil, err
+	}
+
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		_ = setDeadline(aLongTimeAgo)
+	})
+
+	return func(err error) error {
+		if !stop() {
+			<-interrupted
+		}
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if hasDeadline && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		return err
+	}, nil
+}
+
+// aLongTimeAgo is a deadline in the past, used to unblock pending I/O.
+var aLongTimeAgo = time.Unix(1, 0)
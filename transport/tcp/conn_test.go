@@ -0,0 +1,211 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+func TestReadFrameTooLarge(t *testing.T) {
+	const limit = 128
+	big := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"pad":"` + strings.Repeat("x", 2*limit) + `"}}`
+	tests := []struct {
+		name string
+		wire string
+	}{
+		{"newline", big + "\n" + call(2) + "\n"},
+		{"content-length", contentLength(big) + contentLength(call(2))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, c := rawPair(t, WithMaxFrameSize(limit))
+			if _, err := raw.Write([]byte(tt.wire)); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+			defer cancel()
+			if _, err := c.Read(ctx); !errors.Is(err, ErrFrameTooLarge) {
+				t.Fatalf("Read of an oversized frame = %v, want %v", err, ErrFrameTooLarge)
+			}
+			// the oversized frame was skipped, the next one is intact
+			if got := readIDs(t, c, 1); got[0] != "2" {
+				t.Fatalf("id after the oversized frame = %s, want 2", got[0])
+			}
+		})
+	}
+}
+
+// A server answers an oversized frame with an error and keeps the session.
+func TestServerRejectsFrameTooLarge(t *testing.T) {
+	const limit = 1024
+	listener := listen(t)
+	srv := NewServer(mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil), WithMaxFrameSize(limit))
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(transporttest.Timeout))
+	r := bufio.NewReader(raw)
+
+	big := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"pad":"` + strings.Repeat("x", 2*limit) + `"}}`
+	initialize := `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"raw","version":"v1"}}}`
+	if _, err := raw.Write([]byte(big + "\n" + initialize + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	type response struct {
+		ID    any `json:"id"`
+		Error *struct {
+			Code    int64  `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	read := func() (response, string) {
+		t.Helper()
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the answer: %v", err)
+		}
+		var resp response
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("answer %q: %v", line, err)
+		}
+		return resp, line
+	}
+
+	resp, line := read()
+	if resp.ID != nil || resp.Error == nil || resp.Error.Code != codeInvalidRequest || !strings.Contains(resp.Error.Message, ErrFrameTooLarge.Error()) {
+		t.Fatalf("answer to an oversized frame = %s, want a %d error with a null id", line, codeInvalidRequest)
+	}
+	// the session is still usable
+	if resp, line := read(); resp.ID != float64(2) || resp.Error != nil {
+		t.Fatalf("answer to initialize = %s, want a result for id 2", line)
+	}
+}
+
+func TestReadTimeoutTrickle(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	raw, c := rawPair(t, WithReadTimeout(timeout))
+
+	// a byte every 20ms: the frame never completes within the read timeout,
+	// although the connection is never silent for long
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		frame := call(1) + "\n"
+		for i := range len(frame) {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			if _, err := raw.Write([]byte{frame[i]}); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Read(ctx)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("Read = %v, want %v", err, ErrReadTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Fatalf("Read returned after %v, want about %v", elapsed, timeout)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	_, c := rawPair(t, WithIdleTimeout(100*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	if _, err := c.Read(ctx); !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("Read = %v, want %v", err, ErrIdleTimeout)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	_, c := rawPair(t, WithWriteTimeout(100*time.Millisecond))
+
+	// the peer never reads, so the socket buffers fill up and a write blocks
+	params, _ := json.Marshal(map[string]string{"pad": strings.Repeat("x", 8<<20)})
+	var err error
+	for range 32 {
+		if err = c.Write(context.Background(), &jsonrpc.Request{Method: "notifications/message", Params: params}); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrWriteTimeout) {
+		t.Fatalf("Write = %v, want %v", err, ErrWriteTimeout)
+	}
+}
+
+// A request answered with a response that cannot be written is no longer in
+// progress, or Shutdown would wait for it until its deadline.
+func TestInProgressFailedWrite(t *testing.T) {
+	raw, c := rawPair(t)
+	io.WriteString(raw, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`+"\n")
+	msg, err := c.Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.inProgress(); n != 1 {
+		t.Fatalf("%d requests in progress, want 1", n)
+	}
+
+	c.conn.Close()
+	if err := c.Write(context.Background(), &jsonrpc.Response{ID: msg.(*jsonrpc.Request).ID, Result: json.RawMessage(`{}`)}); err == nil {
+		t.Fatal("Write on a closed connection succeeded")
+	}
+	if n := c.inProgress(); n != 0 {
+		t.Errorf("%d requests in progress after the failed response, want 0", n)
+	}
+}
+
+func TestCancelRequests(t *testing.T) {
+	raw, c := rawPair(t)
+	io.WriteString(raw, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"slow"}}`+"\n")
+	if _, err := c.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read waiting for the peer returns the cancellation of the request
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.cancelRequests()
+	}()
+	msg, err := c.Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := msg.(*jsonrpc.Request)
+	if !ok || req.Method != methodCancelled || req.ID.IsValid() {
+		t.Fatalf("Read = %+v, want a cancellation", msg)
+	}
+	var params mcp.CancelledParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID != float64(1) {
+		t.Errorf("cancellation params = %s, want the request 1", req.Params)
+	}
+	if _, err := c.Read(context.Background()); err != io.EOF {
+		t.Errorf("Read after the cancellations = %v, want EOF", err)
+	}
+}
@@ -0,0 +1,237 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+// Framing is the way JSON-RPC messages are delimited on the wire.
+type Framing int32
+
+const (
+	// NewlineFraming writes every message as a single newline-terminated line.
+	// It is the default framing.
+	NewlineFraming Framing = iota
+	// ContentLengthFraming prefixes every message with an LSP style
+	// "Content-Length: <n>" header block, allowing multi-line JSON payloads.
+	ContentLengthFraming
+)
+
+func (f Framing) String() string {
+	switch f {
+	case NewlineFraming:
+		return "newline"
+	case ContentLengthFraming:
+		return "content-length"
+	default:
+		return "Framing(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+const contentLengthHeader = "Content-Length"
+
+var errMissingContentLength = errors.New("tcp: header block without " + contentLengthHeader)
+
+// frameReader splits a byte stream into frames.
+//
+// It owns the only buffered reader of the connection for its whole lifetime,
+// so bytes read ahead of the current frame (e.g. when a peer pipelines several
+// requests in one TCP segment) are kept for the following calls.
+//
+// Both framings are accepted on every frame: a line starting with a JSON value
+// is a newline frame, anything else starts a Content-Length header block.
+//
+// No frame or header line longer than max is ever buffered: an oversized frame
+// is skipped and reported with [ErrFrameTooLarge], leaving the reader at the
+// start of the following frame.
+type frameReader struct {
+	r   *bufio.Reader
+	max int
+}
+
+func newFrameReader(r io.Reader, max int) *frameReader {
+	return &frameReader{r: bufio.NewReader(r), max: max}
+}
+
+// WaitFrame blocks until the first byte of the next frame is available,
+// consuming the blank space that separates frames.
+func (f *frameReader) WaitFrame() error {
+	for {
+		b, err := f.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = f.r.ReadByte()
+		default:
+			return nil
+		}
+	}
+}
+
+// ReadFrame returns the next non-empty frame, without its delimiters, and the
+// framing it was received in. The framing is also reported along with
+// [ErrFrameTooLarge].
+func (f *frameReader) ReadFrame() ([]byte, Framing, error) {
+	for {
+		line, err := f.readLine()
+		if err != nil {
+			return nil, NewlineFraming, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '{' || line[0] == '[' {
+			return line, NewlineFraming, nil
+		}
+
+		length, err := f.readHeader(line)
+		if err != nil {
+			return nil, ContentLengthFraming, err
+		}
+
+		if length > f.max {
+			if _, err := io.CopyN(io.Discard, f.r, int64(length)); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, ContentLengthFraming, err
+			}
+			return nil, ContentLengthFraming, fmt.Errorf("%w: %d bytes, limit is %d", ErrFrameTooLarge, length, f.max)
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(f.r, body); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, ContentLengthFraming, err
+		}
+		return body, ContentLengthFraming, nil
+	}
+}
+
+// readLine returns the next line with surrounding whitespace removed.
+func (f *frameReader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := f.r.ReadSlice('\n')
+		if len(line)+len(chunk) > f.max+len("\r\n") {
+			if err == bufio.ErrBufferFull {
+				err = f.skipLine()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: line longer than %d bytes", ErrFrameTooLarge, f.max)
+		}
+		line = append(line, chunk...)
+
+		switch {
+		case err == nil:
+			return bytes.TrimSpace(line), nil
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(bytes.TrimSpace(line)) > 0:
+			return nil, io.ErrUnexpectedEOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+// skipLine discards the input up to and including the next newline.
+func (f *frameReader) skipLine() error {
+	for {
+		_, err := f.r.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// readHeader parses a header block whose first line is first, up to and
+// including the blank line that ends it, and returns the content length.
+func (f *frameReader) readHeader(first []byte) (int, error) {
+	length := -1
+	for line := first; len(line) > 0; {
+		name, value, ok := bytes.Cut(line, []byte{':'})
+		if !ok {
+			return 0, fmt.Errorf("tcp: malformed header line %q", line)
+		}
+		if bytes.EqualFold(bytes.TrimSpace(name), []byte(contentLengthHeader)) {
+			n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("tcp: invalid %s %q", contentLengthHeader, value)
+			}
+			length = n
+		}
+
+		var err error
+		if line, err = f.readLine(); err != nil {
+			if errors.Is(err, ErrFrameTooLarge) {
+				// The rest of the block cannot be found again, so this one is
+				// not recoverable.
+				return 0, fmt.Errorf("tcp: header line longer than %d bytes", f.max)
+			}
+			return 0, err
+		}
+	}
+
+	if length < 0 {
+		return 0, errMissingContentLength
+	}
+	return length, nil
+}
+
+// frameWriter writes frames in its current framing. WriteFrame is not safe for
+// concurrent use; callers serialize writes so that responses never interleave
+// on the wire. The framing itself may be changed at any time.
+type frameWriter struct {
+	w       io.Writer
+	framing atomic.Int32
+
+	// flush, when set, pushes every frame through a buffering writer such as
+	// a compressor.
+	flush func() error
+}
+
+func newFrameWriter(w io.Writer, framing Framing) *frameWriter {
+	f := &frameWriter{w: w}
+	f.SetFraming(framing)
+	return f
+}
+
+// SetFraming changes the framing of the following frames.
+func (f *frameWriter) SetFraming(framing Framing) {
+	f.framing.Store(int32(framing))
+}
+
+// WriteFrame writes data with its delimiters in a single write.
+func (f *frameWriter) WriteFrame(data []byte) error {
+	var buf []byte
+	switch Framing(f.framing.Load()) {
+	case ContentLengthFraming:
+		buf = fmt.Appendf(make([]byte, 0, len(data)+32), "%s: %d\r\n\r\n", contentLengthHeader, len(data))
+		buf = append(buf, data...)
+	default:
+		buf = make([]byte, 0, len(data)+1)
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+
+	if _, err := f.w.Write(buf); err != nil {
+		return err
+	}
+	if f.flush != nil {
+		return f.flush()
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// rawPair returns a raw connection to write bytes on and the [Connection]
+// reading them, with opts.
+func rawPair(t *testing.T, opts ...Option) (net.Conn, *Connection) {
+	t.Helper()
+	listener := listen(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("Accept failed")
+	}
+	c := NewConnection(conn, opts...)
+	t.Cleanup(func() {
+		raw.Close()
+		c.Close()
+	})
+	return raw, c
+}
+
+// readIDs reads n messages from c and returns their ids.
+func readIDs(t *testing.T, c *Connection, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+
+	var ids []string
+	for range n {
+		msg, err := c.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read after %v: %v", ids, err)
+		}
+		req, ok := msg.(*jsonrpc.Request)
+		if !ok {
+			t.Fatalf("Read = %#v, want a request", msg)
+		}
+		ids = append(ids, fmt.Sprint(req.ID.Raw()))
+	}
+	return ids
+}
+
+func call(id int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/list","params":{}}`, id)
+}
+
+func TestReadCoalescedFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		wire string
+	}{
+		{"newline", call(1) + "\n" + call(2) + "\n" + call(3) + "\n"},
+		{"content-length", contentLength(call(1)) + contentLength(call(2)) + contentLength(call(3))},
+		{"blank lines", "\n" + call(1) + "\r\n\r\n" + call(2) + "\n\n" + call(3) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, c := rawPair(t)
+			if _, err := raw.Write([]byte(tt.wire)); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(readIDs(t, c, 3), ","); got != "1,2,3" {
+				t.Fatalf("ids = %s, want 1,2,3", got)
+			}
+		})
+	}
+}
+
+func TestReadFrameSplitAcrossWrites(t *testing.T) {
+	raw, c := rawPair(t)
+	wire := call(1) + "\n" + contentLength(call(2)) + call(3) + "\n"
+
+	// one byte at a time, so that every frame boundary falls inside a write
+	go func() {
+		for i := range len(wire) {
+			if _, err := raw.Write([]byte{wire[i]}); err != nil {
+				t.Errorf("Write: %v", err)
+				return
+			}
+		}
+	}()
+	if got := strings.Join(readIDs(t, c, 3), ","); got != "1,2,3" {
+		t.Fatalf("ids = %s, want 1,2,3", got)
+	}
+}
+
+func contentLength(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// Every combination of framings must interoperate: readers accept both, so
+// a peer using the other framing is still understood.
+var framingPairs = []struct {
+	name           string
+	client, server []Option
+}{
+	{"newline", nil, nil},
+	{"content-length", []Option{WithFraming(ContentLengthFraming)}, []Option{WithFraming(ContentLengthFraming)}},
+	{"content-length client", []Option{WithFraming(ContentLengthFraming)}, nil},
+	{"content-length server", nil, []Option{WithFraming(ContentLengthFraming)}},
+}
+
+func TestFramingConnection(t *testing.T) {
+	for _, tt := range framingPairs {
+		t.Run(tt.name, func(t *testing.T) {
+			transporttest.Run(t, pair(tt.client, tt.server))
+		})
+	}
+}
+
+func TestFramingSession(t *testing.T) {
+	for _, tt := range framingPairs {
+		t.Run(tt.name, func(t *testing.T) {
+			transporttest.RunSession(t, serve(tt.client, tt.server))
+		})
+	}
+}
+
+func TestReadMixedFramings(t *testing.T) {
+	raw, c := rawPair(t)
+	wire := call(1) + "\n" +
+		contentLength(call(2)) +
+		"content-length:   " + fmt.Sprint(len(call(3))) + "\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n" + call(3) +
+		"Content-Length: " + fmt.Sprint(len(call(4))+2) + "\n\n{\n" + call(4)[1:] + "\n" +
+		call(5) + "\n"
+	if _, err := raw.Write([]byte(wire)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(readIDs(t, c, 5), ","); got != "1,2,3,4,5" {
+		t.Fatalf("ids = %s, want 1,2,3,4,5", got)
+	}
+}
+
+func TestReadInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name, wire, err string
+	}{
+		{"no colon", "Content-Length 10\r\n\r\n{}", "tcp: malformed header line"},
+		{"not a number", "Content-Length: ten\r\n\r\n{}", "tcp: invalid Content-Length"},
+		{"negative", "Content-Length: -2\r\n\r\n{}", "tcp: invalid Content-Length"},
+		{"missing length", "Content-Type: application/json\r\n\r\n{}", errMissingContentLength.Error()},
+		{"truncated body", "Content-Length: 100\r\n\r\n{}", "unexpected EOF"},
+		{"truncated line", `{"jsonrpc":"2.0"`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFrameReader(strings.NewReader(tt.wire), DefaultMaxFrameSize)
+			_, _, err := r.ReadFrame()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ReadFrame error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// A server answers in the framing of its peer unless WithFraming is given.
+func TestServerMirrorsFraming(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		send   func(string) string
+		prefix string
+	}{
+		{"newline peer", nil, func(s string) string { return s + "\n" }, "{"},
+		{"content-length peer", nil, contentLength, "Content-Length: "},
+		{"forced newline", []Option{WithFraming(NewlineFraming)}, contentLength, "{"},
+		{"forced content-length", []Option{WithFraming(ContentLengthFraming)}, func(s string) string { return s + "\n" }, "Content-Length: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+			listener := listen(t)
+			srv := NewServer(server, tt.opts...)
+			go srv.Serve(listener)
+			t.Cleanup(func() { srv.Close() })
+
+			raw, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer raw.Close()
+			raw.SetDeadline(time.Now().Add(transporttest.Timeout))
+
+			initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"raw","version":"v1"}}}`
+			if _, err := raw.Write([]byte(tt.send(initialize))); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, len(tt.prefix))
+			if _, err := io.ReadFull(raw, got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.prefix {
+				t.Fatalf("response starts with %q, want %q", got, tt.prefix)
+			}
+		})
+	}
+}
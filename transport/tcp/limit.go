@@ -0,0 +1,105 @@
+package tcp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+)
+
+// CodeServerBusy is the JSON-RPC error code answered to connections and tool
+// calls over the limits set by [WithMaxConns] and [WithMaxConcurrentCalls].
+// The error data is a [BusyData].
+const CodeServerBusy = -32000
+
+// methodCallTool is the MCP method limited by [WithMaxConcurrentCalls].
+const methodCallTool = "tools/call"
+
+// BusyData is the data of a [CodeServerBusy] error.
+type BusyData struct {
+	// Reason is "connections" or "tool_calls", the limit that was reached.
+	Reason string `json:"reason"`
+	// Limit is the value of that limit.
+	Limit int `json:"limit"`
+	// RetryAfterMs suggests how long to wait before trying again.
+	RetryAfterMs int64 `json:"retryAfterMs"`
+}
+
+// busyRetryAfter is the delay suggested to rejected clients when there is no
+// queue timeout to go by.
+const busyRetryAfter = time.Second
+
+func busyData(reason string, limit int, queueTimeout time.Duration) BusyData {
+	retry := queueTimeout
+	if retry <= 0 {
+		retry = busyRetryAfter
+	}
+	return BusyData{Reason: reason, Limit: limit, RetryAfterMs: retry.Milliseconds()}
+}
+
+// semaphore bounds the number of holders of a resource.
+type semaphore chan struct{}
+
+// acquire takes a slot, waiting up to timeout for one to be released. It
+// reports whether the slot was taken.
+func (s semaphore) acquire(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case s <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s semaphore) release() {
+	<-s
+}
+
+// callSlots tracks the tool calls of a session that hold a slot, so that the
+// slot is released when their response is written.
+type callSlots struct {
+	sem semaphore
+
+	mu    sync.Mutex
+	calls map[jsonrpc.ID]struct{}
+}
+
+func newCallSlots(n int) *callSlots {
+	return &callSlots{sem: make(semaphore, n), calls: make(map[jsonrpc.ID]struct{})}
+}
+
+func (s *callSlots) acquire(ctx context.Context, id jsonrpc.ID, timeout time.Duration) bool {
+	if !s.sem.acquire(ctx, timeout) {
+		return false
+	}
+	s.mu.Lock()
+	s.calls[id] = struct{}{}
+	s.mu.Unlock()
+	return true
+}
+
+// done releases the slot held by the call id, if any.
+func (s *callSlots) done(id jsonrpc.ID) {
+	s.mu.Lock()
+	_, ok := s.calls[id]
+	delete(s.calls, id)
+	s.mu.Unlock()
+
+	if ok {
+		s.sem.release()
+	}
+}
@@ -0,0 +1,222 @@
+package tcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// rawResponse is a JSON-RPC response read by a [rawClient].
+type rawResponse struct {
+	ID     any             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int64    `json:"code"`
+		Message string   `json:"message"`
+		Data    BusyData `json:"data"`
+	} `json:"error"`
+}
+
+// rawClient speaks JSON-RPC lines to a server, so that the tests see the
+// errors as sent.
+type rawClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string) *rawClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(transporttest.Timeout))
+	return &rawClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *rawClient) send(lines ...string) {
+	c.t.Helper()
+	for _, line := range lines {
+		if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func (c *rawClient) read() rawResponse {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("reading the answer: %v", err)
+	}
+	var resp rawResponse
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		c.t.Fatalf("answer %q: %v", line, err)
+	}
+	return resp
+}
+
+// initialize runs the initialize handshake.
+func (c *rawClient) initialize() {
+	c.t.Helper()
+	c.send(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"raw","version":"v1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized","params":{}}`,
+	)
+	if resp := c.read(); resp.Error != nil {
+		c.t.Fatalf("initialize: %+v", resp.Error)
+	}
+}
+
+// checkBusy checks that resp is a CodeServerBusy error with want as data.
+func checkBusy(t *testing.T, resp rawResponse, want BusyData) {
+	t.Helper()
+	if resp.Error == nil || resp.Error.Code != CodeServerBusy {
+		t.Fatalf("answer = %+v, want a %d error", resp, CodeServerBusy)
+	}
+	if resp.Error.Data != want {
+		t.Errorf("busy data = %+v, want %+v", resp.Error.Data, want)
+	}
+}
+
+// serveLimited serves server with opts on a loopback listener and returns
+// its address.
+func serveLimited(t *testing.T, server *mcp.Server, opts ...Option) string {
+	t.Helper()
+	listener := listen(t)
+	srv := NewServer(server, opts...)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+func TestMaxConns(t *testing.T) {
+	addr := serveLimited(t, mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil), WithMaxConns(1))
+
+	first := dialRaw(t, addr)
+	first.initialize()
+
+	// the second connection is told why, and closed
+	second := dialRaw(t, addr)
+	resp := second.read()
+	checkBusy(t, resp, BusyData{Reason: "connections", Limit: 1, RetryAfterMs: busyRetryAfter.Milliseconds()})
+	if resp.ID != nil {
+		t.Errorf("id of the rejection = %v, want null", resp.ID)
+	}
+	if _, err := second.r.ReadByte(); err == nil {
+		t.Error("the rejected connection is still open")
+	}
+
+	// once the first session ends, a new one is served
+	first.conn.Close()
+	for range 50 {
+		third := dialRaw(t, addr)
+		third.send(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+		if resp := third.read(); resp.Error == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("no session served after the first one ended")
+}
+
+func TestMaxConnsQueue(t *testing.T) {
+	const queue = 150 * time.Millisecond
+	addr := serveLimited(t, mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil), WithMaxConns(1), WithQueueTimeout(queue))
+
+	first := dialRaw(t, addr)
+	first.initialize()
+
+	// a connection over the limit waits for the queue timeout
+	start := time.Now()
+	second := dialRaw(t, addr)
+	checkBusy(t, second.read(), BusyData{Reason: "connections", Limit: 1, RetryAfterMs: queue.Milliseconds()})
+	if waited := time.Since(start); waited < queue {
+		t.Errorf("rejected after %v, before the queue timeout", waited)
+	}
+
+	// and takes the slot freed meanwhile
+	third := dialRaw(t, addr)
+	third.send(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	time.Sleep(queue / 3)
+	first.conn.Close()
+	if resp := third.read(); resp.Error != nil {
+		t.Errorf("queued connection answered %+v, want a session", resp.Error)
+	}
+}
+
+func TestMaxConcurrentCalls(t *testing.T) {
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	addr := serveLimited(t, slowServer(started, release), WithMaxConcurrentCalls(1))
+	c := dialRaw(t, addr)
+	c.initialize()
+
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"slow","arguments":{}}}`)
+	<-started
+	// the second call does not reach the server
+	c.send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"slow","arguments":{}}}`)
+	resp := c.read()
+	if resp.ID != float64(3) {
+		t.Fatalf("answer to %v first, want the rejection of 3", resp.ID)
+	}
+	checkBusy(t, resp, BusyData{Reason: "tool_calls", Limit: 1, RetryAfterMs: busyRetryAfter.Milliseconds()})
+	select {
+	case <-started:
+		t.Error("the rejected call ran")
+	default:
+	}
+
+	// other requests are not limited
+	c.send(`{"jsonrpc":"2.0","id":4,"method":"tools/list"}`)
+	if resp := c.read(); resp.ID != float64(4) || resp.Error != nil {
+		t.Errorf("tools/list during a call = %+v", resp)
+	}
+
+	close(release)
+	if resp := c.read(); resp.ID != float64(2) || resp.Error != nil {
+		t.Fatalf("answer to the first call = %+v", resp)
+	}
+	// the slot is free again
+	c.send(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"slow","arguments":{}}}`)
+	if resp := c.read(); resp.ID != float64(5) || resp.Error != nil {
+		t.Errorf("call after the first one = %+v", resp)
+	}
+}
+
+func TestMaxConcurrentCallsQueue(t *testing.T) {
+	const queue = 2 * time.Second
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	addr := serveLimited(t, slowServer(started, release), WithMaxConcurrentCalls(1), WithQueueTimeout(queue))
+	c := dialRaw(t, addr)
+	c.initialize()
+
+	c.send(
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"slow","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"slow","arguments":{}}}`,
+	)
+	<-started
+	// the second call waits for the slot of the first one
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	for _, id := range []float64{2, 3} {
+		if resp := c.read(); resp.ID != id || resp.Error != nil {
+			t.Errorf("answer = %+v, want the result of %v", resp, id)
+		}
+	}
+}
+
+func TestBusyData(t *testing.T) {
+	if got, want := busyData("tool_calls", 4, 0), (BusyData{Reason: "tool_calls", Limit: 4, RetryAfterMs: 1000}); got != want {
+		t.Errorf("busyData without a queue = %+v, want %+v", got, want)
+	}
+	if got := busyData("connections", 2, 250*time.Millisecond); got.RetryAfterMs != 250 {
+		t.Errorf("RetryAfterMs = %d, want the queue timeout", got.RetryAfterMs)
+	}
+}
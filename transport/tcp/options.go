@@ -0,0 +1,128 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// DefaultMaxFrameSize is the size limit of an incoming frame when
+// [WithMaxFrameSize] is not used.
+const DefaultMaxFrameSize = 4 << 20
+
+// Option configures a [Connection], a [Transport] or a [Server].
+type Option func(*options)
+
+type options struct {
+	framing    Framing
+	framingSet bool
+	tls        *tls.Config
+
+	compression []Compression
+
+	maxFrameSize int
+	idleTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	maxConns     int
+	maxCalls     int
+	queueTimeout time.Duration
+
+	// mirrorFraming makes a connection answer in the framing of its peer.
+	mirrorFraming bool
+	// rejectOversized makes a connection answer an oversized frame with a
+	// JSON-RPC error and keep reading, instead of failing the read.
+	rejectOversized bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{maxFrameSize: DefaultMaxFrameSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFraming selects how outgoing messages are delimited on the wire.
+//
+// Incoming messages are always accepted in both framings. When a [Server] is
+// created without this option, each connection answers in the framing used
+// by its peer, so newline and Content-Length clients can share a listener.
+func WithFraming(framing Framing) Option {
+	return func(o *options) {
+		o.framing = framing
+		o.framingSet = true
+	}
+}
+
+// WithMaxFrameSize limits the size of an incoming frame to n bytes, which
+// defaults to [DefaultMaxFrameSize]. Oversized frames are skipped without
+// being buffered: a [Server] answers them with an "invalid request" JSON-RPC
+// error and keeps the session open, a client connection fails the read with
+// [ErrFrameTooLarge].
+func WithMaxFrameSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxFrameSize = n
+		}
+	}
+}
+
+// WithIdleTimeout closes a connection when no new message starts within d.
+// Zero, the default, means no limit.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithReadTimeout closes a connection when a message is not received within
+// d of its first byte, which protects a server from peers trickling data.
+// Zero, the default, means no limit.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout closes a connection when a message cannot be written
+// within d, e.g. because the peer stopped reading. Zero, the default, means
+// no limit.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithMaxConns limits a [Server] to n sessions at a time. A connection
+// accepted over the limit waits for a free slot as set by [WithQueueTimeout]
+// and is then answered with a [CodeServerBusy] error and closed. Zero, the
+// default, means no limit.
+func WithMaxConns(n int) Option {
+	return func(o *options) {
+		o.maxConns = n
+	}
+}
+
+// WithMaxConcurrentCalls limits every session to n tool calls executing at a
+// time. A call over the limit waits for a free slot as set by
+// [WithQueueTimeout] and is then answered with a [CodeServerBusy] error,
+// without reaching the server. Zero, the default, means no limit.
+func WithMaxConcurrentCalls(n int) Option {
+	return func(o *options) {
+		o.maxCalls = n
+	}
+}
+
+// WithQueueTimeout sets how long a connection or a tool call over its limit
+// waits for a free slot before being rejected. Zero, the default, rejects it
+// at once.
+//
+// A session does not read further messages while one of its calls waits, so
+// its next requests queue up in the socket buffers and a noisy client slows
+// down only itself.
+func WithQueueTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.queueTimeout = d
+	}
+}
@@ -0,0 +1,65 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Peer describes the client at the other end of a server side connection.
+type Peer struct {
+	// Addr is the remote address of the connection.
+	Addr net.Addr
+	// TLS is the state of the TLS connection, or nil for cleartext connections.
+	TLS *tls.ConnectionState
+	// Conn is the accepted connection, for transport specific information
+	// such as the credentials of a Unix socket peer. It must not be read from
+	// or written to.
+	Conn net.Conn
+}
+
+// Certificate returns the leaf certificate presented by the client, or nil
+// when the client did not authenticate with a certificate.
+func (p *Peer) Certificate() *x509.Certificate {
+	if p == nil || p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return p.TLS.PeerCertificates[0]
+}
+
+// CommonName returns the subject common name of the client certificate, or
+// an empty string when there is none.
+func (p *Peer) CommonName() string {
+	if cert := p.Certificate(); cert != nil {
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+func newPeer(conn net.Conn) *Peer {
+	peer := &Peer{Addr: conn.RemoteAddr(), Conn: conn}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		peer.TLS = &state
+	}
+	return peer
+}
+
+// peers maps the session id of every open server side connection to its peer.
+var peers sync.Map
+
+// PeerFromSession returns the peer of the connection serving session, for use
+// by tool handlers through [mcp.CallToolRequest].Session. It returns nil when
+// the session was not created by a [Server] of this package or is closed.
+func PeerFromSession(session *mcp.ServerSession) *Peer {
+	if session == nil {
+		return nil
+	}
+	if peer, ok := peers.Load(session.ID()); ok {
+		return peer.(*Peer)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Status is the state of the connection of a [ReconnectingSession].
+type Status int
+
+const (
+	// StatusConnected is reported after a successful connection and
+	// initialize handshake.
+	StatusConnected Status = iota
+	// StatusDisconnected is reported when the connection is lost.
+	StatusDisconnected
+	// StatusReconnecting is reported before every connection attempt after
+	// the first one.
+	StatusReconnecting
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusConnected:
+		return "connected"
+	case StatusDisconnected:
+		return "disconnected"
+	case StatusReconnecting:
+		return "reconnecting"
+	default:
+		return "Status(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// ReconnectOptions configures a [ReconnectingSession]. The zero value is valid.
+type ReconnectOptions struct {
+	// InitialBackoff is the delay before the first reconnection attempt.
+	// It defaults to 200ms and doubles after every failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. It defaults to 10s.
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of consecutive failed attempts after which an
+	// operation gives up. Zero means retry until the context is done.
+	MaxAttempts int
+	// Idempotent reports whether a call to the named tool may be sent again
+	// after the connection was lost while it was in flight. When nil, tool
+	// calls are never retried; listing tools is always retried.
+	Idempotent func(tool string) bool
+	// OnStatus, if set, is called on every status change. err is the cause of
+	// a disconnection or of a failed attempt, if any.
+	OnStatus func(status Status, err error)
+}
+
+// ReconnectingSession is an MCP client session that survives server restarts.
+//
+// When the connection is lost it dials again through its transport with an
+// exponential backoff and re-runs the MCP initialize handshake. Calls that
+// failed because of the disconnection are sent again if they are idempotent.
+type ReconnectingSession struct {
+	client    *mcp.Client
+	transport mcp.Transport
+	opts      ReconnectOptions
+
+	connectMu sync.Mutex // serializes connection attempts
+
+	mu      sync.Mutex // guards session and closed
+	session *mcp.ClientSession
+	closed  bool
+}
+
+// NewReconnectingSession connects client through transport and returns the
+// session. The transport must allow several calls to Connect, as [Transport]
+// does; every reconnection uses a new connection from it.
+func NewReconnectingSession(ctx context.Context, client *mcp.Client, transport mcp.Transport, opts *ReconnectOptions) (*ReconnectingSession, error) {
+	r := &ReconnectingSession{client: client, transport: transport}
+	if opts != nil {
+		r.opts = *opts
+	}
+	if r.opts.InitialBackoff <= 0 {
+		r.opts.InitialBackoff = 200 * time.Millisecond
+	}
+	if r.opts.MaxBackoff <= 0 {
+		r.opts.MaxBackoff = 10 * time.Second
+	}
+
+	if _, err := r.Session(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Session returns the current session, reconnecting first if needed.
+func (r *ReconnectingSession) Session(ctx context.Context) (*mcp.ClientSession, error) {
+	r.connectMu.Lock()
+	defer r.connectMu.Unlock()
+
+	if session, err := r.current(); session != nil || err != nil {
+		return session, err
+	}
+
+	backoff := r.opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		session, err := r.client.Connect(ctx, r.transport, nil)
+		if err == nil {
+			r.mu.Lock()
+			closed := r.closed
+			if !closed {
+				r.session = session
+			}
+			r.mu.Unlock()
+
+			if closed {
+				_ = session.Close()
+				return nil, mcp.ErrConnectionClosed
+			}
+
+			r.notify(StatusConnected, nil)
+			go r.watch(session)
+			return session, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if r.opts.MaxAttempts > 0 && attempt >= r.opts.MaxAttempts {
+			return nil, err
+		}
+
+		r.notify(StatusReconnecting, err)
+		if err := sleep(ctx, jitter(backoff)); err != nil {
+			return nil, err
+		}
+		backoff = min(2*backoff, r.opts.MaxBackoff)
+	}
+}
+
+// current returns the connected session, if any, or an error once closed.
+func (r *ReconnectingSession) current() (*mcp.ClientSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, mcp.ErrConnectionClosed
+	}
+	return r.session, nil
+}
+
+// CallTool calls a tool, reconnecting when the connection is lost. The call
+// is sent again on the new connection only if the tool is idempotent.
+func (r *ReconnectingSession) CallTool(ctx context.Context, params *mcp.CallToolParams) (*mcp.CallToolResult, error) {
+	retry := r.opts.Idempotent != nil && r.opts.Idempotent(params.Name)
+	return retryOn(r, ctx, retry, func(session *mcp.ClientSession) (*mcp.CallToolResult, error) {
+		return session.CallTool(ctx, params)
+	})
+}
+
+// ListTools lists the tools of the server, reconnecting when needed.
+func (r *ReconnectingSession) ListTools(ctx context.Context, params *mcp.ListToolsParams) (*mcp.ListToolsResult, error) {
+	return retryOn(r, ctx, true, func(session *mcp.ClientSession) (*mcp.ListToolsResult, error) {
+		return session.ListTools(ctx, params)
+	})
+}
+
+// Close closes the current session and stops reconnecting.
+func (r *ReconnectingSession) Close() error {
+	r.mu.Lock()
+	session := r.session
+	r.session = nil
+	r.closed = true
+	r.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+	return session.Close()
+}
+
+// retryOn runs call on the current session. When the call fails because the
+// connection was lost, the session is dropped and, if retry is set, the call
+// is run once more on a new session.
+func retryOn[T any](r *ReconnectingSession, ctx context.Context, retry bool, call func(*mcp.ClientSession) (T, error)) (T, error) {
+	for {
+		session, err := r.Session(ctx)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+
+		res, err := call(session)
+		if err == nil || !isConnectionError(err) {
+			return res, err
+		}
+
+		r.drop(session, err)
+		if !retry || ctx.Err() != nil {
+			return res, err
+		}
+		retry = false
+	}
+}
+
+// watch drops session as soon as its connection ends.
+func (r *ReconnectingSession) watch(session *mcp.ClientSession) {
+	err := session.Wait()
+	if err == nil {
+		err = mcp.ErrConnectionClosed
+	}
+	r.drop(session, err)
+}
+
+// drop forgets session if it is still the current one.
+func (r *ReconnectingSession) drop(session *mcp.ClientSession, err error) {
+	r.mu.Lock()
+	current := r.session == session
+	if current {
+		r.session = nil
+	}
+	closed := r.closed
+	r.mu.Unlock()
+
+	if !current {
+		return
+	}
+	_ = session.Close()
+
+	if !closed {
+		r.notify(StatusDisconnected, err)
+	}
+}
+
+func (r *ReconnectingSession) notify(status Status, err error) {
+	if r.opts.OnStatus != nil {
+		r.opts.OnStatus(status, err)
+	}
+}
+
+// isConnectionError reports whether err means that the connection is gone,
+// as opposed to an error returned by the server.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, mcp.ErrConnectionClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &opErr)
+}
+
+// jitter spreads d by ±20% so that clients do not reconnect in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*0.4-0.2)*float64(d))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
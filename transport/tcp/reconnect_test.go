@@ -0,0 +1,212 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// restartable is an order server that a test can restart on the same
+// address, as if its process was killed: its connections drop at once.
+type restartable struct {
+	t      *testing.T
+	addr   string
+	server *mcp.Server
+
+	mu       sync.Mutex
+	srv      *Server
+	listener *trackingListener
+}
+
+// trackingListener keeps the connections it accepted.
+type trackingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+}
+
+func (r *restartable) start() {
+	listener, err := net.Listen("tcp", r.addr)
+	if err != nil {
+		r.t.Errorf("Listen: %v", err)
+		return
+	}
+	r.addr = listener.Addr().String()
+	srv := NewServer(r.server)
+	tracking := &trackingListener{Listener: listener}
+	r.mu.Lock()
+	r.srv, r.listener = srv, tracking
+	r.mu.Unlock()
+	go srv.Serve(tracking)
+}
+
+// restart stops the server, and starts it again after down.
+func (r *restartable) restart(down time.Duration) {
+	r.close()
+	time.AfterFunc(down, r.start)
+}
+
+func (r *restartable) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.srv.Close()
+	r.listener.closeConns()
+}
+
+type orderArgs struct {
+	IDOrder string `json:"idOrder"`
+}
+
+func TestReconnectingSession(t *testing.T) {
+	var (
+		initialized atomic.Int32
+		getOrders   atomic.Int32
+		creates     atomic.Int32
+	)
+	r := &restartable{t: t, addr: "127.0.0.1:0"}
+	r.server = mcp.NewServer(&mcp.Implementation{Name: "orders", Version: "v1.0.0"}, &mcp.ServerOptions{
+		InitializedHandler: func(context.Context, *mcp.InitializedRequest) { initialized.Add(1) },
+	})
+	// the first call of each tool restarts the server while it is in flight
+	mcp.AddTool(r.server, &mcp.Tool{Name: "getOrder"}, func(_ context.Context, _ *mcp.CallToolRequest, args orderArgs) (*mcp.CallToolResult, any, error) {
+		if getOrders.Add(1) == 1 {
+			r.restart(100 * time.Millisecond)
+			return nil, nil, errors.New("killed")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "order " + args.IDOrder}}}, nil, nil
+	})
+	mcp.AddTool(r.server, &mcp.Tool{Name: "createOrder"}, func(context.Context, *mcp.CallToolRequest, orderArgs) (*mcp.CallToolResult, any, error) {
+		if creates.Add(1) == 1 {
+			r.restart(0)
+			return nil, nil, errors.New("killed")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "created"}}}, nil, nil
+	})
+	r.start()
+	defer r.close()
+
+	var (
+		mu       sync.Mutex
+		statuses []Status
+	)
+	opts := &ReconnectOptions{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Idempotent:     func(tool string) bool { return tool == "getOrder" },
+		OnStatus: func(status Status, _ error) {
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil)
+	session, err := NewReconnectingSession(ctx, client, NewTransport(r.addr), opts)
+	if err != nil {
+		t.Fatalf("NewReconnectingSession: %v", err)
+	}
+	defer session.Close()
+
+	// the connection is lost during an idempotent call: it is sent again
+	// once the server is back, without the caller noticing
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "getOrder", Arguments: map[string]any{"idOrder": "42"}})
+	if err != nil {
+		t.Fatalf("getOrder across a restart: %v", err)
+	}
+	if got := res.Content[0].(*mcp.TextContent).Text; got != "order 42" {
+		t.Errorf("getOrder = %q, want order 42", got)
+	}
+	if n := getOrders.Load(); n != 2 {
+		t.Errorf("getOrder ran %d times, want 2", n)
+	}
+	if n := initialized.Load(); n != 2 {
+		t.Errorf("%d initialize handshakes, want 2", n)
+	}
+
+	mu.Lock()
+	got := slices.Compact(slices.Clone(statuses))
+	mu.Unlock()
+	want := []Status{StatusConnected, StatusDisconnected, StatusReconnecting, StatusConnected}
+	if !slices.Equal(got, want) {
+		t.Errorf("statuses = %v, want %v (repeats aside)", got, want)
+	}
+
+	// a call that is not idempotent fails instead of running twice
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "createOrder", Arguments: map[string]any{"idOrder": "43"}}); err == nil {
+		t.Error("createOrder across a restart succeeded, want the connection error")
+	}
+	if n := creates.Load(); n != 1 {
+		t.Errorf("createOrder ran %d times, want 1", n)
+	}
+
+	// the next operation reconnects, and listing tools is always retried
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools after the restart: %v", err)
+	}
+	if len(tools.Tools) != 2 {
+		t.Errorf("%d tools, want 2", len(tools.Tools))
+	}
+	if n := initialized.Load(); n != 3 {
+		t.Errorf("%d initialize handshakes, want 3", n)
+	}
+}
+
+func TestReconnectingSessionMaxAttempts(t *testing.T) {
+	listener := listen(t)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	var (
+		mu       sync.Mutex
+		statuses []Status
+	)
+	opts := &ReconnectOptions{
+		InitialBackoff: time.Millisecond,
+		MaxAttempts:    3,
+		OnStatus: func(status Status, err error) {
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil)
+	if _, err := NewReconnectingSession(ctx, client, NewTransport(addr), opts); err == nil {
+		t.Fatal("NewReconnectingSession succeeded without a server")
+	}
+	want := []Status{StatusReconnecting, StatusReconnecting}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
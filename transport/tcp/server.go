@@ -0,0 +1,244 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// shutdownPollInterval is how often Shutdown checks for idle connections.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Server accepts TCP connections and runs an MCP session for each of them.
+type Server struct {
+	server *mcp.Server
+	opts   options
+
+	// ErrorLog receives connection errors. The standard logger is used when nil.
+	ErrorLog *log.Logger
+
+	// ctx is the parent context of every session; cancel ends them all.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// wg counts the goroutines serving a connection.
+	wg sync.WaitGroup
+
+	// sessions bounds the connections served at a time; nil means no limit.
+	sessions semaphore
+
+	mu           sync.Mutex
+	listener     net.Listener
+	conns        map[*Connection]struct{}
+	shuttingDown bool
+}
+
+// NewServer returns a server that serves the tools, resources and prompts of
+// server on every accepted connection.
+func NewServer(server *mcp.Server, opts ...Option) *Server {
+	o := newOptions(opts)
+	o.mirrorFraming = !o.framingSet
+	o.rejectOversized = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		server: server,
+		opts:   o,
+		ctx:    ctx,
+		cancel: cancel,
+		conns:  make(map[*Connection]struct{}),
+	}
+	if o.maxConns > 0 {
+		s.sessions = make(semaphore, o.maxConns)
+	}
+	return s
+}
+
+// Serve accepts connections on listener until it is closed. Each connection
+// is handled in its own goroutine.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				s.logf("tcp: accept: %v", err)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.shuttingDown {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting new connections and cancels the context of every
+// running session, which closes their connections.
+func (s *Server) Close() error {
+	s.cancel()
+	return s.closeListener()
+}
+
+// Shutdown gracefully shuts the server down. It stops accepting connections,
+// waits until no session has a request in progress or ctx is done, and then
+// cancels the requests left and closes every session, waiting for the
+// running handlers to return.
+//
+// It returns the number of sessions that were closed, and ctx.Err() if the
+// drain did not complete in time.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	err := s.closeListener()
+	if drainErr := s.waitIdle(ctx); drainErr != nil {
+		err = drainErr
+	}
+
+	s.mu.Lock()
+	closed := len(s.conns)
+	s.mu.Unlock()
+
+	// a closing session waits for its handlers, which are canceled first
+	s.mu.Lock()
+	for c := range s.conns {
+		c.cancelRequests()
+	}
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+
+	return closed, err
+}
+
+func (s *Server) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shuttingDown = true
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// waitIdle waits until no connection has a request in progress.
+func (s *Server) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for !s.idle() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (s *Server) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		if c.inProgress() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) track(c *Connection) {
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Server) untrack(c *Connection) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	if s.opts.tls != nil {
+		tlsConn := tls.Server(conn, s.opts.tls)
+		ctx, cancel := context.WithTimeout(s.ctx, handshakeTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			s.logf("tcp: tls handshake %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		conn = tlsConn
+	}
+
+	if s.sessions != nil {
+		if !s.sessions.acquire(s.ctx, s.opts.queueTimeout) {
+			s.reject(conn)
+			return
+		}
+		defer s.sessions.release()
+	}
+
+	err := s.server.Run(s.ctx, &connTransport{conn: conn, server: s})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.logf("tcp: session %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// reject tells a connection over the limit that the server is busy.
+func (s *Server) reject(conn net.Conn) {
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+
+	data := busyData("connections", cap(s.sessions), s.opts.queueTimeout)
+	c := newConnection(conn, s.opts)
+	if err := c.writeError(ctx, jsonrpc.ID{}, CodeServerBusy, "server busy: too many connections", data); err != nil {
+		s.logf("tcp: reject %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Serve accepts connections on listener and serves server on each of them.
+func Serve(listener net.Listener, server *mcp.Server, opts ...Option) error {
+	return NewServer(server, opts...).Serve(listener)
+}
@@ -0,0 +1,132 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// slowServer serves a slow tool, which reports on started that it runs and
+// returns once release is closed or its context is done.
+func slowServer(started chan<- struct{}, release <-chan struct{}) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "slow", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "slow"}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	})
+	return server
+}
+
+// startSlow serves server and starts sessions clients calling its slow tool,
+// once they all run. The results of the calls arrive on the returned channel.
+func startSlow(t *testing.T, server *mcp.Server, started <-chan struct{}, sessions int) (*Server, <-chan error) {
+	t.Helper()
+	listener := listen(t)
+	srv := NewServer(server)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	t.Cleanup(cancel)
+	results := make(chan error, sessions)
+	for range sessions {
+		session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil).Connect(ctx, NewTransport(listener.Addr().String()), nil)
+		if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		t.Cleanup(func() { session.Close() })
+		go func() {
+			_, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "slow", Arguments: map[string]any{}})
+			results <- err
+		}()
+	}
+	for range sessions {
+		select {
+		case <-started:
+		case <-ctx.Done():
+			t.Fatal("the slow calls did not start")
+		}
+	}
+	return srv, results
+}
+
+type shutdownResult struct {
+	closed int
+	err    error
+}
+
+func shutdown(srv *Server, ctx context.Context) <-chan shutdownResult {
+	done := make(chan shutdownResult, 1)
+	go func() {
+		closed, err := srv.Shutdown(ctx)
+		done <- shutdownResult{closed, err}
+	}()
+	return done
+}
+
+func TestShutdownWaitsForCalls(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv, results := startSlow(t, slowServer(started, release), started, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	done := shutdown(srv, ctx)
+	select {
+	case res := <-done:
+		t.Fatalf("Shutdown returned %+v with calls in progress", res)
+	case <-time.After(3 * shutdownPollInterval):
+	}
+
+	close(release)
+	res := <-done
+	if res.err != nil || res.closed != 2 {
+		t.Errorf("Shutdown = %d, %v, want 2 sessions closed", res.closed, res.err)
+	}
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Errorf("call in progress during Shutdown: %v", err)
+		}
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	srv, results := startSlow(t, slowServer(started, nil), started, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	select {
+	case res := <-shutdown(srv, ctx):
+		// the call is canceled once the drain times out
+		if !errors.Is(res.err, context.DeadlineExceeded) || res.closed != 1 {
+			t.Errorf("Shutdown = %d, %v, want 1 session closed and %v", res.closed, res.err, context.DeadlineExceeded)
+		}
+	case <-time.After(transporttest.Timeout):
+		t.Fatal("Shutdown did not return after its deadline")
+	}
+	select {
+	case <-results:
+	case <-time.After(transporttest.Timeout):
+		t.Error("the canceled call got no answer")
+	}
+}
+
+func TestShutdownIdle(t *testing.T) {
+	started := make(chan struct{})
+	srv, _ := startSlow(t, slowServer(started, nil), started, 0)
+
+	closed, err := srv.Shutdown(context.Background())
+	if err != nil || closed != 0 {
+		t.Errorf("Shutdown = %d, %v, want no session and no error", closed, err)
+	}
+}
@@ -0,0 +1,261 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// testCA is a certificate authority generated for a test.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // PEM file of the CA certificate
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: writePEM(t, name+".pem", "CERTIFICATE", der)}
+}
+
+// issue signs a certificate for commonName, valid for 127.0.0.1 when it is a
+// server certificate, and returns its certificate and key files.
+func (ca *testCA) issue(t *testing.T, commonName string, server bool) (certFile, keyFile string) {
+	t.Helper()
+	key := newKey(t)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, commonName+".pem", "CERTIFICATE", der), writePEM(t, commonName+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// syncBuffer collects the error log of a server.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// peerServer returns an MCP server whose whoami tool answers the common name
+// of the client certificate.
+func peerServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "tls", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		name := PeerFromSession(req.Session).CommonName()
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: name}}}, nil, nil
+	})
+	return server
+}
+
+// serveTLS serves server with config and returns its address and error log.
+func serveTLS(t *testing.T, server *mcp.Server, certFile, keyFile, clientCAFile string) (string, *syncBuffer) {
+	t.Helper()
+	config, err := ServerTLSConfig(certFile, keyFile, clientCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := listen(t)
+	errLog := &syncBuffer{}
+	srv := NewServer(server, WithTLS(config))
+	srv.ErrorLog = log.New(errLog, "", 0)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String(), errLog
+}
+
+func connectTLS(t *testing.T, addr, caFile, certFile, keyFile string) (*mcp.ClientSession, error) {
+	t.Helper()
+	config, err := ClientTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) > 0 {
+		// present the certificate even when the server does not list its CA,
+		// so that the server is the one rejecting it
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &config.Certificates[0], nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "tls-client", Version: "v1.0.0"}, nil)
+	return client.Connect(ctx, NewTransport(addr, WithTLS(config)), nil)
+}
+
+func TestTLSSession(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issue(t, "server", true)
+	server, err := ServerTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ClientTLSConfig(ca.file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transporttest.RunSession(t, serve([]Option{WithTLS(client)}, []Option{WithTLS(server)}))
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	serverCert, serverKey := ca.issue(t, "server", true)
+	clientCert, clientKey := ca.issue(t, "alice", false)
+	addr, _ := serveTLS(t, peerServer(), serverCert, serverKey, ca.file)
+
+	session, err := connectTLS(t, addr, ca.file, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "whoami", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if got := res.Content[0].(*mcp.TextContent).Text; got != "alice" {
+		t.Fatalf("peer common name = %q, want alice", got)
+	}
+}
+
+func TestMutualTLSRejectsClient(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other-ca")
+	serverCert, serverKey := ca.issue(t, "server", true)
+	strangerCert, strangerKey := other.issue(t, "mallory", false)
+
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		serverErr         string
+	}{
+		{"no certificate", "", "", "didn't provide a certificate"},
+		{"certificate of another CA", strangerCert, strangerKey, "unknown authority"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, errLog := serveTLS(t, peerServer(), serverCert, serverKey, ca.file)
+
+			session, err := connectTLS(t, addr, ca.file, tt.certFile, tt.keyFile)
+			if err == nil {
+				session.Close()
+				t.Fatal("Connect succeeded, want the client certificate to be rejected")
+			}
+
+			// the server logs the failed handshake asynchronously
+			deadline := time.Now().Add(transporttest.Timeout)
+			for !strings.Contains(errLog.String(), tt.serverErr) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if got := errLog.String(); !strings.Contains(got, "tls handshake") || !strings.Contains(got, tt.serverErr) {
+				t.Fatalf("server log = %q, want a handshake error containing %q", got, tt.serverErr)
+			}
+		})
+	}
+}
+
+func TestTLSWrongCA(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other-ca")
+	serverCert, serverKey := ca.issue(t, "server", true)
+	addr, _ := serveTLS(t, peerServer(), serverCert, serverKey, "")
+
+	session, err := connectTLS(t, addr, other.file, "", "")
+	if err == nil {
+		session.Close()
+		t.Fatal("Connect succeeded, want the server certificate to be rejected")
+	}
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Connect error = %v, want %T", err, unknown)
+	}
+}
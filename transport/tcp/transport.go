@@ -0,0 +1,89 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var _ mcp.Transport = (*Transport)(nil)
+
+// Transport is the client side [mcp.Transport]: every call to Connect dials a
+// new connection to Addr.
+type Transport struct {
+	// Network is the network passed to the dialer. It defaults to "tcp"; any
+	// stream oriented network such as "unix" may be used.
+	Network string
+	// Addr is the address of the MCP server, host:port for TCP.
+	Addr string
+	// Dialer is used to open the connection. The zero value is used when nil.
+	Dialer *net.Dialer
+
+	opts options
+}
+
+// NewTransport returns a transport that dials addr.
+func NewTransport(addr string, opts ...Option) *Transport {
+	return &Transport{Addr: addr, opts: newOptions(opts)}
+}
+
+// Connect dials the server and returns the connection.
+func (t *Transport) Connect(ctx context.Context) (mcp.Connection, error) {
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	network := t.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.opts.tls != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: t.opts.tls}
+		conn, err = tlsDialer.DialContext(ctx, network, t.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, network, t.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConnection(conn, t.opts)
+	if len(t.opts.compression) > 0 {
+		if err := c.offerCompression(ctx, t.opts.compression); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// connTransport is the server side [mcp.Transport] of an accepted connection.
+type connTransport struct {
+	conn   net.Conn
+	server *Server
+}
+
+func (t *connTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	c := newConnection(t.conn, t.server.opts)
+	if err := c.acceptCompression(ctx, t.server.opts.compression); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	peers.Store(c.sessionID, newPeer(t.conn))
+	t.server.track(c)
+	c.onClose = func() {
+		peers.Delete(c.sessionID)
+		t.server.untrack(c)
+	}
+
+	return c, nil
+}
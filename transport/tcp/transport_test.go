@@ -0,0 +1,73 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// listen opens a loopback listener closed at the end of the test.
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+// pair returns a [transporttest.PairFunc] connecting a [Transport] with
+// clientOpts to a [Connection] with serverOpts.
+func pair(clientOpts, serverOpts []Option) transporttest.PairFunc {
+	return func(t *testing.T) (mcp.Connection, mcp.Connection) {
+		t.Helper()
+		listener := listen(t)
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Errorf("Accept: %v", err)
+			}
+			accepted <- conn
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+		defer cancel()
+		client, err := NewTransport(listener.Addr().String(), clientOpts...).Connect(ctx)
+		if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		conn := <-accepted
+		if conn == nil {
+			client.Close()
+			t.FailNow()
+		}
+		return client, NewConnection(conn, serverOpts...)
+	}
+}
+
+// serve returns a [transporttest.ServeFunc] serving with a [Server] with
+// serverOpts, reached through a [Transport] with clientOpts.
+func serve(clientOpts, serverOpts []Option) transporttest.ServeFunc {
+	return func(t *testing.T, server *mcp.Server) mcp.Transport {
+		t.Helper()
+		listener := listen(t)
+		srv := NewServer(server, serverOpts...)
+		go srv.Serve(listener)
+		t.Cleanup(func() { srv.Close() })
+		return NewTransport(listener.Addr().String(), clientOpts...)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	transporttest.Run(t, pair(nil, nil))
+}
+
+func TestSession(t *testing.T) {
+	transporttest.RunSession(t, serve(nil, nil))
+}
@@ -0,0 +1,323 @@
+// Package transporttest checks that an [mcp.Transport] and the connections it
+// opens behave as the MCP SDK expects, so that every transport of this module
+// is tested the same way.
+//
+// [Run] exercises the two ends of a connection directly (Read, Write and
+// Close), while [RunSession] serves an [mcp.Server] through the transport and
+// drives it with an [mcp.Client]:
+//
+//	func TestConnection(t *testing.T) {
+//		transporttest.Run(t, func(t *testing.T) (client, server mcp.Connection) {
+//			...
+//		})
+//	}
+package transporttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Timeout bounds every step of the suite, so that a transport that hangs
+// fails the test instead of blocking it.
+const Timeout = 5 * time.Second
+
+// PairFunc opens a new connection and returns its two ends: the one returned
+// by the Connect of the client transport and the one the server accepted.
+// The suite closes both.
+type PairFunc func(t *testing.T) (client, server mcp.Connection)
+
+// ServeFunc serves server until the test ends and returns a client transport
+// connecting to it.
+type ServeFunc func(t *testing.T, server *mcp.Server) mcp.Transport
+
+// Run checks the Read, Write and Close methods of the connections returned by
+// pair, in both directions.
+func Run(t *testing.T, pair PairFunc) {
+	t.Helper()
+	t.Run("Exchange", func(t *testing.T) { testExchange(t, pair) })
+	t.Run("Pipelined", func(t *testing.T) { testPipelined(t, pair) })
+	t.Run("ConcurrentWrites", func(t *testing.T) { testConcurrentWrites(t, pair) })
+	t.Run("CancelRead", func(t *testing.T) { testCancelRead(t, pair) })
+	t.Run("CloseUnblocksRead", func(t *testing.T) { testCloseUnblocksRead(t, pair) })
+	t.Run("CloseTwice", func(t *testing.T) { testCloseTwice(t, pair) })
+	t.Run("PeerClosed", func(t *testing.T) { testPeerClosed(t, pair) })
+	t.Run("SessionID", func(t *testing.T) { testSessionID(t, pair) })
+}
+
+// RunSession serves an MCP server with an echo tool through serve and checks
+// that a client can initialize, list and call tools, including concurrent
+// calls.
+func RunSession(t *testing.T, serve ServeFunc) {
+	t.Helper()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "transporttest", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo", Description: "echo the text back"}, echo)
+	transport := serve(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "transporttest-client", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(ctx, transport, nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer session.Close()
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(tools.Tools) != 1 || tools.Tools[0].Name != "echo" {
+		t.Fatalf("ListTools = %v, want the echo tool", tools.Tools)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range cap(errs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := fmt.Sprintf("hello %d", i)
+			res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": text}})
+			if err != nil {
+				errs <- fmt.Errorf("CallTool(%q): %w", text, err)
+				return
+			}
+			if got := resultText(res); got != text {
+				errs <- fmt.Errorf("CallTool(%q) = %q", text, got)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type echoInput struct {
+	Text string `json:"text"`
+}
+
+func echo(ctx context.Context, req *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Text}}}, nil, nil
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	if len(res.Content) == 0 {
+		return ""
+	}
+	if text, ok := res.Content[0].(*mcp.TextContent); ok {
+		return text.Text
+	}
+	return ""
+}
+
+func open(t *testing.T, pair PairFunc) (client, server mcp.Connection) {
+	t.Helper()
+	client, server = pair(t)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// request returns a call with the given id and a params payload identifying
+// it.
+func request(id int) *jsonrpc.Request {
+	rid, err := jsonrpc.MakeID(float64(id))
+	if err != nil {
+		panic(err)
+	}
+	return &jsonrpc.Request{ID: rid, Method: "test/echo", Params: []byte(fmt.Sprintf(`{"n":%d,"text":"héllo wörld"}`, id))}
+}
+
+func write(t *testing.T, ctx context.Context, conn mcp.Connection, msg jsonrpc.Message) {
+	t.Helper()
+	if err := conn.Write(ctx, msg); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+// readRequest reads a message and checks that it is the request with id.
+func readRequest(t *testing.T, ctx context.Context, conn mcp.Connection, id int) {
+	t.Helper()
+	msg, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	checkRequest(t, msg, id)
+}
+
+func checkRequest(t *testing.T, msg jsonrpc.Message, id int) {
+	t.Helper()
+	got, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := jsonrpc.EncodeMessage(request(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("Read = %s, want %s", got, want)
+	}
+}
+
+func testExchange(t *testing.T, pair PairFunc) {
+	ctx := testContext(t)
+	client, server := open(t, pair)
+
+	write(t, ctx, client, request(1))
+	readRequest(t, ctx, server, 1)
+
+	resp := &jsonrpc.Response{ID: request(1).ID, Result: []byte(`{"ok":true}`)}
+	write(t, ctx, server, resp)
+	msg, err := client.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	got, ok := msg.(*jsonrpc.Response)
+	if !ok || got.ID != resp.ID || string(got.Result) != `{"ok":true}` {
+		t.Fatalf("Read = %#v, want the response to request 1", msg)
+	}
+}
+
+func testPipelined(t *testing.T, pair PairFunc) {
+	ctx := testContext(t)
+	client, server := open(t, pair)
+
+	const n = 50
+	go func() {
+		for i := range n {
+			if err := client.Write(ctx, request(i)); err != nil {
+				t.Errorf("Write %d: %v", i, err)
+				return
+			}
+		}
+	}()
+	for i := range n {
+		readRequest(t, ctx, server, i)
+	}
+}
+
+func testConcurrentWrites(t *testing.T, pair PairFunc) {
+	ctx := testContext(t)
+	client, server := open(t, pair)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Write(ctx, request(i)); err != nil {
+				t.Errorf("Write %d: %v", i, err)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	for range n {
+		msg, err := client.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		req, ok := msg.(*jsonrpc.Request)
+		if !ok {
+			t.Fatalf("Read = %#v, want a request", msg)
+		}
+		seen[fmt.Sprint(req.ID.Raw())] = true
+	}
+	wg.Wait()
+	if len(seen) != n {
+		t.Fatalf("read %d distinct messages, want %d", len(seen), n)
+	}
+}
+
+func testCancelRead(t *testing.T, pair PairFunc) {
+	_, server := open(t, pair)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := server.Read(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Read with an expired context = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > Timeout/2 {
+		t.Fatalf("Read returned after %v, want it to honor the context deadline", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := server.Write(ctx, request(1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Write with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func testCloseUnblocksRead(t *testing.T, pair PairFunc) {
+	ctx := testContext(t)
+	_, server := open(t, pair)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.Read(ctx)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	server.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Read after Close succeeded, want an error")
+		}
+	case <-time.After(Timeout):
+		t.Fatal("Read still blocked after Close")
+	}
+}
+
+func testCloseTwice(t *testing.T, pair PairFunc) {
+	client, server := open(t, pair)
+	for _, conn := range []mcp.Connection{client, server} {
+		first := conn.Close()
+		if second := conn.Close(); second != first {
+			t.Fatalf("second Close = %v, want %v", second, first)
+		}
+	}
+}
+
+func testPeerClosed(t *testing.T, pair PairFunc) {
+	ctx := testContext(t)
+	client, server := open(t, pair)
+
+	client.Close()
+	if _, err := server.Read(ctx); err == nil {
+		t.Fatal("Read after the peer closed succeeded, want an error")
+	}
+}
+
+func testSessionID(t *testing.T, pair PairFunc) {
+	_, server1 := open(t, pair)
+	_, server2 := open(t, pair)
+	if server1.SessionID() == "" || server1.SessionID() == server2.SessionID() {
+		t.Fatalf("server session ids %q and %q, want distinct non empty ids", server1.SessionID(), server2.SessionID())
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package unix
+
+import "net"
+
+func peerCredentials(*net.UnixConn) (*Credentials, error) {
+	return nil, ErrCredentialsUnsupported
+}
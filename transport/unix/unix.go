@@ -0,0 +1,146 @@
+// Package unix runs MCP sessions over Unix domain sockets.
+//
+// The wire format, the session handling and the options are the ones of the
+// [tcp] package, which works over any stream connection; this package adds
+// what is specific to local sockets: creating the socket file with the given
+// permissions and exposing the credentials of the connected process to tool
+// handlers.
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+)
+
+// ErrCredentialsUnsupported is returned by [CredentialsFromSession] on
+// platforms without peer credentials support.
+var ErrCredentialsUnsupported = errors.New("unix: peer credentials are not supported on this platform")
+
+// Credentials identify the process at the other end of a Unix socket, as
+// reported by the kernel when the connection was established.
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Listen creates a Unix socket at path and restricts its file mode to perm,
+// e.g. 0600 to only accept connections from processes of the same user.
+//
+// The socket is created in a private directory next to path and only moved
+// to path once its mode is set, so no other process can connect in between.
+// A stale socket file left behind by a previous process is removed first; an
+// error is returned if another server is still listening on it.
+func Listen(path string, perm fs.FileMode) (net.Listener, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".mcp-socket-")
+	if err != nil {
+		return nil, fmt.Errorf("unix: creating socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, perm); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix: setting socket permissions: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unix: moving socket into place: %w", err)
+	}
+	return &socketListener{UnixListener: listener, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// socketListener is a listener whose socket was moved to addr after it was
+// created; closing it removes the socket file.
+type socketListener struct {
+	*net.UnixListener
+	addr *net.UnixAddr
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (l *socketListener) Addr() net.Addr { return l.addr }
+
+func (l *socketListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.closeErr = l.UnixListener.Close()
+		os.Remove(l.addr.Name)
+	})
+	return l.closeErr
+}
+
+// NewTransport returns a client transport that connects to the socket at path.
+func NewTransport(path string, opts ...tcp.Option) *tcp.Transport {
+	transport := tcp.NewTransport(path, opts...)
+	transport.Network = "unix"
+	return transport
+}
+
+// Serve accepts connections on listener and serves server on each of them.
+func Serve(listener net.Listener, server *mcp.Server, opts ...tcp.Option) error {
+	return tcp.Serve(listener, server, opts...)
+}
+
+// CredentialsFromSession returns the credentials of the process connected to
+// the session, for use by tool handlers through [mcp.CallToolRequest].Session.
+func CredentialsFromSession(session *mcp.ServerSession) (*Credentials, error) {
+	peer := tcp.PeerFromSession(session)
+	if peer == nil {
+		return nil, errors.New("unix: session is not served by this package")
+	}
+
+	conn := peer.Conn
+	// a TLS session over the socket wraps the Unix connection
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("unix: session is not a Unix socket connection")
+	}
+	return peerCredentials(unixConn)
+}
+
+// removeStale removes the socket file at path if nobody is listening on it.
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("unix: %s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("unix: %s is already in use", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,231 @@
+package unix
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/tcp"
+	"mcp/transport/transporttest"
+)
+
+// listen opens a socket in a temporary directory, closed at the end of the
+// test.
+func listen(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+	listener, err := Listen(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener, path
+}
+
+func TestConnection(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (mcp.Connection, mcp.Connection) {
+		listener, path := listen(t)
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, _ := listener.Accept()
+			accepted <- conn
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+		defer cancel()
+		client, err := NewTransport(path).Connect(ctx)
+		if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		conn := <-accepted
+		if conn == nil {
+			client.Close()
+			t.Fatal("Accept failed")
+		}
+		return client, tcp.NewConnection(conn)
+	})
+}
+
+func TestSession(t *testing.T) {
+	transporttest.RunSession(t, func(t *testing.T, server *mcp.Server) mcp.Transport {
+		listener, path := listen(t)
+		go Serve(listener, server)
+		return NewTransport(path)
+	})
+}
+
+func TestListen(t *testing.T) {
+	listener, path := listen(t)
+
+	if got := listener.Addr().String(); got != path {
+		t.Errorf("Addr = %s, want %s", got, path)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v, want a socket with mode 0600", info.Mode())
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("socket directory holds %d entries, want only the socket", len(entries))
+	}
+
+	if _, err := Listen(path, 0o600); err == nil {
+		t.Error("second Listen on a socket in use succeeded")
+	}
+
+	listener.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file after Close: %v, want it removed", err)
+	}
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := Listen(path, 0o600)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket: %v", err)
+	}
+	listener.Close()
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(path, 0o600); err == nil {
+		t.Error("Listen over a regular file succeeded")
+	}
+}
+
+// whoamiServer returns an MCP server whose whoami tool answers the pid and
+// uid of the client, or the error of CredentialsFromSession.
+func whoamiServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "whoami", Version: "v1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(_ context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		creds, err := CredentialsFromSession(req.Session)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%d %d", creds.PID, creds.UID)}}}, nil, nil
+	})
+	return server
+}
+
+// whoami calls the whoami tool through transport.
+func whoami(t *testing.T, transport mcp.Transport) (string, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil).Connect(ctx, transport, nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer session.Close()
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "whoami", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	return res.Content[0].(*mcp.TextContent).Text, !res.IsError
+}
+
+// selfSigned returns a certificate for name and a pool trusting it.
+func selfSigned(t *testing.T, name string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestCredentialsFromSession(t *testing.T) {
+	cert, pool := selfSigned(t, "mcp.local")
+	tests := []struct {
+		name           string
+		server, client []tcp.Option
+	}{
+		{name: "plain"},
+		{
+			name:   "tls",
+			server: []tcp.Option{tcp.WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}})},
+			client: []tcp.Option{tcp.WithTLS(&tls.Config{RootCAs: pool, ServerName: "mcp.local"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, path := listen(t)
+			go Serve(listener, whoamiServer(), tt.server...)
+
+			got, ok := whoami(t, NewTransport(path, tt.client...))
+			if runtime.GOOS != "linux" {
+				if ok || !strings.Contains(got, ErrCredentialsUnsupported.Error()) {
+					t.Errorf("whoami = %q, want %v", got, ErrCredentialsUnsupported)
+				}
+				return
+			}
+			// the client is this very process
+			if want := fmt.Sprintf("%d %d", os.Getpid(), os.Getuid()); !ok || got != want {
+				t.Errorf("whoami = %q, want pid and uid %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromTCPSession(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go tcp.Serve(listener, whoamiServer())
+
+	if got, ok := whoami(t, tcp.NewTransport(listener.Addr().String())); ok || !strings.Contains(got, "not a Unix socket") {
+		t.Errorf("whoami over TCP = %q, want an error", got)
+	}
+}
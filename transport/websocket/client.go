@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var _ mcp.Transport = (*Transport)(nil)
+
+// Transport is the client side [mcp.Transport]: every call to Connect opens a
+// new WebSocket connection to URL.
+type Transport struct {
+	// URL is the ws:// or wss:// address of the MCP endpoint.
+	URL string
+	// Header holds extra headers sent with the opening handshake, e.g.
+	// Authorization.
+	Header http.Header
+	// TLSConfig is used for wss:// URLs. A default configuration is used when
+	// nil.
+	TLSConfig *tls.Config
+	// Dialer is used to open the connection. The zero value is used when nil.
+	Dialer *net.Dialer
+}
+
+// NewTransport returns a transport that connects to rawURL.
+func NewTransport(rawURL string) *Transport {
+	return &Transport{URL: rawURL}
+}
+
+// Connect opens the connection and performs the opening handshake.
+func (t *Transport) Connect(ctx context.Context) (mcp.Connection, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var secure bool
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		secure = true
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		if secure {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	var netConn net.Conn
+	if secure {
+		config := t.TLSConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := t.handshake(ctx, netConn, u)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return newConnection(ws), nil
+}
+
+func (t *Transport) handshake(ctx context.Context, netConn net.Conn, u *url.URL) (*wsConn, error) {
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := netConn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     t.Header.Clone(),
+		Host:       u.Host,
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", Subprotocol)
+
+	if err := req.Write(netConn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket: handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("websocket: handshake failed: invalid Sec-WebSocket-Accept")
+	}
+
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return newWSConn(netConn, br, true), nil
+}
@@ -0,0 +1,116 @@
+// Package websocket implements an MCP transport over WebSocket connections,
+// carrying one JSON-RPC message per text message.
+//
+// It makes MCP reachable from browsers and through HTTP proxies: a [Handler]
+// upgrades HTTP requests and runs an [mcp.Server] session on each of them, and
+// a [Transport] dials a ws:// or wss:// URL from a Go client. A browser page
+// connects with new WebSocket(url, "mcp") and exchanges JSON-RPC text frames.
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/internal/randid"
+)
+
+// Subprotocol is the WebSocket subprotocol negotiated for MCP sessions.
+const Subprotocol = "mcp"
+
+var _ mcp.Connection = (*Connection)(nil)
+
+// Connection is an [mcp.Connection] over an upgraded WebSocket connection.
+type Connection struct {
+	ws        *wsConn
+	sessionID string
+
+	// incoming receives the messages read by the loop started in newConnection,
+	// so that Read can be interrupted by its context or by Close.
+	incoming chan readResult
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+func newConnection(ws *wsConn) *Connection {
+	c := &Connection{
+		ws:        ws,
+		sessionID: randid.New(),
+		incoming:  make(chan readResult),
+		closed:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *Connection) readLoop() {
+	for {
+		data, err := c.ws.readMessage()
+		select {
+		case c.incoming <- readResult{data: data, err: err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read returns the next message received on the connection.
+func (c *Connection) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, mcp.ErrConnectionClosed
+	case res := <-c.incoming:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return jsonrpc.DecodeMessage(res.data)
+	}
+}
+
+// Write sends msg as a single text message. It is safe to call concurrently.
+func (c *Connection) Write(ctx context.Context, msg jsonrpc.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	return c.ws.writeFrameBefore(opText, data, deadline)
+}
+
+// Close sends a close frame and closes the connection. It is safe to call
+// more than once.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.closeErr = c.ws.close()
+	})
+	return c.closeErr
+}
+
+// SessionID returns the id generated for this connection.
+func (c *Connection) SessionID() string {
+	return c.sessionID
+}
+
+// handshakeTimeout bounds the opening handshake of a connection.
+const handshakeTimeout = 10 * time.Second
@@ -0,0 +1,237 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Frame opcodes, RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// closeNormal is the status code sent when a connection is closed on purpose.
+const closeNormal = 1000
+
+// DefaultMaxMessageSize bounds the size of a reassembled message.
+const DefaultMaxMessageSize = 4 << 20
+
+var errProtocol = errors.New("websocket: protocol error")
+
+// wsConn reads and writes WebSocket messages on an upgraded connection.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// client connections mask the frames they send and expect unmasked frames.
+	client         bool
+	maxMessageSize int64
+
+	writeMu sync.Mutex
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, client bool) *wsConn {
+	return &wsConn{conn: conn, br: br, client: client, maxMessageSize: DefaultMaxMessageSize}
+}
+
+// readMessage returns the payload of the next text or binary message,
+// answering pings and reassembling fragmented messages on the way. It returns
+// [io.EOF] when the peer closes the connection.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var (
+		msg     []byte
+		started bool
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			reply := payload
+			if len(reply) > 2 {
+				reply = reply[:2]
+			}
+			_ = c.writeFrame(opClose, reply)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, fmt.Errorf("%w: new message inside a fragmented one", errProtocol)
+			}
+			started = true
+			msg = payload
+		case opContinuation:
+			if !started {
+				return nil, fmt.Errorf("%w: unexpected continuation frame", errProtocol)
+			}
+			msg = append(msg, payload...)
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %#x", errProtocol, op)
+		}
+
+		if int64(len(msg)) > c.maxMessageSize {
+			return nil, fmt.Errorf("websocket: message exceeds %d bytes", c.maxMessageSize)
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", errProtocol)
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, fmt.Errorf("%w: wrong frame masking", errProtocol)
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if op >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", errProtocol)
+	}
+	if length > uint64(c.maxMessageSize) {
+		return false, 0, nil, fmt.Errorf("websocket: frame exceeds %d bytes", c.maxMessageSize)
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+
+	return fin, op, payload, nil
+}
+
+// writeFrame writes payload as a single final frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	buf, err := c.encodeFrame(op, payload)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+// writeFrameBefore is like writeFrame, failing if the frame cannot be written
+// before deadline. A zero deadline means no deadline.
+func (c *wsConn) writeFrameBefore(op byte, payload []byte, deadline time.Time) error {
+	buf, err := c.encodeFrame(op, payload)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+func (c *wsConn) encodeFrame(op byte, payload []byte) ([]byte, error) {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|op)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	return buf, nil
+}
+
+// close sends a close frame, best effort, and closes the connection.
+func (c *wsConn) close() error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	return c.conn.Close()
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
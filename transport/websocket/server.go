@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// HandlerOptions configures a [Handler]. The zero value is valid.
+type HandlerOptions struct {
+	// CheckOrigin decides whether a browser request coming from another origin
+	// may open a session. When nil, only requests without an Origin header or
+	// whose Origin host matches the Host header or is in AllowedOrigins are
+	// accepted.
+	CheckOrigin func(r *http.Request) bool
+	// AllowedOrigins lists the origins of other pages, such as
+	// "http://localhost:8080", accepted when CheckOrigin is nil.
+	AllowedOrigins []string
+	// MaxMessageSize bounds the size of incoming messages. It defaults to
+	// [DefaultMaxMessageSize].
+	MaxMessageSize int64
+	// ErrorLog receives session errors. The standard logger is used when nil.
+	ErrorLog *log.Logger
+}
+
+// Handler is an [http.Handler] that upgrades requests to WebSocket and runs an
+// MCP session on each connection.
+//
+// Upgraded connections are not tracked by [http.Server], whose Shutdown
+// neither closes nor waits for them, so the handler has its own
+// [Handler.Shutdown] to end the sessions.
+type Handler struct {
+	getServer func(*http.Request) *mcp.Server
+	opts      HandlerOptions
+
+	// ctx is the parent context of every session; cancel ends them all.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex // guards closed and the calls to sessions.Add
+	closed   bool
+	sessions sync.WaitGroup
+}
+
+// NewHandler returns a handler serving the server returned by getServer for
+// each request. Returning nil rejects the request with 400 Bad Request.
+func NewHandler(getServer func(*http.Request) *mcp.Server, opts *HandlerOptions) *Handler {
+	h := &Handler{getServer: getServer}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.MaxMessageSize <= 0 {
+		h.opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	return h
+}
+
+// ServeHTTP performs the opening handshake and serves the session until the
+// connection is closed.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket: not a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "websocket: missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	if !h.checkOrigin(r) {
+		http.Error(w, "websocket: origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	server := h.getServer(r)
+	if server == nil {
+		http.Error(w, "websocket: no server for this request", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: connection cannot be upgraded", http.StatusInternalServerError)
+		return
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		http.Error(w, "websocket: server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	h.sessions.Add(1)
+	h.mu.Unlock()
+	defer h.sessions.Done()
+
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		h.logf("websocket: hijack: %v", err)
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", Subprotocol) {
+		response += "Sec-WebSocket-Protocol: " + Subprotocol + "\r\n"
+	}
+	response += "\r\n"
+
+	_ = netConn.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		h.logf("websocket: handshake %s: %v", r.RemoteAddr, err)
+		netConn.Close()
+		return
+	}
+	_ = netConn.SetWriteDeadline(time.Time{})
+
+	ws := newWSConn(netConn, brw.Reader, false)
+	ws.maxMessageSize = h.opts.MaxMessageSize
+
+	// The request context is cancelled once the handler returns, and the
+	// hijacked connection outlives it, so the session runs in the context of
+	// the handler, cancelled by Close and Shutdown.
+	err = server.Run(h.ctx, &connTransport{ws: ws})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		h.logf("websocket: session %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// Close rejects new connections and closes the running sessions, without
+// waiting for them.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.cancel()
+	return nil
+}
+
+// Shutdown closes the handler like [Handler.Close] and waits until every
+// session has ended or ctx is done, in which case it returns the context
+// error. It is meant to be called next to the Shutdown of the [http.Server]
+// serving the handler.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.Close()
+
+	done := make(chan struct{})
+	go func() {
+		h.sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	if h.opts.CheckOrigin != nil {
+		return h.opts.CheckOrigin(r)
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.opts.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (h *Handler) logf(format string, args ...any) {
+	if h.opts.ErrorLog != nil {
+		h.opts.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// connTransport is the server side [mcp.Transport] of an upgraded connection.
+type connTransport struct {
+	ws *wsConn
+}
+
+func (t *connTransport) Connect(context.Context) (mcp.Connection, error) {
+	return newConnection(t.ws), nil
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a client key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether the comma separated header name contains
+// token, ignoring case.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"mcp/transport/transporttest"
+)
+
+// wsURL returns the ws:// URL of the /mcp endpoint of server.
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/mcp"
+}
+
+// serveHandler serves handler at /mcp of a test server.
+func serveHandler(t *testing.T, handler *Handler) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		handler.Close()
+		server.Close()
+	})
+	return server
+}
+
+func TestConnection(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (mcp.Connection, mcp.Connection) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		// the server end is upgraded by hand, since a Handler keeps its
+		// connections for the sessions it runs
+		accepted := make(chan mcp.Connection, 1)
+		go func() {
+			defer close(accepted)
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			br := bufio.NewReader(conn)
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+				"Sec-WebSocket-Accept: " + acceptKey(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+			if _, err := conn.Write([]byte(response)); err != nil {
+				conn.Close()
+				return
+			}
+			accepted <- newConnection(newWSConn(conn, br, false))
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+		defer cancel()
+		client, err := NewTransport("ws://" + listener.Addr().String() + "/mcp").Connect(ctx)
+		if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		server, ok := <-accepted
+		if !ok {
+			client.Close()
+			t.Fatal("upgrade failed")
+		}
+		return client, server
+	})
+}
+
+func TestSession(t *testing.T) {
+	transporttest.RunSession(t, func(t *testing.T, server *mcp.Server) mcp.Transport {
+		handler := NewHandler(func(*http.Request) *mcp.Server { return server }, nil)
+		return NewTransport(wsURL(serveHandler(t, handler)))
+	})
+}
+
+func TestHandlerShutdown(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+	handler := NewHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	httpServer := serveHandler(t, handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(ctx, NewTransport(wsURL(httpServer)), nil)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer session.Close()
+
+	// http.Server.Shutdown leaves hijacked connections alone, so the session
+	// only ends with the handler
+	if err := handler.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	ended := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(transporttest.Timeout):
+		t.Fatal("client session still open after Shutdown")
+	}
+
+	if _, err := client.Connect(ctx, NewTransport(wsURL(httpServer)), nil); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("Connect after Shutdown = %v, want a 503 response", err)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+	handler := NewHandler(func(*http.Request) *mcp.Server { return server }, &HandlerOptions{AllowedOrigins: []string{"http://ui.example:8080"}})
+	httpServer := serveHandler(t, handler)
+
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{httpServer.URL, true},
+		{"http://ui.example:8080", true},
+		{"http://evil.example", false},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), transporttest.Timeout)
+		transport := NewTransport(wsURL(httpServer))
+		if tt.origin != "" {
+			transport.Header = http.Header{"Origin": {tt.origin}}
+		}
+		conn, err := transport.Connect(ctx)
+		cancel()
+		if err == nil {
+			conn.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("Connect with Origin %q: err = %v, want ok = %t", tt.origin, err, tt.ok)
+		}
+	}
+}